@@ -0,0 +1,32 @@
+// Lệnh sửa dữ liệu: tạo showtime_seats cho các suất chiếu chưa có ghế.
+//
+//	go run ./cmd/backfill-showtime-seats
+package main
+
+import (
+	"log"
+	"movie-ticket-booking/config"
+	"movie-ticket-booking/database"
+	"movie-ticket-booking/services"
+)
+
+func main() {
+	config.LoadEnv()
+	database.Connect()
+
+	results, err := services.BackfillMissingShowtimeSeats(database.DB)
+	if err != nil {
+		log.Fatalf("Backfill thất bại: %v", err)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+			log.Printf("❌ Showtime %d: %s", r.ShowtimeID, r.Error)
+			continue
+		}
+		log.Printf("✅ Showtime %d: thêm %d ghế", r.ShowtimeID, r.SeatsAdded)
+	}
+	log.Printf("Hoàn tất: %d suất chiếu, %d lỗi", len(results), failed)
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"golang.org/x/oauth2"
@@ -60,9 +63,214 @@ func GetMomoEnv() map[string]string {
 		"SECRET_KEY":   GetEnv("MOMO_SECRET_KEY", ""),
 		"REDIRECT_URL": GetEnv("MOMO_REDIRECT_URL", ""),
 		"IPN_URL":      GetEnv("MOMO_IPN_URL", ""),
+		"ENDPOINT":     GetEnv("MOMO_ENDPOINT", "https://test-payment.momo.vn"),
 	}
 }
 
+func GetVNPayEnv() map[string]string {
+	return map[string]string{
+		"TMN_CODE":    GetEnv("VNPAY_TMN_CODE", ""),
+		"HASH_SECRET": GetEnv("VNPAY_HASH_SECRET", ""),
+		"PAY_URL":     GetEnv("VNPAY_PAY_URL", "https://sandbox.vnpayment.vn/paymentv2/vpcpay.html"),
+		"API_URL":     GetEnv("VNPAY_API_URL", "https://sandbox.vnpayment.vn/merchant_webapi/api/transaction"),
+		"RETURN_URL":  GetEnv("VNPAY_RETURN_URL", ""),
+	}
+}
+
+func GetZaloPayEnv() map[string]string {
+	return map[string]string{
+		"APP_ID":       GetEnv("ZALOPAY_APP_ID", ""),
+		"KEY1":         GetEnv("ZALOPAY_KEY1", ""),
+		"KEY2":         GetEnv("ZALOPAY_KEY2", ""),
+		"ENDPOINT":     GetEnv("ZALOPAY_ENDPOINT", "https://sb-openapi.zalopay.vn/v2"),
+		"CALLBACK_URL": GetEnv("ZALOPAY_CALLBACK_URL", ""),
+		"REDIRECT_URL": GetEnv("ZALOPAY_REDIRECT_URL", ""),
+	}
+}
+
+// GetFakePaymentEnv cấu hình cổng thanh toán giả lập dùng khi phát triển và
+// chạy integration test. Chỉ bật khi PAYMENT_FAKE_ENABLED=true.
+func GetFakePaymentEnv() map[string]string {
+	return map[string]string{
+		"ENABLED":      GetEnv("PAYMENT_FAKE_ENABLED", "false"),
+		"SECRET":       GetEnv("PAYMENT_FAKE_SECRET", "fake-payment-secret"),
+		"BASE_URL":     GetEnv("PAYMENT_FAKE_BASE_URL", "http://localhost:8080"),
+		"REDIRECT_URL": GetEnv("PAYMENT_FAKE_REDIRECT_URL", ""),
+	}
+}
+
+// GetDefaultPaymentProvider là cổng thanh toán dùng khi chi nhánh chưa cấu hình.
+func GetDefaultPaymentProvider() string {
+	return GetEnv("PAYMENT_DEFAULT_PROVIDER", "momo")
+}
+
+// GetQuoteSecret là khóa ký báo giá đơn hàng; mặc định dùng JWT_KEY.
+func GetQuoteSecret() []byte {
+	if secret := GetEnv("PRICING_QUOTE_SECRET", ""); secret != "" {
+		return []byte(secret)
+	}
+	return GetJWTKey()
+}
+
+// GetSeatHoldMinutes trả về thời gian giữ ghế mặc định khi chi nhánh và suất
+// chiếu không cấu hình riêng.
+func GetSeatHoldMinutes() int {
+	minutes, err := strconv.Atoi(GetEnv("SEAT_HOLD_MINUTES", "3"))
+	if err != nil || minutes <= 0 {
+		return 3
+	}
+	return minutes
+}
+
+// GetPaymentReconcileMinutes: giao dịch pending lâu hơn số phút này sẽ được tra
+// cứu lại trạng thái ở cổng thanh toán.
+func GetPaymentReconcileMinutes() int {
+	minutes, err := strconv.Atoi(GetEnv("PAYMENT_RECONCILE_MINUTES", "15"))
+	if err != nil || minutes <= 0 {
+		return 15
+	}
+	return minutes
+}
+
+// GetPaymentExpireMinutes: giao dịch cổng vẫn báo chưa thanh toán sau số phút
+// này được coi là hết hạn.
+func GetPaymentExpireMinutes() int {
+	minutes, err := strconv.Atoi(GetEnv("PAYMENT_EXPIRE_MINUTES", "120"))
+	if err != nil || minutes <= 0 {
+		return 120
+	}
+	return minutes
+}
+
+// GetTicketKeyRetentionDays: khóa ký QR đã xoay vẫn được dùng để xác thực
+// trong số ngày này để vé đã phát hành không bị vô hiệu.
+func GetTicketKeyRetentionDays() int {
+	days, err := strconv.Atoi(GetEnv("TICKET_KEY_RETENTION_DAYS", "30"))
+	if err != nil || days <= 0 {
+		return 30
+	}
+	return days
+}
+
+// GetTicketValidBeforeMinutes: vé được soát từ số phút này trước giờ chiếu.
+func GetTicketValidBeforeMinutes() int {
+	minutes, err := strconv.Atoi(GetEnv("TICKET_VALID_BEFORE_MINUTES", "60"))
+	if err != nil || minutes < 0 {
+		return 60
+	}
+	return minutes
+}
+
+// PointsConfig là quy đổi điểm tích lũy khi thanh toán.
+type PointsConfig struct {
+	ValueVND          int // giá trị 1 điểm (VND)
+	MaxPercent        int // tối đa bao nhiêu % giá trị đơn được trả bằng điểm
+	MaxPointsPerOrder int // số điểm tối đa mỗi đơn, 0 = không giới hạn
+}
+
+func GetPointsConfig() *PointsConfig {
+	atoi := func(key, def string) int {
+		value, err := strconv.Atoi(GetEnv(key, def))
+		if err != nil || value < 0 {
+			value, _ = strconv.Atoi(def)
+		}
+		return value
+	}
+	cfg := &PointsConfig{
+		ValueVND:          atoi("POINTS_VALUE_VND", "1"),
+		MaxPercent:        atoi("POINTS_MAX_PERCENT", "100"),
+		MaxPointsPerOrder: atoi("POINTS_MAX_PER_ORDER", "0"),
+	}
+	if cfg.MaxPercent > 100 {
+		cfg.MaxPercent = 100
+	}
+	return cfg
+}
+
+// InvoiceConfig là thông tin người bán in trên hóa đơn PDF. Giá vé đã gồm
+// VAT theo VATPercent.
+type InvoiceConfig struct {
+	CompanyName string
+	TaxCode     string
+	Address     string
+	VATPercent  int
+}
+
+func GetInvoiceConfig() *InvoiceConfig {
+	vat, err := strconv.Atoi(GetEnv("INVOICE_VAT_PERCENT", "10"))
+	if err != nil || vat < 0 {
+		vat = 10
+	}
+	return &InvoiceConfig{
+		CompanyName: GetEnv("INVOICE_COMPANY_NAME", "CINÉMÀ"),
+		TaxCode:     GetEnv("INVOICE_TAX_CODE", ""),
+		Address:     GetEnv("INVOICE_COMPANY_ADDRESS", ""),
+		VATPercent:  vat,
+	}
+}
+
+// PDFFontConfig là đường dẫn font TrueType (.ttf) có đủ chữ tiếng Việt dùng cho
+// vé và hóa đơn PDF, ví dụ DejaVuSans.ttf / DejaVuSans-Bold.ttf. Để trống thì
+// PDF dùng font Open Sans nhúng sẵn.
+type PDFFontConfig struct {
+	RegularPath string
+	BoldPath    string
+}
+
+func GetPDFFontConfig() *PDFFontConfig {
+	return &PDFFontConfig{
+		RegularPath: GetEnv("PDF_FONT_PATH", ""),
+		BoldPath:    GetEnv("PDF_FONT_BOLD_PATH", ""),
+	}
+}
+
+// CancellationFeeTier: hủy trước giờ chiếu ít nhất HoursBefore giờ thì mất
+// FeePercent % số tiền được hoàn.
+type CancellationFeeTier struct {
+	HoursBefore int
+	FeePercent  int
+}
+
+// CancellationPolicy là chính sách khách tự hủy đơn hàng.
+type CancellationPolicy struct {
+	CutoffHours int                   // chỉ được hủy trước giờ chiếu ít nhất số giờ này
+	FeeTiers    []CancellationFeeTier // sắp xếp theo HoursBefore giảm dần
+	RefundFood  bool                  // có hoàn tiền thức ăn hay không
+}
+
+// GetCancellationPolicy đọc ORDER_CANCEL_CUTOFF_HOURS, ORDER_CANCEL_REFUND_FOOD
+// và ORDER_CANCEL_FEE_TIERS dạng "giờ:phí%,..." (mặc định "24:0,6:10,0:30":
+// trước 24 giờ miễn phí, trước 6 giờ phí 10%, sau đó 30%).
+func GetCancellationPolicy() *CancellationPolicy {
+	cutoff, err := strconv.Atoi(GetEnv("ORDER_CANCEL_CUTOFF_HOURS", "2"))
+	if err != nil || cutoff < 0 {
+		cutoff = 2
+	}
+	refundFood, err := strconv.ParseBool(GetEnv("ORDER_CANCEL_REFUND_FOOD", "false"))
+	if err != nil {
+		refundFood = false
+	}
+
+	policy := &CancellationPolicy{CutoffHours: cutoff, RefundFood: refundFood}
+	for _, item := range strings.Split(GetEnv("ORDER_CANCEL_FEE_TIERS", "24:0,6:10,0:30"), ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 2 {
+			continue
+		}
+		hours, err1 := strconv.Atoi(parts[0])
+		fee, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil || hours < 0 || fee < 0 || fee > 100 {
+			log.Printf("⚠️  Bỏ qua mức phí hủy không hợp lệ: %q", item)
+			continue
+		}
+		policy.FeeTiers = append(policy.FeeTiers, CancellationFeeTier{HoursBefore: hours, FeePercent: fee})
+	}
+	sort.Slice(policy.FeeTiers, func(i, j int) bool {
+		return policy.FeeTiers[i].HoursBefore > policy.FeeTiers[j].HoursBefore
+	})
+	return policy
+}
+
 type SendMailConfig struct {
 	From   string
 	APIKey string
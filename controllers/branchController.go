@@ -5,6 +5,7 @@ import (
 	"log"
 	"movie-ticket-booking/database"
 	"movie-ticket-booking/models"
+	"movie-ticket-booking/payment"
 	"movie-ticket-booking/services"
 	"net/http"
 	"time"
@@ -158,3 +159,59 @@ func UpdateBranch(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Branch updated successfully", "data": branch})
 }
+
+// UpdateBranchSettings cập nhật các cấu hình đặt vé của chi nhánh. Chỉ những
+// trường được gửi lên mới bị thay đổi. Chỉ admin hoặc quản lý của chi nhánh
+// được sửa.
+func UpdateBranchSettings(c *gin.Context) {
+	branchID, ok := requireBranchStaff(c)
+	if !ok {
+		return
+	}
+
+	var branch models.Branch
+	if err := database.DB.First(&branch, branchID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+		return
+	}
+
+	var input struct {
+		SeatHoldMinutes    *int    `json:"SeatHoldMinutes"`
+		PreventOrphanSeats *bool   `json:"PreventOrphanSeats"`
+		PaymentProvider    *string `json:"PaymentProvider"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"LastUpdatedBy": c.GetString("Email"),
+	}
+	if input.SeatHoldMinutes != nil {
+		if *input.SeatHoldMinutes < 0 || *input.SeatHoldMinutes > 30 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "SeatHoldMinutes phải nằm trong khoảng 0 - 30"})
+			return
+		}
+		updates["SeatHoldMinutes"] = *input.SeatHoldMinutes
+	}
+	if input.PreventOrphanSeats != nil {
+		updates["PreventOrphanSeats"] = *input.PreventOrphanSeats
+	}
+	if input.PaymentProvider != nil {
+		if *input.PaymentProvider != "" {
+			if _, err := payment.Get(*input.PaymentProvider); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "enabledProviders": payment.Enabled()})
+				return
+			}
+		}
+		updates["PaymentProvider"] = *input.PaymentProvider
+	}
+
+	if err := database.DB.Model(&branch).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cập nhật cấu hình thất bại"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Branch settings updated successfully", "data": branch})
+}
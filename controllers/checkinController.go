@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"errors"
+	"movie-ticket-booking/database"
+	"movie-ticket-booking/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScanTicket được nhân viên soát vé gọi khi quét QR: kiểm tra mã vé thuộc
+// chi nhánh (và suất chiếu nếu có), đánh dấu đã dùng và trả về danh sách ghế.
+func ScanTicket(c *gin.Context) {
+	var request services.ScanRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	staffID := c.GetInt("AccountID")
+	allowed, err := services.CanAccessBranch(database.DB, staffID, request.BranchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrNotBranchStaff.Error()})
+		return
+	}
+
+	ticket, err := services.ScanTicket(database.DB, staffID, request)
+	if err != nil {
+		var scanErr *services.TicketScanError
+		if !errors.As(err, &scanErr) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan ticket"})
+			return
+		}
+		status := http.StatusUnprocessableEntity
+		switch scanErr.Reason {
+		case services.ScanNotFound:
+			status = http.StatusNotFound
+		case services.ScanAlreadyUsed:
+			status = http.StatusConflict
+		case services.ScanVoid:
+			status = http.StatusGone
+		}
+		c.JSON(status, gin.H{"error": scanErr.Error(), "reason": scanErr.Reason, "ticket": scanErr.Ticket})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vé hợp lệ", "ticket": ticket})
+}
+
+// requireBranchStaff kiểm tra người gọi là nhân viên của chi nhánh :BranchID.
+// Khi không hợp lệ đã trả response và ok = false.
+func requireBranchStaff(c *gin.Context) (branchID int, ok bool) {
+	branchID, err := strconv.Atoi(c.Param("BranchID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid BranchID"})
+		return 0, false
+	}
+	return branchID, requireBranchAccess(c, branchID)
+}
+
+// requireBranchAccess kiểm tra người gọi là admin hoặc quản lý của chi nhánh
+// branchID. Khi không hợp lệ đã trả response và trả về false.
+func requireBranchAccess(c *gin.Context, branchID int) bool {
+	allowed, err := services.CanAccessBranch(database.DB, c.GetInt("AccountID"), branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrNotBranchStaff.Error()})
+		return false
+	}
+	return true
+}
+
+// requireAdmin chỉ cho tài khoản admin đi tiếp. Khi không hợp lệ đã trả
+// response và trả về false.
+func requireAdmin(c *gin.Context) bool {
+	_, admin, err := services.StaffScope(database.DB, c.GetInt("AccountID"))
+	if err != nil && !errors.Is(err, services.ErrNotBranchStaff) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
+		return false
+	}
+	if !admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Chỉ admin được thực hiện thao tác này"})
+		return false
+	}
+	return true
+}
+
+// GetBranchTicketKeys trả về bộ khóa xác thực QR của chi nhánh để máy soát vé
+// tải về và xác thực offline bằng package ticketqr.
+func GetBranchTicketKeys(c *gin.Context) {
+	branchID, ok := requireBranchStaff(c)
+	if !ok {
+		return
+	}
+	if _, err := services.ActiveBranchKey(database.DB, branchID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get ticket keys"})
+		return
+	}
+	keys, err := services.BranchVerificationKeys(database.DB, branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get ticket keys"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, gin.H{
+			"KeyID":       key.KeyID,
+			"Secret":      key.Secret,
+			"Status":      key.Status,
+			"VerifyUntil": key.VerifyUntil,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"branchID": branchID, "keys": result})
+}
+
+// RotateBranchTicketKey tạo khóa ký QR mới cho chi nhánh. Vé đã phát hành
+// bằng khóa cũ vẫn hợp lệ trong thời gian lưu giữ khóa.
+func RotateBranchTicketKey(c *gin.Context) {
+	branchID, ok := requireBranchStaff(c)
+	if !ok {
+		return
+	}
+	key, err := services.RotateBranchKey(database.DB, branchID, c.GetString("Email"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate ticket key"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã tạo khóa ký QR mới", "keyID": key.KeyID})
+}
+
+// GetCheckinManifest trả về manifest đã ký của mọi vé trong các suất chiếu
+// ?Hours giờ tới tại chi nhánh, để máy soát vé dùng khi mất kết nối.
+func GetCheckinManifest(c *gin.Context) {
+	branchID, ok := requireBranchStaff(c)
+	if !ok {
+		return
+	}
+	hours, _ := strconv.Atoi(c.DefaultQuery("Hours", strconv.Itoa(services.DefaultManifestHours)))
+
+	token, manifest, err := services.BuildCheckinManifest(database.DB, branchID, hours)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build manifest"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"manifest":    token,
+		"from":        manifest.From,
+		"to":          manifest.To,
+		"ticketCount": len(manifest.Tickets),
+	})
+}
+
+// SyncOfflineScans nhận các lần quét máy soát vé thực hiện khi offline và trả
+// về kết quả từng lần quét, gồm các conflict (vé quét ở nhiều cửa, vé đã hủy).
+func SyncOfflineScans(c *gin.Context) {
+	branchID, ok := requireBranchStaff(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		DeviceID string                 `json:"DeviceID" binding:"required"`
+		Scans    []services.OfflineScan `json:"Scans" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := services.SyncOfflineScans(database.DB, c.GetInt("AccountID"), branchID, request.DeviceID, request.Scans)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync scans"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
@@ -1,19 +1,13 @@
 package controllers
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"movie-ticket-booking/config"
 	"movie-ticket-booking/database"
 	"movie-ticket-booking/models"
+	"movie-ticket-booking/payment"
 	"movie-ticket-booking/services"
-	"movie-ticket-booking/utils"
 	"net/http"
 	"strconv"
 	"time"
@@ -186,6 +180,8 @@ func contains(arr []int, val int) bool {
 	return false
 }
 
+// AddOrder ghi thẳng một đơn hàng (không qua thanh toán), dùng cho nhân viên
+// nhập đơn bán tại quầy. Chỉ admin hoặc quản lý chi nhánh của suất chiếu.
 func AddOrder(c *gin.Context) {
 	var order models.Order
 
@@ -194,6 +190,19 @@ func AddOrder(c *gin.Context) {
 		return
 	}
 
+	branchID, err := services.ShowtimeBranchID(database.DB, order.ShowtimeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find showtime"})
+		return
+	}
+	if branchID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Showtime not found"})
+		return
+	}
+	if !requireBranchAccess(c, branchID) {
+		return
+	}
+
 	order.CreatedAt = time.Now()
 
 	if err := database.DB.Create(&order).Error; err != nil {
@@ -207,26 +216,22 @@ func AddOrder(c *gin.Context) {
 	})
 }
 
-func CreateMomoPayment(c *gin.Context) {
-	var request struct {
-		Order              models.Order       `json:"order"`
-		OrderFoods         []models.OrderFood `json:"orderFoods"`
-		ShowtimeSeatUpdate struct {
-			ShowtimeSeatIDs []int `json:"ShowtimeSeatIDs"`
-		} `json:"showtimeSeatUpdates"`
-	}
-
-	// Parse request
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
-		return
+// prepareCheckout kiểm tra suất chiếu, ghế và tính lại giá ở server rồi lưu
+// phiên thanh toán. Khi lỗi đã trả response và ok = false.
+func prepareCheckout(c *gin.Context, request services.CheckoutPayload) (*models.PendingCheckout, *services.Quote, bool) {
+	// ✅ Tài khoản chỉ lấy từ token, không tin AccountID client gửi lên; dùng
+	// điểm bắt buộc đăng nhập
+	request.Order.AccountID = c.GetInt("AccountID")
+	if request.Order.AccountID == 0 && request.Order.PointsUsed > 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": services.ErrPointsRequireLogin.Error()})
+		return nil, nil, false
 	}
 
 	// ✅ Kiểm tra suất chiếu còn hợp lệ không
 	var showtime models.Showtime
 	if err := database.DB.First(&showtime, request.Order.ShowtimeID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy suất chiếu"})
-		return
+		return nil, nil, false
 	}
 
 	layout := "2006-01-02 15:04"
@@ -234,254 +239,513 @@ func CreateMomoPayment(c *gin.Context) {
 	showtimeStartTime, err := time.ParseInLocation(layout, showtimeStartStr, time.Local)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Định dạng ngày/giờ suất chiếu không hợp lệ"})
-		return
+		return nil, nil, false
 	}
 
 	if !time.Now().Before(showtimeStartTime) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Suất chiếu đã đóng đặt vé"})
+		return nil, nil, false
+	}
+
+	// ✅ Mua một ghế đôi luôn bao gồm ghế còn lại của cặp
+	seatIDs, err := services.ExpandPairedSeats(database.DB, request.Order.ShowtimeID, request.ShowtimeSeatUpdate.ShowtimeSeatIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load seats"})
+		return nil, nil, false
+	}
+	request.ShowtimeSeatUpdate.ShowtimeSeatIDs = seatIDs
+
+	// ✅ Kiểm tra luật chống ghế lẻ của chi nhánh
+	if err := services.ValidateSeatSelection(database.DB, request.Order.ShowtimeID, request.ShowtimeSeatUpdate.ShowtimeSeatIDs); err != nil {
+		var orphanErr *services.OrphanSeatError
+		if errors.As(err, &orphanErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": orphanErr.Error(), "orphanSeats": orphanErr.Seats})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate seats"})
+		return nil, nil, false
+	}
+
+	// ✅ Tính lại giá ở server, client gửi sai giá thì trả về chênh lệch
+	quote, err := services.ComputeQuote(database.DB, services.QuoteRequestFromCheckout(request))
+	if err != nil {
+		respondQuoteError(c, err)
+		return nil, nil, false
+	}
+	if err := services.CompareClientTotals(quote, request.Order.Total, request.OrderFoods); err != nil {
+		respondQuoteError(c, err)
+		return nil, nil, false
+	}
+	services.ApplyQuote(&request, quote)
+
+	checkout, err := services.CreatePendingCheckout(database.DB, holdOwnerFromContext(c), request)
+	if err != nil {
+		var conflictErr *services.SeatConflictError
+		if errors.As(err, &conflictErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": conflictErr.Error(), "conflicts": conflictErr.Conflicts})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save checkout"})
+		return nil, nil, false
+	}
+	return checkout, quote, true
+}
+
+// CreateCheckout lưu đơn hàng đang chọn ở server và trả về checkoutRef dùng
+// để tạo thanh toán. Phiên hết hạn cùng lúc với ghế đang giữ.
+func CreateCheckout(c *gin.Context) {
+	var request services.CheckoutPayload
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
 		return
 	}
+	checkout, quote, ok := prepareCheckout(c, request)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"checkoutRef": checkout.CheckoutRef,
+		"expiresAt":   checkout.ExpiresAt,
+		"quote":       quote,
+	})
+}
 
-	// -- Encode request data into extraData --
-	rawData, _ := json.Marshal(request)
-	extraData := base64.StdEncoding.EncodeToString(rawData)
+// CreatePayment tạo giao dịch thanh toán cho một phiên thanh toán: theo
+// "checkoutRef" đã tạo ở /order/checkout, hoặc tạo phiên mới từ dữ liệu đơn
+// hàng gửi kèm. Cổng thanh toán lấy theo "provider" trong request, nếu không
+// có thì theo cấu hình của chi nhánh. Chỉ mã phiên được gửi qua cổng.
+func CreatePayment(c *gin.Context) {
+	var body struct {
+		services.CheckoutPayload
+		CheckoutRef string `json:"checkoutRef"`
+		Provider    string `json:"provider"`
+	}
+
+	// Parse request
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	var checkout *models.PendingCheckout
+	var quote *services.Quote
+	var err error
+	if body.CheckoutRef != "" {
+		checkout, err = services.FindOpenCheckout(database.DB, body.CheckoutRef)
+		switch {
+		case errors.Is(err, services.ErrCheckoutNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, services.ErrCheckoutExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get checkout"})
+			return
+		}
+		owner := holdOwnerFromContext(c)
+		if checkout.AccountID != owner.AccountID ||
+			(checkout.AccountID == 0 && checkout.HoldToken != "" && checkout.HoldToken != owner.HoldToken) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Phiên thanh toán không thuộc về bạn"})
+			return
+		}
+		payload, err := services.CheckoutPayloadOf(checkout)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get checkout"})
+			return
+		}
+		quote = payload.Quote
+	} else {
+		var ok bool
+		if checkout, quote, ok = prepareCheckout(c, body.CheckoutPayload); !ok {
+			return
+		}
+	}
 
-	// -- MoMo config --
 	flake := sonyflake.NewSonyflake(sonyflake.Settings{})
 	orderIDGen, _ := flake.NextID()
-	requestIDGen, _ := flake.NextID()
-
-	endpoint := "https://test-payment.momo.vn/v2/gateway/api/create"
-	momoCfg := config.GetMomoEnv()
-	partnerCode := momoCfg["PARTNER_CODE"]
-	accessKey := momoCfg["ACCESS_KEY"]
-	secretKey := momoCfg["SECRET_KEY"]
-	redirectUrl := momoCfg["REDIRECT_URL"]
-	ipnUrl := momoCfg["IPN_URL"]
-	amount := strconv.Itoa(int(request.Order.Total))
-	orderId := strconv.FormatUint(orderIDGen, 10)
-	requestId := strconv.FormatUint(requestIDGen, 10)
-	orderInfo := "Thanh toán vé xem phim tại CINÉMÀ"
-	requestType := "payWithMethod"
-
-	// -- Signature --
-	var rawSignature bytes.Buffer
-	rawSignature.WriteString("accessKey=" + accessKey)
-	rawSignature.WriteString("&amount=" + amount)
-	rawSignature.WriteString("&extraData=" + extraData)
-	rawSignature.WriteString("&ipnUrl=" + ipnUrl)
-	rawSignature.WriteString("&orderId=" + orderId)
-	rawSignature.WriteString("&orderInfo=" + orderInfo)
-	rawSignature.WriteString("&partnerCode=" + partnerCode)
-	rawSignature.WriteString("&redirectUrl=" + redirectUrl)
-	rawSignature.WriteString("&requestId=" + requestId)
-	rawSignature.WriteString("&requestType=" + requestType)
-
-	h := hmac.New(sha256.New, []byte(secretKey))
-	h.Write(rawSignature.Bytes())
-	signature := hex.EncodeToString(h.Sum(nil))
-
-	// -- Payload --
-	payload := map[string]interface{}{
-		"partnerCode":  partnerCode,
-		"accessKey":    accessKey,
-		"requestId":    requestId,
-		"amount":       amount,
-		"orderId":      orderId,
-		"orderInfo":    orderInfo,
-		"redirectUrl":  redirectUrl,
-		"ipnUrl":       ipnUrl,
-		"extraData":    extraData,
-		"requestType":  requestType,
-		"signature":    signature,
-		"lang":         "vi",
-		"autoCapture":  true,
-		"orderGroupId": "",
-		"partnerName":  "Movie Ticket",
-		"storeId":      "MT001",
-	}
-
-	payloadBytes, _ := json.Marshal(payload)
-	resp, err := http.Post(endpoint, "application/json", bytes.NewBuffer(payloadBytes))
+	paymentRef := strconv.FormatUint(orderIDGen, 10)
+
+	// ✅ Trả hoàn toàn bằng điểm: tạo đơn ngay, không qua cổng thanh toán
+	if quote.Total == 0 {
+		order, err := services.CompletePointsOnlyOrder(database.DB, paymentRef, checkout)
+		if err != nil {
+			var conflictErr *services.SeatConflictError
+			if errors.As(err, &conflictErr) {
+				c.JSON(http.StatusConflict, gin.H{"error": conflictErr.Error(), "conflicts": conflictErr.Conflicts})
+				return
+			}
+			if errors.Is(err, services.ErrInsufficientPoints) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save order"})
+			return
+		}
+		if order.Email != "" {
+			go func(orderID int) {
+				if err := SendOrderInvoiceByID(orderID); err != nil {
+					log.Printf("❌ Gửi email thất bại cho order %d: %v", orderID, err)
+				}
+			}(order.OrderID)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"orderId":  paymentRef,
+			"orderID":  order.OrderID,
+			"provider": services.PaymentProviderPoints,
+			"quote":    quote,
+		})
+		return
+	}
+
+	// ✅ Chọn cổng thanh toán
+	providerName := body.Provider
+	if providerName == "" {
+		providerName, err = services.BranchPaymentProvider(database.DB, checkout.ShowtimeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment provider"})
+			return
+		}
+	}
+	provider, err := payment.Get(providerName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create MoMo payment"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "enabledProviders": payment.Enabled()})
 		return
 	}
-	defer resp.Body.Close()
 
-	var momoResp map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&momoResp); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse MoMo response"})
+	// -- Lưu giao dịch (kiểm tra số dư điểm) trước khi gửi sang cổng --
+	paymentRecord, err := services.CreatePaymentRecord(database.DB, providerName, paymentRef, checkout)
+	if errors.Is(err, services.ErrInsufficientPoints) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payment"})
 		return
 	}
 
-	payUrl, ok := momoResp["payUrl"].(string)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid MoMo response", "response": momoResp})
+	// -- Chỉ gửi mã phiên thanh toán qua cổng, dữ liệu đơn hàng nằm ở server --
+	var extraData string
+	if provider.SupportsExtraData() {
+		extraData = checkout.CheckoutRef
+	}
+
+	result, err := provider.CreatePayment(c.Request.Context(), payment.CreateRequest{
+		OrderRef:  paymentRecord.PaymentRef,
+		Amount:    int64(quote.Total),
+		OrderInfo: "Thanh toán vé xem phim tại CINÉMÀ",
+		ExtraData: extraData,
+		ClientIP:  c.ClientIP(),
+	})
+	if err != nil {
+		log.Printf("❌ Tạo giao dịch %s thất bại: %v", providerName, err)
+		if tErr := services.TransitionPayment(database.DB, paymentRecord, services.PaymentFailed, services.PaymentEvent{
+			Source: services.PaymentSourceCreate,
+			Note:   err.Error(),
+		}, nil); tErr != nil {
+			log.Printf("❌ Cập nhật giao dịch %s thất bại: %v", paymentRecord.PaymentRef, tErr)
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create payment", "provider": providerName})
 		return
 	}
 
+	// ZaloPay đổi định dạng mã giao dịch (thêm tiền tố ngày)
+	if result.OrderRef != paymentRecord.PaymentRef {
+		if err := database.DB.Model(paymentRecord).Update("PaymentRef", result.OrderRef).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payment"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"payUrl": payUrl,
+		"payUrl":      result.PayURL,
+		"orderId":     result.OrderRef,
+		"checkoutRef": checkout.CheckoutRef,
+		"provider":    providerName,
+		"quote":       quote,
 	})
 }
 
+// GetOrderQuote trả về báo giá chi tiết (giá vé, món ăn, giảm giá) do server
+// tính cho lựa chọn hiện tại của người mua.
+func GetOrderQuote(c *gin.Context) {
+	var request services.QuoteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	seatIDs, err := services.ExpandPairedSeats(database.DB, request.ShowtimeID, request.ShowtimeSeatIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load seats"})
+		return
+	}
+	request.ShowtimeSeatIDs = seatIDs
+	request.AccountID = c.GetInt("AccountID")
+
+	quote, err := services.ComputeQuote(database.DB, request)
+	if err != nil {
+		respondQuoteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"quote": quote})
+}
+
+func respondQuoteError(c *gin.Context, err error) {
+	var mismatchErr *services.PriceMismatchError
+	var conflictErr *services.SeatConflictError
+	var itemErr *services.QuoteItemError
+	switch {
+	case errors.As(err, &mismatchErr):
+		c.JSON(http.StatusConflict, gin.H{"error": mismatchErr.Error(), "diffs": mismatchErr.Diffs, "quote": mismatchErr.Quote})
+	case errors.As(err, &conflictErr):
+		c.JSON(http.StatusConflict, gin.H{"error": conflictErr.Error(), "conflicts": conflictErr.Conflicts})
+	case errors.As(err, &itemErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": itemErr.Error(), "problems": itemErr.Problems})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy suất chiếu"})
+	case errors.Is(err, services.ErrShowtimeNotBookable), errors.Is(err, services.ErrEmptyQuote):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPointsRequireLogin):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute price"})
+	}
+}
+
+// MomoIPNHandler giữ lại đường dẫn /order/momo-ipn đã đăng ký với MoMo.
+func MomoIPNHandler(c *gin.Context) {
+	provider, err := payment.Get(payment.MoMo)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	writePaymentAck(c, provider, processPaymentCallback(provider, c.Request))
+}
+
+// CreateOrderAfterPayment được front-end gọi sau khi cổng thanh toán chuyển
+// hướng về. Đơn hàng chỉ được tạo bởi callback/IPN, ở đây chỉ đọc kết quả
+// theo orderId của giao dịch.
 func CreateOrderAfterPayment(c *gin.Context) {
 	var request struct {
-		Order              models.Order       `json:"order"`
-		OrderFoods         []models.OrderFood `json:"orderFoods"`
-		ShowtimeSeatUpdate struct {
-			ShowtimeSeatIDs []int `json:"ShowtimeSeatIDs"`
-		} `json:"showtimeSeatUpdates"`
+		OrderID string `json:"orderId" form:"orderId"`
+	}
+	if err := c.ShouldBind(&request); err != nil || request.OrderID == "" {
+		request.OrderID = c.Query("orderId")
+	}
+	if request.OrderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "orderId is required"})
+		return
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+	order, err := services.FindOrderByPaymentRef(database.DB, request.OrderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order"})
+		return
+	}
+	if order == nil {
+		// IPN chưa tới hoặc thanh toán chưa thành công
+		status := services.PaymentPending
+		if p, err := services.FindPaymentByRef(database.DB, request.OrderID); err == nil && p != nil {
+			status = p.Status
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": status, "orderId": request.OrderID})
 		return
 	}
 
-	// Lưu order
-	request.Order.CreatedAt = time.Now()
-	if err := database.DB.Create(&request.Order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save order"})
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "paid",
+		"message": "Order saved successfully",
+		"orderID": order.OrderID,
+		"total":   order.Total,
+	})
+}
+
+// CancelOrder cho khách tự hủy đơn hàng theo chính sách hủy (hạn hủy, phí hủy,
+// hoàn tiền thức ăn). Người gọi là tài khoản đặt đơn, nhân viên chi nhánh hoặc
+// khách vãng lai kèm Email và Code (mã vé).
+func CancelOrder(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("OrderID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OrderID"})
 		return
 	}
 
-	// Nếu có AccountID thì cộng thêm Point = Total
-	if request.Order.AccountID != 0 {
-		if err := database.DB.Model(&models.Account{}).
-			Where("AccountID = ?", request.Order.AccountID).
-			Update("Point", gorm.Expr("Point + ?", request.Order.Total)).Error; err != nil {
-			log.Printf("❌ Cộng điểm thất bại cho Account %d: %v", request.Order.AccountID, err)
-		}
+	var body struct {
+		Reason       string `json:"Reason"`
+		RefundMethod string `json:"RefundMethod"` // original | credit
+		Email        string `json:"Email"`
+		Code         string `json:"Code"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(body.Reason) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is too long"})
+		return
 	}
 
-	// Lưu order foods
-	for _, food := range request.OrderFoods {
-		food.OrderID = request.Order.OrderID
-		if err := database.DB.Create(&food).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save order food"})
+	var order models.Order
+	if err := database.DB.First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order"})
+		return
 	}
-
-	// Update seats
-	for _, seatID := range request.ShowtimeSeatUpdate.ShowtimeSeatIDs {
-		var seat models.ShowtimeSeat
-		if err := database.DB.First(&seat, seatID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Seat not found", "seatID": seatID})
+	// Xác định người hủy: chủ đơn, nhân viên chi nhánh của suất chiếu, hoặc
+	// khách vãng lai có email và mã vé. Chỉ đọc vé, không tạo vé trước khi xác
+	// thực quyền.
+	accountID := c.GetInt("AccountID")
+	request := services.CancelRequest{
+		Reason:       body.Reason,
+		RefundMethod: body.RefundMethod,
+		CancelledBy:  c.GetString("Email"),
+		AccountID:    accountID,
+	}
+	allowed := false
+	switch {
+	case accountID != 0 && order.AccountID == accountID:
+		request.Role = services.CancelRoleCustomer
+		allowed = true
+	case accountID != 0:
+		branchID, err := services.ShowtimeBranchID(database.DB, order.ShowtimeID)
+		if err == nil {
+			allowed, err = services.CanAccessBranch(database.DB, accountID, branchID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
 			return
 		}
+		request.Role = services.CancelRoleStaff
+	}
+	if !allowed {
+		var ticket models.Ticket
+		err := database.DB.Where("OrderID = ?", orderID).First(&ticket).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get ticket"})
+			return
+		}
+		if err == nil && services.MatchesGuestOrder(order.Email, ticket.Code, body.Email, body.Code) {
+			request.Role = services.CancelRoleGuest
+			if request.CancelledBy == "" {
+				request.CancelledBy = order.Email
+			}
+			allowed = true
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Bạn không có quyền hủy đơn hàng này"})
+		return
+	}
+
+	cancellation, refund, err := services.CancelOrder(database.DB, orderID, request)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotCancellable), errors.Is(err, services.ErrTicketAlreadyUsed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrCancelWindowClosed):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidRefundMethod), errors.Is(err, services.ErrCreditRequiresAccount),
+			errors.Is(err, services.ErrCreditUnavailable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+		}
+		return
+	}
 
-		seat.Status = 2
-		seat.OrderID = request.Order.OrderID
+	// Gọi cổng thanh toán để hoàn tiền ở nền
+	if refund != nil {
+		go func(refundID int) {
+			if _, err := services.ProcessRefund(database.DB, refundID); err != nil {
+				log.Printf("❌ Hoàn tiền #%d thất bại: %v", refundID, err)
+			}
+		}(refund.RefundID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Hủy đơn hàng thành công",
+		"cancellation": cancellation,
+	})
+}
 
-		if err := database.DB.Save(&seat).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update seat"})
+// DownloadOrderTicketPDF trả về vé điện tử và hóa đơn PDF của đơn hàng cho tài
+// khoản đặt đơn, hoặc khách vãng lai kèm ?Email=&Code= (mã vé).
+func DownloadOrderTicketPDF(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("OrderID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OrderID"})
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order"})
+		return
 	}
 
-	// Gửi mail nếu là khách vãng lai
-	if request.Order.Email != "" {
-		go func(orderID int) {
-			if err := SendOrderInvoiceByID(orderID); err != nil {
-				log.Printf("❌ Gửi email thất bại cho order %d: %v", orderID, err)
-			}
-		}(request.Order.OrderID)
+	allowed, err := services.CanViewOrderDocument(database.DB, &order, c.GetInt("AccountID"), c.Query("Email"), c.Query("Code"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Bạn không có quyền xem vé của đơn hàng này"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order saved successfully"})
+	document, err := services.LoadOrderDocument(database.DB, orderID)
+	if err != nil {
+		log.Printf("❌ Không đọc được dữ liệu vé của đơn #%d: %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order document"})
+		return
+	}
+
+	pdfData, err := services.RenderOrderPDF(document)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render ticket PDF"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="ve-%d.pdf"`, orderID))
+	c.Data(http.StatusOK, "application/pdf", pdfData)
 }
 
 func SendOrderInvoiceByID(orderID int) error {
-	var order struct {
-		OrderID     int
-		Email       string
-		MovieName   string
-		TheaterName string
-		BranchName  string
-		ShowDate    string
-		StartTime   string
-		Total       int
-	}
-	if err := database.DB.
-		Table("orders o").
-		Select(`o.OrderID, o.Email, m.MovieName, t.TheaterName, 
-            b.BranchName, s.ShowDate, s.StartTime, o.Total`).
-		Joins("JOIN showtimes s ON s.ShowtimeID = o.ShowtimeID").
-		Joins("JOIN movies m ON m.MovieID = s.MovieID").
-		Joins("JOIN theaters t ON t.TheaterID = s.TheaterID").
-		Joins("JOIN branches b ON b.BranchID = t.BranchID").
-		Where("o.OrderID = ?", orderID).
-		Scan(&order).Error; err != nil {
-		return fmt.Errorf("order not found: %v", err)
+	order, err := services.LoadOrderDocument(database.DB, orderID)
+	if err != nil {
+		return err
 	}
 
 	if order.Email == "" {
 		return fmt.Errorf("no email provided")
 	}
 
-	// Lấy danh sách ghế
-	var seats []struct {
-		RowName     string
-		SeatNumber  string
-		TicketPrice int
-	}
-	if err := database.DB.Raw(`
-		SELECT 
-			ss.RowName,
-			se.SeatNumber,
-			ss.TicketPrice
-		FROM orders o
-		JOIN showtime_seats ss ON ss.OrderID = o.OrderID
-		JOIN seats se ON se.SeatID = ss.SeatID
-		WHERE o.OrderID = ?
-	`, order.OrderID).Scan(&seats).Error; err != nil {
-		return fmt.Errorf("failed to fetch seats: %v", err)
-	}
-
-	// Lấy danh sách món ăn
-	var foods []struct {
-		FoodName    string
-		Description string
-		Price       int
-		Quantity    int
-	}
-	if err := database.DB.Raw(`
-		SELECT 
-			f.FoodName,
-			f.Description,
-			f.Price,
-			ofs.Quantity
-		FROM orders o
-		JOIN order_foods ofs ON ofs.OrderID = o.OrderID
-		JOIN foods f ON f.FoodID = ofs.FoodID
-		WHERE o.OrderID = ?
-	`, order.OrderID).Scan(&foods).Error; err != nil {
-		return fmt.Errorf("failed to fetch order foods: %v", err)
-	}
-
-	// Tạo QR code
-	ticketCode := utils.GenerateTicketCode(10)
-	qrImage, err := utils.GenerateQRCode(ticketCode)
+	// Vé điện tử và hóa đơn PDF đính kèm
+	pdfData, err := services.RenderOrderPDF(order)
 	if err != nil {
-		return fmt.Errorf("failed to generate QR code")
+		return fmt.Errorf("failed to render ticket PDF: %v", err)
 	}
 
 	// HTML ghế
 	var seatHTML string
-	for _, s := range seats {
+	for _, s := range order.Seats {
 		seatHTML += fmt.Sprintf("%s%s - %dđ<br/>", s.RowName, s.SeatNumber, s.TicketPrice)
 	}
 
 	// HTML món ăn
 	var foodHTML string
-	if len(foods) > 0 {
+	if len(order.Foods) > 0 {
 		foodHTML += "<h3>🍿 Thức ăn kèm theo:</h3><ul>"
-		for _, f := range foods {
+		for _, f := range order.Foods {
 			foodHTML += fmt.Sprintf("<li>%s (%s) - %dđ x %d</li>",
-				f.FoodName, f.Description, f.Price, f.Quantity)
+				f.FoodName, f.Description, f.UnitPrice, f.Quantity)
 		}
 		foodHTML += "</ul>"
 	}
@@ -501,87 +765,16 @@ func SendOrderInvoiceByID(orderID int) error {
 		<img src="cid:ticket_qr" style="margin-top:10px;" alt="QR vé" />
 		<p style="text-align:center; font-size:18px;"><strong>%s</strong></p>
 	`, order.MovieName, order.TheaterName, order.BranchName,
-		order.ShowDate, order.StartTime, seatHTML, foodHTML, order.Total, ticketCode)
+		order.ShowDate, order.StartTime, seatHTML, foodHTML, order.Total, order.TicketCode)
 
 	// Gửi email
-	if err := services.SendInvoice(order.Email, subject, body, qrImage, "ticket_qr"); err != nil {
+	if err := services.SendInvoice(order.Email, subject, body, order.QRImage, "ticket_qr", services.EmailAttachment{
+		Filename: fmt.Sprintf("ve-%d.pdf", order.OrderID),
+		Type:     "application/pdf",
+		Content:  pdfData,
+	}); err != nil {
 		return fmt.Errorf("send email failed: %v", err)
 	}
 
 	return nil
 }
-
-// func MomoResultHandler(c *gin.Context) {
-// 	fmt.Println("MoMo IPN hit!") // hoặc dùng log.Println
-
-// 	var momoResult struct {
-// 		OrderId    string `json:"orderId"`
-// 		RequestId  string `json:"requestId"`
-// 		ResultCode int    `json:"resultCode"`
-// 		Message    string `json:"message"`
-// 		ExtraData  string `json:"extraData"`
-// 		Signature  string `json:"signature"`
-// 	}
-
-// 	if err := c.ShouldBind(&momoResult); err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid MoMo response", "details": err.Error()})
-// 		return
-// 	}
-
-// 	if momoResult.ResultCode != 0 {
-// 		c.JSON(http.StatusOK, gin.H{"message": "Thanh toán thất bại hoặc bị huỷ"})
-// 		return
-// 	}
-
-// 	// Giải mã extraData
-// 	decodedBytes, err := base64.StdEncoding.DecodeString(momoResult.ExtraData)
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode extraData"})
-// 		return
-// 	}
-
-// 	var request struct {
-// 		Order              models.Order       `json:"order"`
-// 		OrderFoods         []models.OrderFood `json:"orderFoods"`
-// 		ShowtimeSeatUpdate struct {
-// 			ShowtimeSeatIDs []int `json:"ShowtimeSeatIDs"`
-// 		} `json:"showtimeSeatUpdates"`
-// 	}
-// 	if err := json.Unmarshal(decodedBytes, &request); err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse extraData"})
-// 		return
-// 	}
-
-// 	// --- Ghi dữ liệu vào DB ---
-// 	request.Order.CreatedAt = time.Now()
-// 	if err := database.DB.Create(&request.Order).Error; err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
-// 		return
-// 	}
-
-// 	for _, food := range request.OrderFoods {
-// 		food.OrderID = request.Order.OrderID
-// 		if err := database.DB.Create(&food).Error; err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order food"})
-// 			return
-// 		}
-// 	}
-
-// 	for _, seatID := range request.ShowtimeSeatUpdate.ShowtimeSeatIDs {
-// 		var seat models.ShowtimeSeat
-// 		if err := database.DB.First(&seat, seatID).Error; err != nil {
-// 			c.JSON(http.StatusNotFound, gin.H{"error": "Seat not found", "seatID": seatID})
-// 			return
-// 		}
-// 		seat.Status = true
-// 		if err := database.DB.Save(&seat).Error; err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update seat status"})
-// 			return
-// 		}
-// 	}
-
-// 	c.JSON(http.StatusOK, gin.H{
-// 		"message": "Thanh toán thành công và đã lưu đơn hàng",
-// 		"orderID": request.Order.OrderID,
-// 	})
-// }
@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"movie-ticket-booking/database"
+	"movie-ticket-booking/models"
+	"movie-ticket-booking/payment"
+	"movie-ticket-booking/services"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// processPaymentCallback xác thực callback của cổng thanh toán, cập nhật giao
+// dịch và tạo đơn hàng nếu thanh toán thành công. Mỗi mã giao dịch chỉ tạo một
+// đơn, nên cổng gửi lại callback nhiều lần vẫn an toàn.
+func processPaymentCallback(provider payment.PaymentProvider, r *http.Request) payment.AckOutcome {
+	result, err := provider.VerifyCallback(r)
+	if err != nil {
+		log.Printf("❌ Callback %s không hợp lệ: %v", provider.Name(), err)
+		return payment.AckInvalidSignature
+	}
+
+	order, created, err := services.ApplyPaymentResult(database.DB, services.PaymentResult{
+		Provider:  provider.Name(),
+		Ref:       result.OrderRef,
+		TransID:   result.TransID,
+		Amount:    result.Amount,
+		Status:    result.Status,
+		Message:   result.Message,
+		ExtraData: result.ExtraData,
+		Raw:       result.Raw,
+		Source:    services.PaymentSourceCallback,
+	})
+	var transitionErr *services.PaymentTransitionError
+	var unfulfilled *services.UnfulfilledPaymentError
+	switch {
+	case errors.As(err, &unfulfilled):
+		// Khách đã trả tiền nhưng ghế không còn thuộc về họ hoặc không đủ điểm:
+		// hoàn tiền ở nền
+		log.Printf("❌ Callback %s %s: không tạo được đơn hàng: %v", provider.Name(), result.OrderRef, err)
+		go func(refundID int) {
+			if _, err := services.ProcessRefund(database.DB, refundID); err != nil {
+				log.Printf("❌ Hoàn tiền #%d thất bại: %v", refundID, err)
+			}
+		}(unfulfilled.RefundID)
+		return payment.AckOK
+	case errors.As(err, &transitionErr):
+		// Giao dịch đã kết thúc (ví dụ đã hoàn tiền), không có gì để làm thêm
+		log.Printf("Callback %s %s bị bỏ qua: %v", provider.Name(), result.OrderRef, err)
+		return payment.AckOK
+	case errors.Is(err, services.ErrPaymentNotFound), errors.Is(err, services.ErrInvalidQuote):
+		log.Printf("❌ Callback %s %s: %v", provider.Name(), result.OrderRef, err)
+		return payment.AckOrderNotFound
+	case errors.Is(err, services.ErrPaymentAmountMismatch):
+		log.Printf("❌ Callback %s %s: số tiền %d không khớp giao dịch", provider.Name(), result.OrderRef, result.Amount)
+		return payment.AckInvalidAmount
+	case err != nil:
+		log.Printf("❌ Callback %s %s: xử lý thất bại: %v", provider.Name(), result.OrderRef, err)
+		return payment.AckRetry
+	}
+
+	if result.Status != payment.StatusPaid {
+		log.Printf("Giao dịch %s %s thất bại: %s", provider.Name(), result.OrderRef, result.Message)
+	}
+
+	// Gửi mail nếu là khách vãng lai
+	if created && order.Email != "" {
+		go func(orderID int) {
+			if err := SendOrderInvoiceByID(orderID); err != nil {
+				log.Printf("❌ Gửi email thất bại cho order %d: %v", orderID, err)
+			}
+		}(order.OrderID)
+	}
+	return payment.AckOK
+}
+
+func writePaymentAck(c *gin.Context, provider payment.PaymentProvider, outcome payment.AckOutcome) {
+	status, body := provider.Ack(outcome)
+	if body == nil {
+		c.Status(status)
+		return
+	}
+	c.JSON(status, body)
+}
+
+// PaymentCallbackHandler nhận callback/IPN server-to-server của mọi cổng thanh
+// toán tại /payment/callback/:Provider.
+func PaymentCallbackHandler(c *gin.Context) {
+	provider, err := payment.Get(c.Param("Provider"))
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, payment.ErrProviderDisabled) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	writePaymentAck(c, provider, processPaymentCallback(provider, c.Request))
+}
+
+// FakeGatewayPay là "trang thanh toán" của cổng giả lập. Mở với
+// ?outcome=success|failure|timeout; callback được xử lý ngay trong process như
+// khi cổng thật gọi về.
+func FakeGatewayPay(c *gin.Context) {
+	provider, err := payment.Get(payment.Fake)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	gateway := payment.FakeGateway()
+
+	ref := c.Param("Ref")
+	outcome := c.DefaultQuery("outcome", payment.FakeOutcomeSuccess)
+	callback, err := gateway.Complete(ref, outcome)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := string(payment.StatusPending)
+	if callback != nil {
+		req, _ := http.NewRequest(http.MethodPost, "/payment/callback/"+payment.Fake, bytes.NewReader(callback))
+		req.Header.Set("Content-Type", "application/json")
+		ack := processPaymentCallback(provider, req)
+		if ack != payment.AckOK {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Callback processing failed", "orderId": ref})
+			return
+		}
+		status = string(payment.StatusFailed)
+		if outcome == payment.FakeOutcomeSuccess {
+			status = string(payment.StatusPaid)
+		}
+	}
+
+	if redirectURL := gateway.RedirectURL(); redirectURL != "" {
+		query := url.Values{"orderId": {ref}, "status": {status}}
+		c.Redirect(http.StatusFound, redirectURL+"?"+query.Encode())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"orderId": ref, "status": status})
+}
+
+// requirePaymentStaff chỉ cho admin và quản lý chi nhánh xem giao dịch; quản
+// lý chi nhánh chỉ thấy giao dịch của các suất chiếu tại chi nhánh mình.
+func requirePaymentStaff(c *gin.Context) (scope func(*gorm.DB) *gorm.DB, admin bool, ok bool) {
+	branchID, admin, err := services.StaffScope(database.DB, c.GetInt("AccountID"))
+	if errors.Is(err, services.ErrNotBranchStaff) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return nil, false, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permission"})
+		return nil, false, false
+	}
+	scope = func(db *gorm.DB) *gorm.DB {
+		if admin {
+			return db
+		}
+		return db.Where(`ShowtimeID IN (
+			SELECT st.ShowtimeID FROM showtimes st
+			JOIN theaters t ON t.TheaterID = st.TheaterID
+			WHERE t.BranchID = ?)`, branchID)
+	}
+	return scope, admin, true
+}
+
+// GetPayments liệt kê giao dịch thanh toán cho admin/hỗ trợ. Lọc theo Status,
+// Provider, OrderID, PaymentRef, TransID, Email; WithoutOrder=true trả về các
+// giao dịch chưa gắn đơn hàng (ví dụ: khách bị trừ tiền nhưng không có vé).
+func GetPayments(c *gin.Context) {
+	scope, _, ok := requirePaymentStaff(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.Payment{}).Scopes(scope)
+	for _, column := range []string{"Status", "Provider", "OrderID", "PaymentRef", "TransID", "Email"} {
+		if value := c.Query(column); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if c.Query("WithoutOrder") == "true" {
+		query = query.Where("OrderID IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count payments"})
+		return
+	}
+
+	var payments []models.Payment
+	if err := query.Omit("Payload").Order("CreatedAt DESC").Limit(limit).Offset(offset).Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  payments,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetPaymentDetails trả về một giao dịch kèm toàn bộ lịch sử trạng thái và dữ
+// liệu gốc cổng thanh toán đã gửi.
+func GetPaymentDetails(c *gin.Context) {
+	scope, _, ok := requirePaymentStaff(c)
+	if !ok {
+		return
+	}
+
+	paymentID, err := strconv.Atoi(c.Param("PaymentID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid PaymentID"})
+		return
+	}
+
+	var p models.Payment
+	if err := database.DB.Preload("Transitions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("PaymentTransitionID")
+	}).Scopes(scope).First(&p, paymentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment": p})
+}
+
+// GetPaymentsOfOrder trả về mọi lần thanh toán đã gắn với đơn hàng.
+func GetPaymentsOfOrder(c *gin.Context) {
+	scope, _, ok := requirePaymentStaff(c)
+	if !ok {
+		return
+	}
+
+	orderID, err := strconv.Atoi(c.Param("OrderID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OrderID"})
+		return
+	}
+
+	var payments []models.Payment
+	if err := database.DB.Preload("Transitions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("PaymentTransitionID")
+	}).Scopes(scope).Where("OrderID = ?", orderID).Order("CreatedAt").Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": payments})
+}
+
+// GetReconciliationReport trả về báo cáo đối soát đã lưu của ngày Date
+// (YYYY-MM-DD). Báo cáo gồm mọi chi nhánh nên chỉ admin được xem.
+func GetReconciliationReport(c *gin.Context) {
+	_, admin, ok := requirePaymentStaff(c)
+	if !ok {
+		return
+	}
+	if !admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Chỉ admin được xem báo cáo đối soát"})
+		return
+	}
+
+	date := c.Query("Date")
+	if date == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date is required"})
+		return
+	}
+
+	var record models.ReconciliationReport
+	if err := database.DB.Where("ReportDate = ?", date).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chưa có báo cáo đối soát cho ngày này"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get report"})
+		return
+	}
+
+	var report services.ReconciliationReport
+	if err := json.Unmarshal([]byte(record.Report), &report); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read report"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report, "issueCount": record.IssueCount, "updatedAt": record.UpdatedAt})
+}
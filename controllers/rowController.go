@@ -51,6 +51,22 @@ func AddRows(c *gin.Context) {
 		return
 	}
 
+	// Gắn hàng mới vào phiên bản sơ đồ hiện hành của phòng chiếu
+	layoutVersions := map[int]int{}
+	for i := range rows {
+		version, ok := layoutVersions[rows[i].TheaterID]
+		if !ok {
+			var theater models.Theater
+			if err := database.DB.Select("TheaterID", "LayoutVersion").First(&theater, rows[i].TheaterID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+				return
+			}
+			version = theater.LayoutVersion
+			layoutVersions[rows[i].TheaterID] = version
+		}
+		rows[i].LayoutVersion = version
+	}
+
 	// Save all rows to the database in a single transaction
 	if err := database.DB.Create(&rows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rows"})
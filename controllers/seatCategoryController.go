@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"errors"
+	"movie-ticket-booking/database"
+	"movie-ticket-booking/models"
+	"movie-ticket-booking/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func GetAllSeatCategories(c *gin.Context) {
+	var categories []models.SeatCategory
+	if err := database.DB.Order("SeatCategoryID ASC").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve seat categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": categories})
+}
+
+// AddSeatCategory tạo loại ghế dùng chung cho mọi chi nhánh, chỉ admin.
+func AddSeatCategory(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	var category models.SeatCategory
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category.Code = strings.ToLower(strings.TrimSpace(category.Code))
+	if category.Code == "" || category.CategoryName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code và CategoryName là bắt buộc"})
+		return
+	}
+	category.CreatedBy = c.GetString("Email")
+
+	if err := database.DB.Create(&category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create seat category"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": category})
+}
+
+// GetSeatCategoryPricesOfTheater trả về từng loại ghế kèm giá đã tính cho phòng chiếu.
+func GetSeatCategoryPricesOfTheater(c *gin.Context) {
+	var theater models.Theater
+	if err := database.DB.First(&theater, c.Param("TheaterID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+		return
+	}
+
+	var prices []struct {
+		SeatCategoryID int    `json:"SeatCategoryID"`
+		Code           string `json:"Code"`
+		CategoryName   string `json:"CategoryName"`
+		PriceDelta     int    `json:"PriceDelta"`
+		AbsolutePrice  *int   `json:"AbsolutePrice"`
+		Price          int    `json:"Price"`
+	}
+	if err := database.DB.Raw(`
+		SELECT sc.SeatCategoryID, sc.Code, sc.CategoryName,
+		       COALESCE(p.PriceDelta, 0) AS PriceDelta,
+		       p.AbsolutePrice,
+		       COALESCE(p.AbsolutePrice, ? + COALESCE(p.PriceDelta, 0)) AS Price
+		FROM seat_categories sc
+		LEFT JOIN theater_seat_category_prices p
+		       ON p.SeatCategoryID = sc.SeatCategoryID AND p.TheaterID = ?
+		ORDER BY sc.SeatCategoryID
+	`, theater.SeatsPrice, theater.TheaterID).Scan(&prices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve prices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"SeatsPrice": theater.SeatsPrice, "data": prices})
+}
+
+// SetSeatCategoryPrices thêm hoặc cập nhật giá các loại ghế của phòng chiếu.
+// Giá mới chỉ áp dụng cho suất chiếu được tạo ghế sau thời điểm cập nhật.
+func SetSeatCategoryPrices(c *gin.Context) {
+	theaterID, err := strconv.Atoi(c.Param("TheaterID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid TheaterID"})
+		return
+	}
+
+	// Giá loại ghế quyết định giá vé nên chỉ admin/quản lý chi nhánh được sửa
+	branchID, err := services.TheaterBranchID(database.DB, theaterID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get theater"})
+		return
+	}
+	if !requireBranchAccess(c, branchID) {
+		return
+	}
+
+	var input []struct {
+		SeatCategoryID int  `json:"SeatCategoryID" binding:"required"`
+		PriceDelta     int  `json:"PriceDelta"`
+		AbsolutePrice  *int `json:"AbsolutePrice"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email := c.GetString("Email")
+	prices := make([]models.TheaterSeatCategoryPrice, 0, len(input))
+	for _, item := range input {
+		if item.AbsolutePrice != nil && *item.AbsolutePrice < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "AbsolutePrice không được âm"})
+			return
+		}
+		prices = append(prices, models.TheaterSeatCategoryPrice{
+			TheaterID:      theaterID,
+			SeatCategoryID: item.SeatCategoryID,
+			PriceDelta:     item.PriceDelta,
+			AbsolutePrice:  item.AbsolutePrice,
+			LastUpdatedBy:  email,
+		})
+	}
+
+	if len(prices) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Danh sách giá trống"})
+		return
+	}
+
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "TheaterID"}, {Name: "SeatCategoryID"}},
+		DoUpdates: clause.AssignmentColumns([]string{"PriceDelta", "AbsolutePrice", "LastUpdatedAt", "LastUpdatedBy"}),
+	}).Create(&prices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save prices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cập nhật giá loại ghế thành công", "data": prices})
+}
+
+// AssignSeatCategory gán loại ghế cho nhiều ghế của sơ đồ phòng chiếu. Người
+// gọi phải là admin hoặc quản lý của mọi chi nhánh có ghế được gán.
+func AssignSeatCategory(c *gin.Context) {
+	var input struct {
+		SeatIDs        []int `json:"SeatIDs" binding:"required"`
+		SeatCategoryID *int  `json:"SeatCategoryID"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var branchIDs []int
+	if err := database.DB.Raw(`
+		SELECT DISTINCT t.BranchID
+		FROM seats s
+		JOIN `+"`rows`"+` r ON r.RowID = s.RowID
+		JOIN theaters t ON t.TheaterID = r.TheaterID
+		WHERE s.SeatID IN ?
+	`, input.SeatIDs).Scan(&branchIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get seats"})
+		return
+	}
+	for _, branchID := range branchIDs {
+		if !requireBranchAccess(c, branchID) {
+			return
+		}
+	}
+
+	if input.SeatCategoryID != nil {
+		var category models.SeatCategory
+		if err := database.DB.First(&category, *input.SeatCategoryID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Seat category not found"})
+			return
+		}
+	}
+
+	result := database.DB.Model(&models.Seat{}).
+		Where("SeatID IN ?", input.SeatIDs).
+		Update("SeatCategoryID", input.SeatCategoryID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update seats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cập nhật loại ghế thành công", "updated": result.RowsAffected})
+}
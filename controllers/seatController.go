@@ -1,11 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"movie-ticket-booking/database"
 	"movie-ticket-booking/models"
+	"movie-ticket-booking/services"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func AddSeats(c *gin.Context) {
@@ -22,8 +25,38 @@ func AddSeats(c *gin.Context) {
 		return
 	}
 
-	// Save the new seats to the database
-	if err := database.DB.Create(&seats).Error; err != nil {
+	// Save the new seats and link couple seats in a single transaction
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Ghế thuộc cùng phiên bản sơ đồ với hàng chứa nó
+		layoutVersions := map[int]int{}
+		for i := range seats {
+			version, ok := layoutVersions[seats[i].RowID]
+			if !ok {
+				var row models.Row
+				if err := tx.Select("RowID", "LayoutVersion").First(&row, seats[i].RowID).Error; err != nil {
+					return err
+				}
+				version = row.LayoutVersion
+				layoutVersions[seats[i].RowID] = version
+			}
+			seats[i].LayoutVersion = version
+		}
+
+		if err := tx.Create(&seats).Error; err != nil {
+			return err
+		}
+		return services.LinkSeatPairs(tx, seats)
+	})
+	if err != nil {
+		var pairErr *services.SeatPairError
+		if errors.As(err, &pairErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": pairErr.Error()})
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Row not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create seats"})
 		return
 	}
@@ -6,7 +6,9 @@ import (
 	"log"
 	"movie-ticket-booking/database"
 	"movie-ticket-booking/models"
+	"movie-ticket-booking/services"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -238,6 +240,8 @@ func GetAllShowtimesOfBranch(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": showtimes})
 }
 
+var errTheaterHasNoSeats = errors.New("Rạp chưa có sơ đồ ghế, không thể thêm suất chiếu")
+
 func AddShowtime(c *gin.Context) {
 	// Khai báo struct request
 	type CreateShowtimeRequest struct {
@@ -248,6 +252,8 @@ func AddShowtime(c *gin.Context) {
 		EndTime   string `json:"EndTime"`
 		Status    int    `json:"Status"`
 		CreatedBy string `json:"CreatedBy"`
+		// Số phút giữ ghế riêng cho suất chiếu, bỏ trống = theo chi nhánh
+		SeatHoldMinutes int `json:"SeatHoldMinutes"`
 	}
 
 	var request CreateShowtimeRequest
@@ -256,6 +262,11 @@ func AddShowtime(c *gin.Context) {
 		return
 	}
 
+	if request.SeatHoldMinutes < 0 || request.SeatHoldMinutes > 30 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SeatHoldMinutes phải nằm trong khoảng 0 - 30"})
+		return
+	}
+
 	var theater models.Theater
 	if err := database.DB.First(&theater, request.TheaterID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Không tìm thấy rạp"})
@@ -411,14 +422,37 @@ func AddShowtime(c *gin.Context) {
 		EndTime:   request.EndTime,
 		Status:    request.Status,
 		CreatedBy: request.CreatedBy,
+
+		SeatHoldMinutes: request.SeatHoldMinutes,
+		LayoutVersion:   theater.LayoutVersion,
 	}
 
-	if err := database.DB.Create(&showtime).Error; err != nil {
+	// ✅ Tạo suất chiếu và ghế của suất chiếu trong cùng một transaction
+	var seatsAdded int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&showtime).Error; err != nil {
+			return err
+		}
+		added, err := services.MaterializeShowtimeSeats(tx, showtime.ShowtimeID)
+		if err != nil {
+			return err
+		}
+		if added == 0 {
+			return errTheaterHasNoSeats
+		}
+		seatsAdded = added
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errTheaterHasNoSeats) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create showtime"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"data": showtime})
+	c.JSON(http.StatusCreated, gin.H{"data": showtime, "seatsAdded": seatsAdded})
 }
 
 func GetDetailsShowtime(c *gin.Context) {
@@ -537,26 +571,100 @@ func CancelShowtime(c *gin.Context) {
 		return
 	}
 
-	// Cập nhật Status = 2 (hủy), CancelReason, LastUpdatedAt, LastUpdatedBy
-	updateData := map[string]interface{}{
-		"Status":        2,
-		"CancelReason":  body.CancelReason,
-		"LastUpdatedAt": time.Now(),
-		"LastUpdatedBy": email,
-	}
-
-	if err := database.DB.Model(&showtime).Updates(updateData).Error; err != nil {
+	// Hủy suất chiếu (Status = 2), hủy các đơn đã bán và tạo yêu cầu hoàn tiền
+	refunds, err := services.CancelShowtimeWithRefunds(database.DB, showtime.ShowtimeID, body.CancelReason, email)
+	if err != nil {
+		if errors.Is(err, services.ErrShowtimeAlreadyCancelled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel showtime"})
 		return
 	}
 
+	// Gọi cổng thanh toán để hoàn tiền và gửi email ở nền
+	go services.ProcessShowtimeRefunds(database.DB, showtime.ShowtimeID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":         "Hủy suất chiếu thành công",
 		"cancel_reason":   body.CancelReason,
 		"last_updated_by": email,
+		"refunds":         len(refunds),
 	})
 }
 
+// GetShowtimeRefunds cho admin theo dõi tiến độ hoàn tiền của suất chiếu bị hủy.
+func GetShowtimeRefunds(c *gin.Context) {
+	showtimeID, err := strconv.Atoi(c.Param("ShowtimeID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ShowtimeID"})
+		return
+	}
+
+	progress, err := services.GetShowtimeRefundProgress(database.DB, showtimeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get refunds"})
+		return
+	}
+	c.JSON(http.StatusOK, progress)
+}
+
+// RetryShowtimeRefunds chạy lại các yêu cầu hoàn tiền chưa thành công.
+func RetryShowtimeRefunds(c *gin.Context) {
+	showtimeID, err := strconv.Atoi(c.Param("ShowtimeID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ShowtimeID"})
+		return
+	}
+
+	go services.ProcessShowtimeRefunds(database.DB, showtimeID)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Đang xử lý lại các yêu cầu hoàn tiền"})
+}
+
+func UpdateShowtimeSeatHold(c *gin.Context) {
+	var body struct {
+		SeatHoldMinutes int `json:"SeatHoldMinutes"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if body.SeatHoldMinutes < 0 || body.SeatHoldMinutes > 30 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SeatHoldMinutes phải nằm trong khoảng 0 - 30"})
+		return
+	}
+
+	var showtime models.Showtime
+	if err := database.DB.First(&showtime, c.Param("ShowtimeID")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Showtime not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find showtime"})
+		return
+	}
+
+	// Chỉ admin hoặc quản lý chi nhánh của suất chiếu được đổi thời gian giữ ghế
+	branchID, err := services.ShowtimeBranchID(database.DB, showtime.ShowtimeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find showtime"})
+		return
+	}
+	if !requireBranchAccess(c, branchID) {
+		return
+	}
+
+	if err := database.DB.Model(&showtime).Updates(map[string]interface{}{
+		"SeatHoldMinutes": body.SeatHoldMinutes,
+		"LastUpdatedBy":   c.GetString("Email"),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update showtime"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cập nhật thời gian giữ ghế thành công", "SeatHoldMinutes": body.SeatHoldMinutes})
+}
+
 func DeleteShowtime(c *gin.Context) {
 	// Get showtime ID from the URL parameter
 	id := c.Param("ShowtimeID")
@@ -1,13 +1,19 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"movie-ticket-booking/database"
 	"movie-ticket-booking/models"
+	"movie-ticket-booking/services"
 	"net/http"
 	"sort"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func GetSeatOfShowtime(c *gin.Context) {
@@ -28,6 +34,12 @@ func GetSeatOfShowtime(c *gin.Context) {
 		Status         int     `json:"Status"`
 		TicketPrice    float64 `json:"TicketPrice"`
 		Description    string  `json:"Description"`
+		SeatCategoryID *int    `json:"SeatCategoryID"`
+		CategoryCode   string  `json:"CategoryCode"`
+		CategoryName   string  `json:"CategoryName"`
+		// Ghế đôi: front-end vẽ hai ghế có cùng cặp thành một khối
+		PairSeatID         *int `json:"PairSeatID"`
+		PairShowtimeSeatID *int `json:"PairShowtimeSeatID"`
 	}
 
 	type RowData struct {
@@ -49,13 +61,22 @@ func GetSeatOfShowtime(c *gin.Context) {
         r.RowName,
         ss.Status,
         ss.TicketPrice,
-        s.Description
+        s.Description,
+        ss.SeatCategoryID,
+        COALESCE(sc.Code, '') AS CategoryCode,
+        COALESCE(sc.CategoryName, '') AS CategoryName,
+        s.PairSeatID,
+        ps.ShowtimeSeatID AS PairShowtimeSeatID
     FROM
         showtime_seats ss
     JOIN
         seats s ON ss.SeatID = s.SeatID
     JOIN
         `+"`rows`"+` r ON s.RowID = r.RowID
+    LEFT JOIN
+        seat_categories sc ON sc.SeatCategoryID = ss.SeatCategoryID
+    LEFT JOIN
+        showtime_seats ps ON ps.ShowtimeID = ss.ShowtimeID AND ps.SeatID = s.PairSeatID
     WHERE
         ss.ShowtimeID = ?
     ORDER BY
@@ -108,6 +129,12 @@ func GetSeatOfShowtime(c *gin.Context) {
 			Status:         seat.Status,
 			TicketPrice:    seat.TicketPrice,
 			Description:    seat.Description,
+			SeatCategoryID: seat.SeatCategoryID,
+			CategoryCode:   seat.CategoryCode,
+			CategoryName:   seat.CategoryName,
+
+			PairSeatID:         seat.PairSeatID,
+			PairShowtimeSeatID: seat.PairShowtimeSeatID,
 		})
 	}
 
@@ -156,6 +183,9 @@ func GetSeatOfShowtime(c *gin.Context) {
 // 	c.JSON(http.StatusOK, gin.H{"message": "Showtime seats added successfully"})
 // }
 
+// AddShowtimeSeats giữ lại cho client cũ: ghế đã được tạo cùng suất chiếu
+// trong AddShowtime, ở đây chỉ bổ sung ghế còn thiếu và luôn dùng phòng chiếu
+// của chính suất chiếu.
 func AddShowtimeSeats(c *gin.Context) {
 	showtimeID := c.Param("ShowtimeID")
 	theaterID := c.Param("TheaterID")
@@ -165,23 +195,28 @@ func AddShowtimeSeats(c *gin.Context) {
 		return
 	}
 
-	query := `
-		INSERT INTO showtime_seats (ShowtimeID, SeatID, RowName, Status, TicketPrice)
-		SELECT ?, s.SeatID, r.RowName, 0, t.SeatsPrice
-		FROM seats s
-		JOIN ` + "`rows`" + ` r ON s.RowID = r.RowID
-		JOIN theaters t ON t.TheaterID = r.TheaterID
-		WHERE r.TheaterID = ?
-		  AND s.isOld = 0
-		  AND r.isOld = 0;
-	`
+	var showtime models.Showtime
+	if err := database.DB.First(&showtime, showtimeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Showtime not found"})
+		return
+	}
+	if strconv.Itoa(showtime.TheaterID) != theaterID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "TheaterID không khớp với phòng chiếu của suất chiếu"})
+		return
+	}
 
-	if err := database.DB.Exec(query, showtimeID, theaterID).Error; err != nil {
+	var added int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		added, err = services.MaterializeShowtimeSeats(tx, showtime.ShowtimeID)
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Showtime seats added successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Showtime seats added successfully", "seatsAdded": added})
 }
 
 func DeleteShowtimeSeats(c *gin.Context) {
@@ -216,3 +251,209 @@ func DeleteShowtimeSeats(c *gin.Context) {
 	// Phản hồi khi xóa thành công
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted successfully", "deleted_rows": result.RowsAffected})
 }
+
+type holdSeatsRequest struct {
+	ShowtimeID      int   `json:"ShowtimeID" binding:"required"`
+	ShowtimeSeatIDs []int `json:"ShowtimeSeatIDs" binding:"required"`
+}
+
+// holdOwnerFromContext lấy người giữ ghế: AccountID nếu đã đăng nhập,
+// ngược lại là X-Hold-Token của khách vãng lai.
+func holdOwnerFromContext(c *gin.Context) services.HoldOwner {
+	return services.HoldOwner{
+		AccountID: c.GetInt("AccountID"),
+		HoldToken: c.GetHeader("X-Hold-Token"),
+	}
+}
+
+func HoldShowtimeSeats(c *gin.Context) {
+	var request holdSeatsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var showtime models.Showtime
+	if err := database.DB.First(&showtime, request.ShowtimeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy suất chiếu"})
+		return
+	}
+	if showtime.Status != 1 || !showtime.IsOpenOrder {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Suất chiếu chưa mở hoặc đã đóng đặt vé"})
+		return
+	}
+
+	// Khách vãng lai giữ ghế lần đầu sẽ được cấp HoldToken mới
+	owner := holdOwnerFromContext(c)
+	if owner.AccountID == 0 && owner.HoldToken == "" {
+		owner.HoldToken = uuid.NewString()
+	}
+
+	held, err := services.HoldSeats(database.DB, owner, request.ShowtimeID, request.ShowtimeSeatIDs)
+	if err != nil {
+		var conflictErr *services.SeatConflictError
+		if errors.As(err, &conflictErr) {
+			c.JSON(http.StatusConflict, gin.H{"error": conflictErr.Error(), "conflicts": conflictErr.Conflicts})
+			return
+		}
+		var orphanErr *services.OrphanSeatError
+		if errors.As(err, &orphanErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": orphanErr.Error(), "orphanSeats": orphanErr.Seats})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"message":         "Giữ ghế thành công",
+		"ShowtimeSeatIDs": held.ShowtimeSeatIDs,
+		"HoldExpiresAt":   held.HoldExpiresAt,
+	}
+	if owner.AccountID == 0 {
+		response["HoldToken"] = owner.HoldToken
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func ReleaseShowtimeSeats(c *gin.Context) {
+	var request holdSeatsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner := holdOwnerFromContext(c)
+	if owner.AccountID == 0 && owner.HoldToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing X-Hold-Token"})
+		return
+	}
+
+	released, err := services.ReleaseSeats(database.DB, owner, request.ShowtimeID, request.ShowtimeSeatIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release seats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã trả ghế", "released": released})
+}
+
+func ExtendShowtimeSeatHold(c *gin.Context) {
+	var request struct {
+		ShowtimeID int `json:"ShowtimeID" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner := holdOwnerFromContext(c)
+	if owner.AccountID == 0 && owner.HoldToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing X-Hold-Token"})
+		return
+	}
+
+	expiresAt, err := services.ExtendHold(database.DB, owner, request.ShowtimeID)
+	if err != nil {
+		if errors.Is(err, services.ErrHoldNotExtendable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to extend hold"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã gia hạn giữ ghế", "HoldExpiresAt": expiresAt})
+}
+
+// ReleaseAllShowtimeSeatHolds trả toàn bộ ghế đang giữ của người dùng trong
+// một suất chiếu, hoặc mọi suất chiếu khi không truyền ShowtimeID (đăng xuất).
+func ReleaseAllShowtimeSeatHolds(c *gin.Context) {
+	// Body rỗng được chấp nhận
+	var request struct {
+		ShowtimeID int `json:"ShowtimeID"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner := holdOwnerFromContext(c)
+	if owner.AccountID == 0 && owner.HoldToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing X-Hold-Token"})
+		return
+	}
+
+	released, err := services.ReleaseAllHolds(database.DB, owner, request.ShowtimeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release seats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã trả ghế", "released": released})
+}
+
+func GetBestAvailableSeats(c *gin.Context) {
+	showtimeID, err := strconv.Atoi(c.Query("ShowtimeID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ShowtimeID"})
+		return
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", "1"))
+	if err != nil || count < 1 || count > services.MaxSeatsPerHold {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("count phải nằm trong khoảng 1 - %d", services.MaxSeatsPerHold)})
+		return
+	}
+
+	cells, err := services.LoadShowtimeSeatGrid(database.DB, showtimeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	preventOrphans, err := services.PreventOrphanSeatsEnabled(database.DB, showtimeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := services.FindBestSeats(cells, count, preventOrphans)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// GetShowtimeSeatMap vẽ sơ đồ ghế của suất chiếu kèm trạng thái ghế,
+// ?format=svg|ascii.
+func GetShowtimeSeatMap(c *gin.Context) {
+	showtimeID, err := strconv.Atoi(c.Query("ShowtimeID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ShowtimeID"})
+		return
+	}
+
+	var showtime models.Showtime
+	if err := database.DB.Preload("Movie").Preload("Theater").First(&showtime, showtimeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Showtime not found"})
+		return
+	}
+
+	title := fmt.Sprintf("%s %s", showtime.ShowDate, showtime.StartTime)
+	if showtime.Movie != nil {
+		title = showtime.Movie.MovieName + " - " + title
+	}
+	if showtime.Theater != nil {
+		title += " - " + showtime.Theater.TheaterName
+	}
+
+	seatMap, err := services.LoadShowtimeSeatMap(database.DB, showtime.ShowtimeID, title)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	renderSeatMap(c, seatMap)
+}
@@ -1,10 +1,16 @@
 package controllers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"movie-ticket-booking/database"
 	"movie-ticket-booking/models"
+	"movie-ticket-booking/services"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -51,13 +57,15 @@ func GetSeatsOfTheater(c *gin.Context) {
 	}
 
 	type SeatData struct {
-		SeatID      int    `json:"SeatID"`
-		SeatNumber  int    `json:"SeatNumber"`
-		Area        int    `json:"Area"`
-		Column      int    `json:"Column"`
-		Row         int    `json:"Row"`
-		RowName     string `json:"RowName"`
-		Description string `json:"Description"`
+		SeatID         int    `json:"SeatID"`
+		SeatNumber     int    `json:"SeatNumber"`
+		Area           int    `json:"Area"`
+		Column         int    `json:"Column"`
+		Row            int    `json:"Row"`
+		RowName        string `json:"RowName"`
+		Description    string `json:"Description"`
+		SeatCategoryID *int   `json:"SeatCategoryID"`
+		PairSeatID     *int   `json:"PairSeatID"`
 	}
 
 	type RowData struct {
@@ -67,14 +75,16 @@ func GetSeatsOfTheater(c *gin.Context) {
 	}
 
 	var seatData []struct {
-		SeatID      int    `json:"SeatID"`
-		RowName     string `json:"RowName"`
-		RowID       int    `json:"RowID"`
-		SeatNumber  int    `json:"SeatNumber"`
-		Area        int    `json:"Area"`
-		Column      int    `json:"Column"`
-		Row         int    `json:"Row"`
-		Description string `json:"Description"`
+		SeatID         int    `json:"SeatID"`
+		RowName        string `json:"RowName"`
+		RowID          int    `json:"RowID"`
+		SeatNumber     int    `json:"SeatNumber"`
+		Area           int    `json:"Area"`
+		Column         int    `json:"Column"`
+		Row            int    `json:"Row"`
+		Description    string `json:"Description"`
+		SeatCategoryID *int   `json:"SeatCategoryID"`
+		PairSeatID     *int   `json:"PairSeatID"`
 	}
 
 	// Chỉ lấy rows và seats có isOld = 0
@@ -119,13 +129,15 @@ func GetSeatsOfTheater(c *gin.Context) {
 			}
 		}
 		rowMap[seat.RowName].Seats = append(rowMap[seat.RowName].Seats, SeatData{
-			SeatID:      seat.SeatID,
-			SeatNumber:  seat.SeatNumber,
-			Area:        seat.Area,
-			Column:      seat.Column,
-			Row:         seat.Row,
-			RowName:     seat.RowName,
-			Description: seat.Description,
+			SeatID:         seat.SeatID,
+			SeatNumber:     seat.SeatNumber,
+			Area:           seat.Area,
+			Column:         seat.Column,
+			Row:            seat.Row,
+			RowName:        seat.RowName,
+			Description:    seat.Description,
+			SeatCategoryID: seat.SeatCategoryID,
+			PairSeatID:     seat.PairSeatID,
 		})
 	}
 
@@ -283,6 +295,7 @@ func AddTheater(c *gin.Context) {
 	// Set timestamps
 	theater.CreatedAt = time.Now()
 	theater.LastUpdatedAt = time.Now()
+	theater.LayoutVersion = 1
 
 	if err := database.DisableForeignKeyChecks(database.DB, c); err != nil {
 		return
@@ -391,25 +404,11 @@ func MarkRowsAndSeatsOld(c *gin.Context) {
 	}
 
 	// Bắt đầu transaction để cập nhật isOld
+	var layoutVersion int
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		// 1️⃣ Cập nhật seats thuộc các row của theater này
-		if err := tx.Exec(`
-            UPDATE seats s
-            JOIN `+"`rows`"+` r ON s.RowID = r.RowID
-            SET s.isOld = 1
-            WHERE r.TheaterID = ? AND s.isOld = 0
-        `, theaterID).Error; err != nil {
-			return err
-		}
-
-		// 2️⃣ Cập nhật rows của theater
-		if err := tx.Model(&models.Row{}).
-			Where("TheaterID = ? AND isOld = 0", theaterID).
-			Update("isOld", 1).Error; err != nil {
-			return err
-		}
-
-		return nil
+		var err error
+		layoutVersion, err = services.RetireCurrentLayout(tx, theater.TheaterID)
+		return err
 	})
 
 	if err != nil {
@@ -418,8 +417,9 @@ func MarkRowsAndSeatsOld(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"TheaterID": theater.TheaterID,
-		"message":   "Marked all rows and seats as old successfully",
+		"TheaterID":     theater.TheaterID,
+		"LayoutVersion": layoutVersion,
+		"message":       "Marked all rows and seats as old successfully",
 	})
 }
 
@@ -449,3 +449,226 @@ func ChangeTheaterStatus(c *gin.Context) {
 		"Status":    theater.Status,
 	})
 }
+
+func GetLayoutVersions(c *gin.Context) {
+	theaterID := c.Param("TheaterID")
+
+	var theater models.Theater
+	if err := database.DB.First(&theater, "TheaterID = ?", theaterID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+		return
+	}
+
+	versions, err := services.ListLayoutVersions(database.DB, theater.TheaterID, theater.LayoutVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get layout versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"TheaterID":     theater.TheaterID,
+		"LayoutVersion": theater.LayoutVersion,
+		"data":          versions,
+	})
+}
+
+// GetLayoutDiff so sánh hai phiên bản sơ đồ ghế (?from=&to=), mặc định là
+// phiên bản liền trước với phiên bản hiện hành.
+func GetLayoutDiff(c *gin.Context) {
+	theaterID := c.Param("TheaterID")
+
+	var theater models.Theater
+	if err := database.DB.First(&theater, "TheaterID = ?", theaterID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+		return
+	}
+
+	from, err := strconv.Atoi(c.DefaultQuery("from", strconv.Itoa(theater.LayoutVersion-1)))
+	if err != nil || from < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from version"})
+		return
+	}
+	to, err := strconv.Atoi(c.DefaultQuery("to", strconv.Itoa(theater.LayoutVersion)))
+	if err != nil || to < 1 || to > theater.LayoutVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to version"})
+		return
+	}
+
+	fromSeats, err := services.LoadLayoutSeats(database.DB, theater.TheaterID, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load layout"})
+		return
+	}
+	toSeats, err := services.LoadLayoutSeats(database.DB, theater.TheaterID, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load layout"})
+		return
+	}
+
+	diff := services.DiffLayouts(fromSeats, toSeats)
+	diff.FromVersion = from
+	diff.ToVersion = to
+
+	c.JSON(http.StatusOK, gin.H{"data": diff})
+}
+
+// MigrateShowtimesToCurrentLayout chuyển ghế của các suất chiếu sắp tới sang
+// sơ đồ hiện hành. Vé đã bán mà ghế không còn tồn tại được trả về để xếp lại.
+func MigrateShowtimesToCurrentLayout(c *gin.Context) {
+	theaterID := c.Param("TheaterID")
+
+	var theater models.Theater
+	if err := database.DB.First(&theater, "TheaterID = ?", theaterID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+		return
+	}
+
+	report, err := services.MigrateFutureShowtimes(database.DB, theater.TheaterID, theater.LayoutVersion)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptyLayout) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "data": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Migrated future showtimes to current layout",
+		"data":    report,
+	})
+}
+
+func GetSoldSeatsMissingFromLayout(c *gin.Context) {
+	theaterID := c.Param("TheaterID")
+
+	var theater models.Theater
+	if err := database.DB.First(&theater, "TheaterID = ?", theaterID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+		return
+	}
+
+	issues, err := services.FindSoldSeatsMissingFromLayout(database.DB, theater.TheaterID, theater.LayoutVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sold seats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": issues})
+}
+
+// ExportTheaterLayout xuất sơ đồ ghế hiện hành, ?format=csv để lấy dạng lưới.
+func ExportTheaterLayout(c *gin.Context) {
+	theaterID := c.Param("TheaterID")
+
+	var theater models.Theater
+	if err := database.DB.First(&theater, "TheaterID = ?", theaterID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+		return
+	}
+
+	layout, err := services.ExportLayout(database.DB, theater)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export layout"})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		var buf bytes.Buffer
+		if err := services.WriteLayoutCSV(&buf, layout); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-layout.csv"`, theater.Slug))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, layout)
+}
+
+// ImportTheaterLayout nhập sơ đồ ghế (JSON, hoặc CSV khi Content-Type là
+// text/csv hay ?format=csv) thành phiên bản sơ đồ mới của phòng chiếu.
+func ImportTheaterLayout(c *gin.Context) {
+	theaterID := c.Param("TheaterID")
+
+	var theater models.Theater
+	if err := database.DB.First(&theater, "TheaterID = ?", theaterID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+		return
+	}
+
+	var layout *services.LayoutFile
+	if c.Query("format") == "csv" || strings.HasPrefix(c.ContentType(), "text/csv") {
+		parsed, err := services.ReadLayoutCSV(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		layout = parsed
+	} else {
+		layout = &services.LayoutFile{}
+		if err := c.ShouldBindJSON(layout); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var layoutVersion int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		layoutVersion, err = services.ImportLayout(tx, theater, layout)
+		return err
+	})
+	if err != nil {
+		var validationErr *services.LayoutValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Sơ đồ ghế không hợp lệ", "problems": validationErr.Problems})
+			return
+		}
+		var pairErr *services.SeatPairError
+		if errors.As(err, &pairErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": pairErr.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import layout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"TheaterID":     theater.TheaterID,
+		"LayoutVersion": layoutVersion,
+		"message":       "Imported layout successfully",
+	})
+}
+
+// GetTheaterSeatMap vẽ sơ đồ ghế hiện hành của phòng chiếu, ?format=svg|ascii.
+func GetTheaterSeatMap(c *gin.Context) {
+	theaterID := c.Param("TheaterID")
+
+	var theater models.Theater
+	if err := database.DB.First(&theater, "TheaterID = ?", theaterID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Theater not found"})
+		return
+	}
+
+	seatMap, err := services.LoadTheaterSeatMap(database.DB, theater.TheaterID, theater.TheaterName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	renderSeatMap(c, seatMap)
+}
+
+// renderSeatMap trả sơ đồ ghế theo ?format: svg (mặc định) hoặc ascii.
+func renderSeatMap(c *gin.Context, seatMap *services.SeatMap) {
+	switch c.DefaultQuery("format", "svg") {
+	case "svg":
+		c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", []byte(services.RenderSeatMapSVG(seatMap)))
+	case "ascii":
+		c.String(http.StatusOK, services.RenderSeatMapASCII(seatMap))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format phải là svg hoặc ascii"})
+	}
+}
@@ -8,6 +8,9 @@ import (
 )
 
 func AutoMigrate(db *gorm.DB) {
+	legacyRows := db.Migrator().HasTable(&models.Row{}) && !db.Migrator().HasColumn(&models.Row{}, "LayoutVersion")
+	legacySeats := db.Migrator().HasTable(&models.Seat{}) && !db.Migrator().HasColumn(&models.Seat{}, "LayoutVersion")
+
 	err := db.AutoMigrate(
 		&models.Order{},
 		&models.Account{},
@@ -18,8 +21,35 @@ func AutoMigrate(db *gorm.DB) {
 		&models.Theater{},
 		&models.Branch{},
 		&models.Movie{},
+		&models.ShowtimeSeat{},
+		&models.SeatCategory{},
+		&models.TheaterSeatCategoryPrice{},
+		&models.Payment{},
+		&models.PaymentTransition{},
+		&models.Refund{},
+		&models.IdempotencyKey{},
+		&models.ReconciliationReport{},
+		&models.PendingCheckout{},
+		&models.Ticket{},
+		&models.BranchTicketKey{},
+		&models.TicketScan{},
+		&models.OrderCancellation{},
 	)
 	if err != nil {
 		log.Fatalf("Error during auto-migration: %v", err)
 	}
+
+	// Cột LayoutVersion vừa được thêm thì mọi hàng/ghế nhận mặc định 1. Hàng/ghế
+	// đã isOld thuộc các sơ đồ trước khi có phiên bản nên chuyển sang 0 để không
+	// trùng tên ghế với sơ đồ hiện hành (phiên bản 1).
+	if legacyRows {
+		if err := db.Exec("UPDATE `rows` SET LayoutVersion = 0 WHERE isOld = 1").Error; err != nil {
+			log.Fatalf("Error backfilling rows.LayoutVersion: %v", err)
+		}
+	}
+	if legacySeats {
+		if err := db.Exec("UPDATE seats SET LayoutVersion = 0 WHERE isOld = 1").Error; err != nil {
+			log.Fatalf("Error backfilling seats.LayoutVersion: %v", err)
+		}
+	}
 }
@@ -28,7 +28,7 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     origins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Hold-Token", "Idempotency-Key"},
 		AllowCredentials: true,
 	}))
 
@@ -43,12 +43,14 @@ func main() {
 	routes.TheaterRoutes(router)
 	routes.RowRoutes(router)
 	routes.SeatRoutes(router)
+	routes.SeatCategoryRoutes(router)
 	routes.ShowtimeRoutes(router)
 	routes.AccountRoutes(router)
 	routes.ShowtimeSeatRoutes(router)
 	routes.OrderRoutes(router)
+	routes.PaymentRoutes(router)
+	routes.CheckinRoutes(router)
 	routes.FoodRoutes(router)
-	routes.OrderFoodRoutes(router)
 	routes.MessageRoutes(router)
 	routes.AdminDashboardRoutes(router)
 	routes.ChatbotRoutes(router)
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"movie-ticket-booking/database"
+	"movie-ticket-booking/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	IdempotencyHeader    = "Idempotency-Key"
+	idempotencyReplayed  = "Idempotent-Replayed"
+	idempotencyTTL       = 24 * time.Hour
+	idempotencyLockTTL   = 60 * time.Second // request chưa xong sau thời gian này coi như đã bỏ dở
+	maxIdempotencyKeyLen = 128
+)
+
+// idempotencyWriter ghi lại body phản hồi để lưu cùng Idempotency-Key.
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyScope xác định người gọi: tài khoản nếu có token hợp lệ, ngược lại
+// là token giữ ghế của khách vãng lai hoặc IP.
+func idempotencyScope(c *gin.Context) string {
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if tokenString != "" {
+		if claims, ok := parseToken(tokenString); ok {
+			return "account:" + strconv.Itoa(claims.AccountID)
+		}
+	}
+	if holdToken := c.GetHeader("X-Hold-Token"); holdToken != "" {
+		return "guest:" + holdToken
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// Idempotency hỗ trợ header Idempotency-Key cho các request thay đổi dữ liệu.
+// Lần đầu request chạy bình thường và phản hồi được lưu theo (người gọi, key);
+// các lần sau cùng key và cùng nội dung nhận lại phản hồi đã lưu mà không chạy
+// lại handler. Cùng key nhưng khác nội dung trả về 422, request trước còn đang
+// chạy trả về 409. Phản hồi lỗi 5xx không được lưu để client có thể thử lại;
+// key chưa hoàn tất quá idempotencyLockTTL (process dừng, timeout) được request
+// sau tiếp quản.
+func Idempotency(c *gin.Context) {
+	key := c.GetHeader(IdempotencyHeader)
+	if key == "" || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key quá dài"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "?" + c.Request.URL.RawQuery + "\n"))
+	hash.Write(body)
+
+	record := models.IdempotencyKey{
+		Scope:       idempotencyScope(c),
+		Key:         key,
+		Method:      c.Request.Method,
+		Path:        c.Request.URL.Path,
+		RequestHash: hex.EncodeToString(hash.Sum(nil)),
+		ExpiresAt:   time.Now().Add(idempotencyTTL),
+	}
+
+	// Key hết hạn hoặc request trước bỏ dở được coi như chưa dùng
+	now := time.Now()
+	database.DB.Where("Scope = ? AND `Key` = ?", record.Scope, key).
+		Where("ExpiresAt < ? OR (Completed = ? AND CreatedAt < ?)", now, false, now.Add(-idempotencyLockTTL)).
+		Delete(&models.IdempotencyKey{})
+
+	res := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if res.Error != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to save idempotency key"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		replayIdempotentResponse(c, record)
+		return
+	}
+
+	writer := &idempotencyWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+
+	status := writer.Status()
+	if status >= http.StatusInternalServerError {
+		database.DB.Delete(&record)
+		return
+	}
+	if err := database.DB.Model(&record).Updates(map[string]interface{}{
+		"Completed":    true,
+		"StatusCode":   status,
+		"ContentType":  writer.Header().Get("Content-Type"),
+		"ResponseBody": writer.body.String(),
+	}).Error; err != nil {
+		log.Printf("❌ Không lưu được phản hồi cho Idempotency-Key %s: %v", key, err)
+	}
+}
+
+func replayIdempotentResponse(c *gin.Context, record models.IdempotencyKey) {
+	var existing models.IdempotencyKey
+	if err := database.DB.Where("Scope = ? AND `Key` = ?", record.Scope, record.Key).First(&existing).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load idempotency key"})
+		return
+	}
+
+	if existing.RequestHash != record.RequestHash {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key đã được dùng cho một request khác"})
+		return
+	}
+	if !existing.Completed {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Request với Idempotency-Key này đang được xử lý"})
+		return
+	}
+
+	c.Header(idempotencyReplayed, "true")
+	contentType := existing.ContentType
+	if contentType == "" {
+		contentType = "application/json; charset=utf-8"
+	}
+	c.Data(existing.StatusCode, contentType, []byte(existing.ResponseBody))
+	c.Abort()
+}
@@ -32,6 +32,37 @@ func RequireLogin(c *gin.Context) {
 	}
 
 	// Parse token và kiểm tra tính hợp lệ
+	claims, ok := parseToken(tokenString)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+
+	// Lưu thông tin người dùng vào context nếu token hợp lệ
+	c.Set("AccountID", claims.AccountID)
+	c.Set("Email", claims.Email)
+
+	// Tiếp tục với request
+	c.Next()
+}
+
+// OptionalLogin giống RequireLogin nhưng cho phép khách vãng lai đi tiếp.
+// Nếu có token hợp lệ thì AccountID và Email được gán vào context.
+func OptionalLogin(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if authHeader != "" && tokenString != authHeader {
+		if claims, ok := parseToken(tokenString); ok {
+			c.Set("AccountID", claims.AccountID)
+			c.Set("Email", claims.Email)
+		}
+	}
+
+	c.Next()
+}
+
+func parseToken(tokenString string) (*Claims, bool) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Kiểm tra phương thức ký của token (HS256)
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -39,19 +70,10 @@ func RequireLogin(c *gin.Context) {
 		}
 		return config.GetJWTKey(), nil
 	})
-
 	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		c.Abort()
-		return
+		return nil, false
 	}
 
-	// Lưu thông tin người dùng vào context nếu token hợp lệ
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		c.Set("AccountID", claims.AccountID)
-		c.Set("Email", claims.Email)
-	}
-
-	// Tiếp tục với request
-	c.Next()
+	claims, ok := token.Claims.(*Claims)
+	return claims, ok
 }
@@ -15,4 +15,9 @@ type Branch struct {
 	LastUpdatedAt time.Time `gorm:"autoUpdateTime;column:LastUpdatedAt"`
 	CreatedBy     string    `gorm:"size:100;not null;column:CreatedBy"`
 	LastUpdatedBy string    `gorm:"size:100;not null;column:LastUpdatedBy"`
+
+	// Cấu hình đặt vé của chi nhánh
+	SeatHoldMinutes    int    `gorm:"not null;default:0;column:SeatHoldMinutes"`        // 0 = dùng SEAT_HOLD_MINUTES
+	PreventOrphanSeats bool   `gorm:"not null;default:false;column:PreventOrphanSeats"` // chặn chọn ghế để lại ghế trống đơn lẻ
+	PaymentProvider    string `gorm:"size:20;column:PaymentProvider"`                   // rỗng = PAYMENT_DEFAULT_PROVIDER
 }
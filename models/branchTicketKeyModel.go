@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// BranchTicketKey là khóa ký QR vé của chi nhánh. Mỗi chi nhánh có một khóa
+// active dùng để ký; khóa đã xoay (retired) vẫn được dùng để xác thực đến
+// VerifyUntil.
+type BranchTicketKey struct {
+	BranchTicketKeyID int        `gorm:"primaryKey;autoIncrement;column:BranchTicketKeyID"`
+	BranchID          int        `gorm:"not null;index;column:BranchID"`
+	KeyID             string     `gorm:"size:16;not null;uniqueIndex;column:KeyID"`
+	Secret            string     `gorm:"size:64;not null;column:Secret" json:"-"` // base64
+	Status            string     `gorm:"size:10;not null;column:Status"`          // active | retired
+	VerifyUntil       *time.Time `gorm:"column:VerifyUntil;default:null"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime;column:CreatedAt"`
+	CreatedBy         string     `gorm:"size:100;column:CreatedBy"`
+	RetiredAt         *time.Time `gorm:"column:RetiredAt;default:null"`
+}
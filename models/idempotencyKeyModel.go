@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IdempotencyKey lưu phản hồi của một request có header Idempotency-Key để
+// request lặp lại (double-click, retry) nhận lại đúng phản hồi cũ.
+type IdempotencyKey struct {
+	IdempotencyKeyID int       `gorm:"primaryKey;autoIncrement;column:IdempotencyKeyID"`
+	Scope            string    `gorm:"size:100;not null;uniqueIndex:idx_idempotency_scope_key;column:Scope"` // người gọi: account:<id> hoặc guest:<token/ip>
+	Key              string    `gorm:"size:128;not null;uniqueIndex:idx_idempotency_scope_key;column:Key"`
+	Method           string    `gorm:"size:10;not null;column:Method"`
+	Path             string    `gorm:"size:255;not null;column:Path"`
+	RequestHash      string    `gorm:"size:64;not null;column:RequestHash"`
+	Completed        bool      `gorm:"not null;default:false;column:Completed"`
+	StatusCode       int       `gorm:"column:StatusCode"`
+	ContentType      string    `gorm:"size:100;column:ContentType"`
+	ResponseBody     string    `gorm:"type:mediumtext;column:ResponseBody"`
+	CreatedAt        time.Time `gorm:"autoCreateTime;column:CreatedAt"`
+	ExpiresAt        time.Time `gorm:"index;column:ExpiresAt"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// OrderCancellation ghi lại một lần hủy đơn hàng theo yêu cầu: ai hủy, lý do,
+// phí hủy theo chính sách và số tiền hoàn (qua cổng thanh toán hoặc điểm).
+type OrderCancellation struct {
+	OrderCancellationID int       `gorm:"primaryKey;autoIncrement;column:OrderCancellationID"`
+	OrderID             int       `gorm:"not null;uniqueIndex;column:OrderID"`
+	ShowtimeID          int       `gorm:"not null;index;column:ShowtimeID"`
+	CancelledBy         string    `gorm:"size:100;not null;column:CancelledBy"` // email người hủy
+	CancelledByAccount  *int      `gorm:"column:CancelledByAccount;default:null"`
+	Role                string    `gorm:"size:10;not null;column:Role"` // customer | guest | staff
+	Reason              string    `gorm:"size:255;column:Reason"`
+	HoursBefore         float64   `gorm:"not null;column:HoursBefore"` // số giờ còn lại đến giờ chiếu khi hủy
+	PaidAmount          int       `gorm:"not null;column:PaidAmount"`
+	FoodAmount          int       `gorm:"not null;default:0;column:FoodAmount"` // tiền thức ăn không được hoàn
+	FeePercent          int       `gorm:"not null;default:0;column:FeePercent"`
+	FeeAmount           int       `gorm:"not null;default:0;column:FeeAmount"`
+	RefundAmount        int       `gorm:"not null;default:0;column:RefundAmount"`
+	RefundMethod        string    `gorm:"size:10;not null;column:RefundMethod"` // original | credit | none
+	RefundID            *int      `gorm:"column:RefundID;default:null"`
+	PointsCredited      int       `gorm:"not null;default:0;column:PointsCredited"` // điểm cộng khi hoàn bằng điểm
+	PointsReversed      int       `gorm:"not null;default:0;column:PointsReversed"`
+	PointsRestored      int       `gorm:"not null;default:0;column:PointsRestored"` // điểm khách đã dùng được trả lại
+	Seats               string    `gorm:"size:255;column:Seats"`
+	CreatedAt           time.Time `gorm:"autoCreateTime;column:CreatedAt"`
+}
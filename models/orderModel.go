@@ -26,4 +26,13 @@ type Order struct {
 	Total      int         `gorm:"column:Total;not null"`
 	CreatedAt  time.Time   `gorm:"column:CreatedAt;autoCreateTime"`
 	OrderFoods []OrderFood `json:"OrderFoods" gorm:"foreignKey:OrderID"`
+
+	PaymentProvider string `gorm:"column:PaymentProvider;size:20;default:null"`
+	PaymentRef      string `gorm:"column:PaymentRef;size:64;uniqueIndex;default:null"` // orderId gửi sang cổng thanh toán
+	PaymentTransID  string `gorm:"column:PaymentTransID;size:64;default:null"`         // mã giao dịch của cổng thanh toán
+
+	Status string `gorm:"column:Status;size:20;not null;default:paid"` // paid | refunded | cancelled
+
+	PointsUsed   int `gorm:"column:PointsUsed;not null;default:0"`   // điểm đã dùng để trả một phần đơn
+	PointsEarned int `gorm:"column:PointsEarned;not null;default:0"` // điểm được cộng khi mua
 }
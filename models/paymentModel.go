@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Payment là một lần thanh toán qua cổng thanh toán. Mỗi lần tạo thanh toán
+// là một Payment mới; OrderID chỉ có khi thanh toán thành công và đã tạo đơn.
+type Payment struct {
+	PaymentID      int       `gorm:"primaryKey;autoIncrement;column:PaymentID"`
+	OrderID        *int      `gorm:"index;column:OrderID;default:null"`
+	ShowtimeID     int       `gorm:"not null;index;column:ShowtimeID"`
+	AccountID      int       `gorm:"index;column:AccountID;default:null"`
+	Email          string    `gorm:"size:100;index;column:Email;default:null"`
+	Provider       string    `gorm:"size:20;not null;column:Provider"`
+	PaymentRef     string    `gorm:"size:64;not null;uniqueIndex;column:PaymentRef"` // mã giao dịch gửi sang cổng
+	TransID        string    `gorm:"size:64;index;column:TransID;default:null"`      // mã giao dịch của cổng
+	Amount         int       `gorm:"not null;column:Amount"`
+	RefundedAmount int       `gorm:"not null;default:0;column:RefundedAmount"`
+	Status         string    `gorm:"size:24;not null;index;column:Status"`
+	Payload        string    `gorm:"type:mediumtext;column:Payload"` // CheckoutPayload của giao dịch cũ, giao dịch mới dùng CheckoutID
+	CreatedAt      time.Time `gorm:"autoCreateTime;column:CreatedAt"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime;column:UpdatedAt"`
+
+	PointsUsed int `gorm:"not null;default:0;column:PointsUsed"` // điểm đã trừ khi tạo giao dịch, hoàn lại nếu thất bại
+
+	CheckoutID *int `gorm:"index;column:CheckoutID;default:null"` // pending_checkouts chứa dữ liệu đơn hàng
+
+	Transitions []PaymentTransition `json:"Transitions,omitempty" gorm:"foreignKey:PaymentID"`
+}
+
+// PaymentTransition ghi lại mỗi lần Payment đổi trạng thái, kèm dữ liệu gốc
+// của cổng thanh toán (callback, kết quả tra cứu, hoàn tiền...).
+type PaymentTransition struct {
+	PaymentTransitionID int       `gorm:"primaryKey;autoIncrement;column:PaymentTransitionID"`
+	PaymentID           int       `gorm:"not null;index;column:PaymentID"`
+	FromStatus          string    `gorm:"size:24;column:FromStatus"`
+	ToStatus            string    `gorm:"size:24;not null;column:ToStatus"`
+	Source              string    `gorm:"size:20;not null;column:Source"` // create | callback | query | refund | admin
+	Note                string    `gorm:"size:255;column:Note"`
+	RawPayload          string    `gorm:"type:mediumtext;column:RawPayload"`
+	CreatedBy           string    `gorm:"size:100;column:CreatedBy"`
+	CreatedAt           time.Time `gorm:"autoCreateTime;column:CreatedAt"`
+}
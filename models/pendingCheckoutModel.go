@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// PendingCheckout lưu dữ liệu đơn hàng (ghế, món ăn, báo giá đã ký) ở server
+// trong lúc chờ thanh toán. Chỉ CheckoutRef được gửi qua cổng thanh toán; khi
+// giao dịch thành công đơn hàng được dựng lại từ bản ghi này.
+type PendingCheckout struct {
+	PendingCheckoutID int       `gorm:"primaryKey;autoIncrement;column:PendingCheckoutID"`
+	CheckoutRef       string    `gorm:"size:32;not null;uniqueIndex;column:CheckoutRef"` // mã ngẫu nhiên, không đoán được
+	ShowtimeID        int       `gorm:"not null;index;column:ShowtimeID"`
+	AccountID         int       `gorm:"index;column:AccountID;default:null"`
+	HoldToken         string    `gorm:"size:64;column:HoldToken;default:null"`
+	Email             string    `gorm:"size:100;column:Email;default:null"`
+	Amount            int       `gorm:"not null;column:Amount"`
+	Payload           string    `gorm:"type:mediumtext;not null;column:Payload"` // CheckoutPayload dạng JSON
+	Status            string    `gorm:"size:16;not null;index;column:Status"`    // open | completed | expired
+	ExpiresAt         time.Time `gorm:"index;column:ExpiresAt"`                  // hết hạn cùng lúc với ghế đang giữ
+	CreatedAt         time.Time `gorm:"autoCreateTime;column:CreatedAt"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime;column:UpdatedAt"`
+}
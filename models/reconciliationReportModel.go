@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ReconciliationReport là báo cáo đối soát thanh toán của một ngày.
+type ReconciliationReport struct {
+	ReconciliationReportID int       `gorm:"primaryKey;autoIncrement;column:ReconciliationReportID"`
+	ReportDate             string    `gorm:"size:10;not null;uniqueIndex;column:ReportDate"` // YYYY-MM-DD
+	IssueCount             int       `gorm:"not null;default:0;column:IssueCount"`
+	Report                 string    `gorm:"type:mediumtext;column:Report"` // ReconciliationReport dạng JSON
+	CreatedAt              time.Time `gorm:"autoCreateTime;column:CreatedAt"`
+	UpdatedAt              time.Time `gorm:"autoUpdateTime;column:UpdatedAt"`
+}
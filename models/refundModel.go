@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Refund là một lần hoàn tiền cho đơn hàng, qua cổng thanh toán của giao dịch
+// gốc.
+type Refund struct {
+	RefundID       int        `gorm:"primaryKey;autoIncrement;column:RefundID"`
+	OrderID        int        `gorm:"not null;index;column:OrderID"`
+	PaymentID      *int       `gorm:"index;column:PaymentID;default:null"`
+	ShowtimeID     int        `gorm:"not null;index;column:ShowtimeID"`
+	Source         string     `gorm:"size:30;not null;column:Source"` // showtime_cancel | customer_cancel | admin
+	Amount         int        `gorm:"not null;column:Amount"`
+	Reason         string     `gorm:"size:255;column:Reason"`
+	Status         string     `gorm:"size:20;not null;index;column:Status"` // pending | processing | succeeded | failed
+	ProviderRef    string     `gorm:"size:64;column:ProviderRef"`
+	Seats          string     `gorm:"size:255;column:Seats"` // danh sách ghế của đơn tại thời điểm hoàn tiền
+	PointsReversed int        `gorm:"not null;default:0;column:PointsReversed"`
+	Attempts       int        `gorm:"not null;default:0;column:Attempts"`
+	LastError      string     `gorm:"size:255;column:LastError"`
+	EmailSentAt    *time.Time `gorm:"column:EmailSentAt;default:null"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime;column:CreatedAt"`
+	CreatedBy      string     `gorm:"size:100;column:CreatedBy"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime;column:UpdatedAt"`
+}
@@ -5,4 +5,6 @@ type Row struct {
 	TheaterID int    `gorm:"not null;column:TheaterID"`
 	RowName   string `gorm:"size:100;not null;column:RowName"`
 	isOld     bool   `gorm:"column:IsOld;not null;default:false"`
+
+	LayoutVersion int `gorm:"not null;default:1;column:LayoutVersion"` // phiên bản sơ đồ ghế chứa hàng này, 0 là sơ đồ cũ trước khi có phiên bản
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// SeatCategory là loại ghế: standard, vip, couple, accessible...
+type SeatCategory struct {
+	SeatCategoryID int       `gorm:"primaryKey;autoIncrement;column:SeatCategoryID"`
+	Code           string    `gorm:"size:20;unique;not null;column:Code"`
+	CategoryName   string    `gorm:"size:100;not null;column:CategoryName"`
+	Color          string    `gorm:"size:20;column:Color"`
+	CreatedAt      time.Time `gorm:"autoCreateTime;column:CreatedAt"`
+	CreatedBy      string    `gorm:"size:100;column:CreatedBy"`
+}
+
+// TheaterSeatCategoryPrice là giá của một loại ghế trong một phòng chiếu.
+// Nếu có AbsolutePrice thì dùng giá này, ngược lại giá = SeatsPrice + PriceDelta.
+type TheaterSeatCategoryPrice struct {
+	TheaterSeatCategoryPriceID int       `gorm:"primaryKey;autoIncrement;column:TheaterSeatCategoryPriceID"`
+	TheaterID                  int       `gorm:"not null;uniqueIndex:idx_theater_seat_category;column:TheaterID"`
+	SeatCategoryID             int       `gorm:"not null;uniqueIndex:idx_theater_seat_category;column:SeatCategoryID"`
+	PriceDelta                 int       `gorm:"not null;default:0;column:PriceDelta"`
+	AbsolutePrice              *int      `gorm:"column:AbsolutePrice;default:null"`
+	LastUpdatedAt              time.Time `gorm:"autoUpdateTime;column:LastUpdatedAt"`
+	LastUpdatedBy              string    `gorm:"size:100;column:LastUpdatedBy"`
+}
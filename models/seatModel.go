@@ -10,4 +10,9 @@ type Seat struct {
 	Row         int    `gorm:"not null;column:Row"`
 	Description string `gorm:"type:text;column:Description"`
 	isOld       bool   `gorm:"column:IsOld;not null;default:false"`
+
+	SeatCategoryID *int `gorm:"column:SeatCategoryID;default:null"`
+	PairSeatID     *int `gorm:"column:PairSeatID;default:null"` // ghế còn lại của cặp ghế đôi
+	PairSeatNumber int  `gorm:"-"`                              // chỉ dùng khi thêm ghế: SeatNumber của ghế cùng hàng để ghép đôi
+	LayoutVersion  int  `gorm:"not null;default:1;column:LayoutVersion"`
 }
@@ -17,6 +17,9 @@ type Showtime struct {
 	LastUpdatedAt time.Time `gorm:"autoUpdateTime;column:LastUpdatedAt"`
 	LastUpdatedBy string    `gorm:"size:100;column:LastUpdatedBy"`
 
+	SeatHoldMinutes int `gorm:"not null;default:0;column:SeatHoldMinutes"` // 0 = theo cấu hình chi nhánh
+	LayoutVersion   int `gorm:"not null;default:1;column:LayoutVersion"`   // phiên bản sơ đồ ghế đang dùng
+
 	Theater *Theater `gorm:"foreignKey:TheaterID;references:TheaterID"`
 	Movie   *Movie   `gorm:"foreignKey:MovieID;references:MovieID"`
 }
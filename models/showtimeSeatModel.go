@@ -3,13 +3,17 @@ package models
 import "time"
 
 type ShowtimeSeat struct {
-	ShowtimeSeatID int       `gorm:"primaryKey;autoIncrement;column:ShowtimeSeatID"`
-	ShowtimeID     int       `gorm:"not null;column:ShowtimeID"`
-	SeatID         int       `gorm:"not null;column:SeatID"`
-	RowName        string    `gorm:"not null;column:RowName"`
-	TicketPrice    int       `gorm:"not null;column:TicketPrice"`
-	Status         int8      `gorm:"type:tinyint(1);default:0;column:Status"`
-	OrderID        int       `gorm:"column:OrderID;default:null"`
-	LockedBy       int       `gorm:"column:LockedBy;default:null"`
-	LockedAt       time.Time `gorm:"column:LockedAt;autoUpdateTime"`
+	ShowtimeSeatID int        `gorm:"primaryKey;autoIncrement;column:ShowtimeSeatID"`
+	ShowtimeID     int        `gorm:"not null;column:ShowtimeID"`
+	SeatID         int        `gorm:"not null;column:SeatID"`
+	RowName        string     `gorm:"not null;column:RowName"`
+	TicketPrice    int        `gorm:"not null;column:TicketPrice"`
+	Status         int8       `gorm:"type:tinyint(1);default:0;column:Status"`
+	OrderID        int        `gorm:"column:OrderID;default:null"`
+	LockedBy       int        `gorm:"column:LockedBy;default:null"`
+	HoldToken      string     `gorm:"column:HoldToken;size:64;default:null"`
+	LockedAt       *time.Time `gorm:"column:LockedAt;default:null"`
+	HoldExpiresAt  *time.Time `gorm:"column:HoldExpiresAt;default:null"`
+	HoldExtended   bool       `gorm:"column:HoldExtended;not null;default:false"`
+	SeatCategoryID *int       `gorm:"column:SeatCategoryID;default:null"`
 }
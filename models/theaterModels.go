@@ -16,6 +16,8 @@ type Theater struct {
 	LastUpdatedAt time.Time `gorm:"autoUpdateTime;column:LastUpdatedAt"`
 	CreatedBy     string    `gorm:"size:100;not null;column:CreatedBy"`
 	LastUpdatedBy string    `gorm:"size:100;not null;column:LastUpdatedBy"`
+
+	LayoutVersion int `gorm:"not null;default:1;column:LayoutVersion"` // phiên bản sơ đồ ghế hiện hành
 }
 
 // type Theater struct {
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Ticket là mã vé (in trong QR gửi qua email) của một đơn hàng. Nhân viên soát
+// vé quét mã để kiểm tra và đánh dấu đã sử dụng.
+type Ticket struct {
+	TicketID   int        `gorm:"primaryKey;autoIncrement;column:TicketID"`
+	OrderID    int        `gorm:"not null;uniqueIndex;column:OrderID"`
+	ShowtimeID int        `gorm:"not null;index;column:ShowtimeID"`
+	BranchID   int        `gorm:"not null;index;column:BranchID"`
+	Code       string     `gorm:"size:16;not null;uniqueIndex;column:Code"`
+	Status     string     `gorm:"size:10;not null;index;column:Status"` // valid | used | void
+	UsedAt     *time.Time `gorm:"column:UsedAt;default:null"`
+	UsedBy     *int       `gorm:"column:UsedBy;default:null"` // AccountID của nhân viên soát vé
+	CreatedAt  time.Time  `gorm:"autoCreateTime;column:CreatedAt"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime;column:UpdatedAt"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// TicketScan ghi lại mỗi lần quét vé, cả online (POST /checkin/scan) lẫn các
+// lần quét offline được máy soát vé đồng bộ lên sau.
+type TicketScan struct {
+	TicketScanID int       `gorm:"primaryKey;autoIncrement;column:TicketScanID"`
+	TicketID     *int      `gorm:"index;column:TicketID;default:null"`
+	BranchID     int       `gorm:"not null;index;column:BranchID"`
+	Code         string    `gorm:"size:16;column:Code"`
+	DeviceID     string    `gorm:"size:64;uniqueIndex:idx_ticket_scan_device;column:DeviceID"`
+	ClientScanID *string   `gorm:"size:64;uniqueIndex:idx_ticket_scan_device;column:ClientScanID;default:null"` // mã lần quét phía máy soát vé, chống đồng bộ trùng
+	Source       string    `gorm:"size:10;not null;column:Source"`                                              // online | offline
+	Result       string    `gorm:"size:10;not null;index;column:Result"`                                        // accepted | rejected | conflict
+	Reason       string    `gorm:"size:30;column:Reason"`
+	ScannedAt    time.Time `gorm:"not null;column:ScannedAt"`
+	ScannedBy    int       `gorm:"not null;column:ScannedBy"`
+	CreatedAt    time.Time `gorm:"autoCreateTime;column:CreatedAt"`
+}
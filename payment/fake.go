@@ -0,0 +1,220 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"movie-ticket-booking/config"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kết quả mô phỏng của cổng giả lập.
+const (
+	FakeOutcomeSuccess = "success"
+	FakeOutcomeFailure = "failure"
+	FakeOutcomeTimeout = "timeout" // người dùng bỏ dở: không có callback, giao dịch treo ở pending
+)
+
+// FakeProvider là cổng thanh toán chạy trong process, dùng khi phát triển và
+// integration test. PayURL trỏ về GET /payment/fake/pay/:Ref của chính server;
+// mở URL với ?outcome=success|failure|timeout để mô phỏng kết quả.
+type FakeProvider struct {
+	mu           sync.Mutex
+	secret       string
+	baseURL      string
+	redirectURL  string
+	transactions map[string]*fakeTransaction
+	refunds      map[string]Status
+	nextTransID  int64
+}
+
+type fakeTransaction struct {
+	Amount    int64
+	ExtraData string
+	Status    Status
+	TransID   string
+	Refunded  int64
+}
+
+// fakeCallback là body callback mà cổng giả lập "gửi" về, có ký HMAC-SHA256.
+type fakeCallback struct {
+	OrderRef  string `json:"orderRef"`
+	TransID   string `json:"transId"`
+	Amount    int64  `json:"amount"`
+	Status    Status `json:"status"`
+	ExtraData string `json:"extraData"`
+	Signature string `json:"signature"`
+}
+
+func (cb fakeCallback) rawSignature() string {
+	return fmt.Sprintf("amount=%d&extraData=%s&orderRef=%s&status=%s&transId=%s",
+		cb.Amount, cb.ExtraData, cb.OrderRef, cb.Status, cb.TransID)
+}
+
+var (
+	fakeOnce     sync.Once
+	fakeInstance *FakeProvider
+)
+
+// FakeGateway trả về cổng giả lập dùng chung của process.
+func FakeGateway() *FakeProvider {
+	fakeOnce.Do(func() {
+		cfg := config.GetFakePaymentEnv()
+		fakeInstance = &FakeProvider{
+			secret:       cfg["SECRET"],
+			baseURL:      cfg["BASE_URL"],
+			redirectURL:  cfg["REDIRECT_URL"],
+			transactions: map[string]*fakeTransaction{},
+			refunds:      map[string]Status{},
+			nextTransID:  time.Now().Unix(),
+		}
+	})
+	return fakeInstance
+}
+
+func (p *FakeProvider) Name() string            { return Fake }
+func (p *FakeProvider) SupportsExtraData() bool { return true }
+
+// RedirectURL là trang front-end nhận người dùng sau khi "thanh toán".
+func (p *FakeProvider) RedirectURL() string { return p.redirectURL }
+
+func (p *FakeProvider) CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.transactions[req.OrderRef]; exists {
+		return nil, fmt.Errorf("giao dịch %s đã tồn tại", req.OrderRef)
+	}
+	p.transactions[req.OrderRef] = &fakeTransaction{
+		Amount:    req.Amount,
+		ExtraData: req.ExtraData,
+		Status:    StatusPending,
+	}
+	payURL := p.baseURL + "/payment/fake/pay/" + url.PathEscape(req.OrderRef)
+	return &CreateResult{PayURL: payURL, OrderRef: req.OrderRef}, nil
+}
+
+// Complete mô phỏng người dùng thanh toán xong trên cổng. Với success/failure
+// trả về body callback đã ký; với timeout trả về nil (không có callback).
+func (p *FakeProvider) Complete(orderRef, outcome string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	txn, ok := p.transactions[orderRef]
+	if !ok {
+		return nil, fmt.Errorf("không tìm thấy giao dịch %s", orderRef)
+	}
+	if txn.Status != StatusPending {
+		return nil, fmt.Errorf("giao dịch %s đã kết thúc (%s)", orderRef, txn.Status)
+	}
+
+	switch outcome {
+	case FakeOutcomeSuccess:
+		p.nextTransID++
+		txn.Status = StatusPaid
+		txn.TransID = strconv.FormatInt(p.nextTransID, 10)
+	case FakeOutcomeFailure:
+		txn.Status = StatusFailed
+	case FakeOutcomeTimeout:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("outcome %q không hợp lệ", outcome)
+	}
+
+	cb := fakeCallback{
+		OrderRef:  orderRef,
+		TransID:   txn.TransID,
+		Amount:    txn.Amount,
+		Status:    txn.Status,
+		ExtraData: txn.ExtraData,
+	}
+	cb.Signature = hmacSHA256(p.secret, cb.rawSignature())
+	return json.Marshal(cb)
+}
+
+func (p *FakeProvider) VerifyCallback(r *http.Request) (*CallbackResult, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	var cb fakeCallback
+	if err := json.Unmarshal(body, &cb); err != nil {
+		return nil, err
+	}
+	if !equalSignature(hmacSHA256(p.secret, cb.rawSignature()), cb.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	var raw map[string]interface{}
+	_ = json.Unmarshal(body, &raw)
+	return &CallbackResult{
+		OrderRef:  cb.OrderRef,
+		TransID:   cb.TransID,
+		Amount:    cb.Amount,
+		Status:    cb.Status,
+		ExtraData: cb.ExtraData,
+		Raw:       raw,
+	}, nil
+}
+
+func (p *FakeProvider) Ack(outcome AckOutcome) (int, interface{}) {
+	switch outcome {
+	case AckOK:
+		return http.StatusOK, map[string]interface{}{"ok": true}
+	case AckRetry:
+		return http.StatusInternalServerError, map[string]interface{}{"ok": false, "retry": true}
+	default:
+		return http.StatusBadRequest, map[string]interface{}{"ok": false}
+	}
+}
+
+func (p *FakeProvider) QueryStatus(ctx context.Context, req QueryRequest) (*QueryResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	txn, ok := p.transactions[req.OrderRef]
+	if !ok {
+		// Giao dịch tạo trước khi process khởi động lại: cổng không còn biết tới
+		return &QueryResult{OrderRef: req.OrderRef, Status: StatusFailed, Message: "transaction not found"}, nil
+	}
+	return &QueryResult{
+		OrderRef: req.OrderRef,
+		TransID:  txn.TransID,
+		Amount:   txn.Amount,
+		Status:   txn.Status,
+	}, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	txn, ok := p.transactions[req.OrderRef]
+	if !ok || (txn.Status != StatusPaid && txn.Status != StatusRefunded) {
+		return &RefundResult{RefundRef: req.RefundRef, Status: StatusFailed, Message: "transaction not paid"}, nil
+	}
+	if txn.Refunded+req.Amount > txn.Amount {
+		return &RefundResult{RefundRef: req.RefundRef, Status: StatusFailed, Message: "refund exceeds amount"}, nil
+	}
+	txn.Refunded += req.Amount
+	if txn.Refunded == txn.Amount {
+		txn.Status = StatusRefunded
+	}
+	p.refunds[req.RefundRef] = StatusRefunded
+	return &RefundResult{RefundRef: req.RefundRef, Status: StatusRefunded}, nil
+}
+
+func (p *FakeProvider) QueryRefund(ctx context.Context, req RefundQueryRequest) (*RefundResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status, ok := p.refunds[req.RefundRef]
+	if !ok {
+		return &RefundResult{RefundRef: req.RefundRef, Status: StatusFailed, Message: "refund not found"}, nil
+	}
+	return &RefundResult{RefundRef: req.RefundRef, Status: status}, nil
+}
@@ -0,0 +1,199 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func newTestFake() *FakeProvider {
+	return &FakeProvider{
+		secret:       "fake-secret",
+		baseURL:      "http://localhost:8080",
+		transactions: map[string]*fakeTransaction{},
+		refunds:      map[string]Status{},
+	}
+}
+
+func createFakePayment(t *testing.T, p *FakeProvider, ref string, amount int64) {
+	t.Helper()
+	result, err := p.CreatePayment(context.Background(), CreateRequest{OrderRef: ref, Amount: amount, ExtraData: "checkout-1"})
+	if err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+	if want := "http://localhost:8080/payment/fake/pay/" + ref; result.PayURL != want {
+		t.Errorf("PayURL = %q, muốn %q", result.PayURL, want)
+	}
+}
+
+func callbackRequest(body []byte) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "/payment/callback/"+Fake, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestFakeCreatePaymentRejectsDuplicateRef(t *testing.T) {
+	p := newTestFake()
+	createFakePayment(t, p, "1001", 90000)
+	if _, err := p.CreatePayment(context.Background(), CreateRequest{OrderRef: "1001", Amount: 90000}); err == nil {
+		t.Fatal("muốn lỗi khi tạo trùng mã giao dịch")
+	}
+}
+
+func TestFakeComplete(t *testing.T) {
+	tests := []struct {
+		outcome      string
+		wantCallback bool
+		wantStatus   Status
+		wantErr      bool
+	}{
+		{outcome: FakeOutcomeSuccess, wantCallback: true, wantStatus: StatusPaid},
+		{outcome: FakeOutcomeFailure, wantCallback: true, wantStatus: StatusFailed},
+		{outcome: FakeOutcomeTimeout, wantStatus: StatusPending},
+		{outcome: "cancel", wantStatus: StatusPending, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.outcome, func(t *testing.T) {
+			p := newTestFake()
+			createFakePayment(t, p, "1001", 90000)
+
+			body, err := p.Complete("1001", tt.outcome)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Complete err = %v, muốn lỗi = %v", err, tt.wantErr)
+			}
+			if (body != nil) != tt.wantCallback {
+				t.Fatalf("Complete callback = %s, muốn có callback = %v", body, tt.wantCallback)
+			}
+
+			if body != nil {
+				result, err := p.VerifyCallback(callbackRequest(body))
+				if err != nil {
+					t.Fatalf("VerifyCallback: %v", err)
+				}
+				if result.OrderRef != "1001" || result.Amount != 90000 || result.ExtraData != "checkout-1" || result.Status != tt.wantStatus {
+					t.Errorf("VerifyCallback = %+v", result)
+				}
+				if (result.TransID != "") != (tt.wantStatus == StatusPaid) {
+					t.Errorf("TransID = %q với trạng thái %s", result.TransID, tt.wantStatus)
+				}
+			}
+
+			query, err := p.QueryStatus(context.Background(), QueryRequest{OrderRef: "1001"})
+			if err != nil {
+				t.Fatalf("QueryStatus: %v", err)
+			}
+			if query.Status != tt.wantStatus {
+				t.Errorf("QueryStatus = %s, muốn %s", query.Status, tt.wantStatus)
+			}
+
+			// Giao dịch đã kết thúc thì không hoàn tất lại được
+			if _, err := p.Complete("1001", FakeOutcomeSuccess); (err != nil) != tt.wantCallback {
+				t.Errorf("Complete lần hai err = %v", err)
+			}
+		})
+	}
+}
+
+func TestFakeVerifyCallbackRejectsTampering(t *testing.T) {
+	p := newTestFake()
+	createFakePayment(t, p, "1001", 90000)
+	body, err := p.Complete("1001", FakeOutcomeSuccess)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(cb *fakeCallback)
+		secret string
+	}{
+		{name: "sửa số tiền", mutate: func(cb *fakeCallback) { cb.Amount = 1000 }},
+		{name: "sửa trạng thái", mutate: func(cb *fakeCallback) { cb.Status = StatusRefunded }},
+		{name: "sửa extraData", mutate: func(cb *fakeCallback) { cb.ExtraData = "checkout-2" }},
+		{name: "sai khóa bí mật", mutate: func(cb *fakeCallback) {}, secret: "other-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cb fakeCallback
+			if err := json.Unmarshal(body, &cb); err != nil {
+				t.Fatal(err)
+			}
+			tt.mutate(&cb)
+			tampered, _ := json.Marshal(cb)
+
+			verifier := newTestFake()
+			if tt.secret != "" {
+				verifier.secret = tt.secret
+			}
+			if _, err := verifier.VerifyCallback(callbackRequest(tampered)); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifyCallback err = %v, muốn %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestFakeRefund(t *testing.T) {
+	tests := []struct {
+		name        string
+		outcome     string
+		refunds     []int64
+		wantResults []Status
+		wantTxn     Status
+	}{
+		{name: "hoàn một phần", outcome: FakeOutcomeSuccess, refunds: []int64{30000}, wantResults: []Status{StatusRefunded}, wantTxn: StatusPaid},
+		{name: "hoàn nhiều lần đến hết", outcome: FakeOutcomeSuccess, refunds: []int64{30000, 60000}, wantResults: []Status{StatusRefunded, StatusRefunded}, wantTxn: StatusRefunded},
+		{name: "hoàn vượt số tiền", outcome: FakeOutcomeSuccess, refunds: []int64{60000, 60000}, wantResults: []Status{StatusRefunded, StatusFailed}, wantTxn: StatusPaid},
+		{name: "giao dịch chưa thanh toán", outcome: FakeOutcomeFailure, refunds: []int64{90000}, wantResults: []Status{StatusFailed}, wantTxn: StatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestFake()
+			createFakePayment(t, p, "1001", 90000)
+			if _, err := p.Complete("1001", tt.outcome); err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+
+			for i, amount := range tt.refunds {
+				ref := "R" + string(rune('1'+i))
+				result, err := p.Refund(context.Background(), RefundRequest{RefundRef: ref, OrderRef: "1001", Amount: amount, OriginalAmount: 90000})
+				if err != nil {
+					t.Fatalf("Refund: %v", err)
+				}
+				if result.Status != tt.wantResults[i] {
+					t.Errorf("Refund %s = %s (%s), muốn %s", ref, result.Status, result.Message, tt.wantResults[i])
+				}
+
+				query, err := p.QueryRefund(context.Background(), RefundQueryRequest{RefundRef: ref, OrderRef: "1001"})
+				if err != nil {
+					t.Fatalf("QueryRefund: %v", err)
+				}
+				if query.Status != tt.wantResults[i] {
+					t.Errorf("QueryRefund %s = %s, muốn %s", ref, query.Status, tt.wantResults[i])
+				}
+			}
+
+			query, err := p.QueryStatus(context.Background(), QueryRequest{OrderRef: "1001"})
+			if err != nil {
+				t.Fatalf("QueryStatus: %v", err)
+			}
+			if query.Status != tt.wantTxn {
+				t.Errorf("QueryStatus = %s, muốn %s", query.Status, tt.wantTxn)
+			}
+		})
+	}
+}
+
+func TestFakeQueryStatusUnknownRef(t *testing.T) {
+	result, err := newTestFake().QueryStatus(context.Background(), QueryRequest{OrderRef: "9999"})
+	if err != nil {
+		t.Fatalf("QueryStatus: %v", err)
+	}
+	if result.Status != StatusFailed {
+		t.Errorf("QueryStatus = %s, muốn %s", result.Status, StatusFailed)
+	}
+}
@@ -0,0 +1,283 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type momoProvider struct {
+	partnerCode string
+	accessKey   string
+	secretKey   string
+	redirectURL string
+	ipnURL      string
+	endpoint    string
+}
+
+func newMomo(cfg map[string]string) *momoProvider {
+	return &momoProvider{
+		partnerCode: cfg["PARTNER_CODE"],
+		accessKey:   cfg["ACCESS_KEY"],
+		secretKey:   cfg["SECRET_KEY"],
+		redirectURL: cfg["REDIRECT_URL"],
+		ipnURL:      cfg["IPN_URL"],
+		endpoint:    cfg["ENDPOINT"],
+	}
+}
+
+func (p *momoProvider) configured() bool {
+	return p.partnerCode != "" && p.accessKey != "" && p.secretKey != ""
+}
+
+func (p *momoProvider) Name() string            { return MoMo }
+func (p *momoProvider) SupportsExtraData() bool { return true }
+
+// momoIPN là thông báo kết quả thanh toán MoMo gửi tới ipnUrl.
+type momoIPN struct {
+	PartnerCode  string `json:"partnerCode"`
+	OrderID      string `json:"orderId"`
+	RequestID    string `json:"requestId"`
+	Amount       int64  `json:"amount"`
+	OrderInfo    string `json:"orderInfo"`
+	OrderType    string `json:"orderType"`
+	TransID      int64  `json:"transId"`
+	ResultCode   int    `json:"resultCode"`
+	Message      string `json:"message"`
+	PayType      string `json:"payType"`
+	ResponseTime int64  `json:"responseTime"`
+	ExtraData    string `json:"extraData"`
+	Signature    string `json:"signature"`
+}
+
+// rawSignature ghép các trường theo thứ tự alphabet như tài liệu MoMo.
+func (ipn momoIPN) rawSignature(accessKey string) string {
+	return "accessKey=" + accessKey +
+		"&amount=" + strconv.FormatInt(ipn.Amount, 10) +
+		"&extraData=" + ipn.ExtraData +
+		"&message=" + ipn.Message +
+		"&orderId=" + ipn.OrderID +
+		"&orderInfo=" + ipn.OrderInfo +
+		"&orderType=" + ipn.OrderType +
+		"&partnerCode=" + ipn.PartnerCode +
+		"&payType=" + ipn.PayType +
+		"&requestId=" + ipn.RequestID +
+		"&responseTime=" + strconv.FormatInt(ipn.ResponseTime, 10) +
+		"&resultCode=" + strconv.Itoa(ipn.ResultCode) +
+		"&transId=" + strconv.FormatInt(ipn.TransID, 10)
+}
+
+func (p *momoProvider) CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error) {
+	amount := strconv.FormatInt(req.Amount, 10)
+	requestID := req.OrderRef
+	requestType := "payWithMethod"
+
+	rawSignature := "accessKey=" + p.accessKey +
+		"&amount=" + amount +
+		"&extraData=" + req.ExtraData +
+		"&ipnUrl=" + p.ipnURL +
+		"&orderId=" + req.OrderRef +
+		"&orderInfo=" + req.OrderInfo +
+		"&partnerCode=" + p.partnerCode +
+		"&redirectUrl=" + p.redirectURL +
+		"&requestId=" + requestID +
+		"&requestType=" + requestType
+
+	payload := map[string]interface{}{
+		"partnerCode":  p.partnerCode,
+		"accessKey":    p.accessKey,
+		"requestId":    requestID,
+		"amount":       amount,
+		"orderId":      req.OrderRef,
+		"orderInfo":    req.OrderInfo,
+		"redirectUrl":  p.redirectURL,
+		"ipnUrl":       p.ipnURL,
+		"extraData":    req.ExtraData,
+		"requestType":  requestType,
+		"signature":    hmacSHA256(p.secretKey, rawSignature),
+		"lang":         "vi",
+		"autoCapture":  true,
+		"orderGroupId": "",
+		"partnerName":  "Movie Ticket",
+		"storeId":      "MT001",
+	}
+
+	resp, err := p.post(ctx, "/v2/gateway/api/create", payload)
+	if err != nil {
+		return nil, err
+	}
+	payURL, ok := resp["payUrl"].(string)
+	if !ok {
+		return nil, fmt.Errorf("MoMo không trả về payUrl: %v", resp["message"])
+	}
+	return &CreateResult{PayURL: payURL, OrderRef: req.OrderRef, Raw: resp}, nil
+}
+
+func (p *momoProvider) VerifyCallback(r *http.Request) (*CallbackResult, error) {
+	var raw map[string]interface{}
+	var ipn momoIPN
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &ipn); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal(body, &raw)
+
+	if ipn.PartnerCode != p.partnerCode ||
+		!equalSignature(hmacSHA256(p.secretKey, ipn.rawSignature(p.accessKey)), ipn.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	status := StatusFailed
+	if ipn.ResultCode == 0 {
+		status = StatusPaid
+	}
+	return &CallbackResult{
+		OrderRef:  ipn.OrderID,
+		TransID:   strconv.FormatInt(ipn.TransID, 10),
+		Amount:    ipn.Amount,
+		Status:    status,
+		Message:   ipn.Message,
+		ExtraData: ipn.ExtraData,
+		Raw:       raw,
+	}, nil
+}
+
+// Ack: MoMo chờ HTTP 204, mã khác sẽ khiến MoMo gửi lại IPN.
+func (p *momoProvider) Ack(outcome AckOutcome) (int, interface{}) {
+	switch outcome {
+	case AckOK:
+		return http.StatusNoContent, nil
+	case AckRetry:
+		return http.StatusInternalServerError, map[string]string{"error": "retry"}
+	default:
+		return http.StatusBadRequest, map[string]string{"error": "rejected"}
+	}
+}
+
+func (p *momoProvider) QueryStatus(ctx context.Context, req QueryRequest) (*QueryResult, error) {
+	requestID := req.OrderRef
+	rawSignature := "accessKey=" + p.accessKey +
+		"&orderId=" + req.OrderRef +
+		"&partnerCode=" + p.partnerCode +
+		"&requestId=" + requestID
+
+	resp, err := p.post(ctx, "/v2/gateway/api/query", map[string]interface{}{
+		"partnerCode": p.partnerCode,
+		"requestId":   requestID,
+		"orderId":     req.OrderRef,
+		"signature":   hmacSHA256(p.secretKey, rawSignature),
+		"lang":        "vi",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{OrderRef: req.OrderRef, Raw: resp}
+	result.Amount = int64(number(resp["amount"]))
+	if transID := int64(number(resp["transId"])); transID != 0 {
+		result.TransID = strconv.FormatInt(transID, 10)
+	}
+	result.Message, _ = resp["message"].(string)
+
+	// 0: thành công, 1000: đã khởi tạo chờ người dùng, 7000/7002: đang xử lý
+	switch int(number(resp["resultCode"])) {
+	case 0:
+		result.Status = StatusPaid
+	case 1000, 7000, 7002:
+		result.Status = StatusPending
+	default:
+		result.Status = StatusFailed
+	}
+	return result, nil
+}
+
+func (p *momoProvider) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	amount := strconv.FormatInt(req.Amount, 10)
+	rawSignature := "accessKey=" + p.accessKey +
+		"&amount=" + amount +
+		"&description=" + req.Reason +
+		"&orderId=" + req.RefundRef +
+		"&partnerCode=" + p.partnerCode +
+		"&requestId=" + req.RefundRef +
+		"&transId=" + req.TransID
+
+	transID, _ := strconv.ParseInt(req.TransID, 10, 64)
+	resp, err := p.post(ctx, "/v2/gateway/api/refund", map[string]interface{}{
+		"partnerCode": p.partnerCode,
+		"orderId":     req.RefundRef,
+		"requestId":   req.RefundRef,
+		"amount":      req.Amount,
+		"transId":     transID,
+		"lang":        "vi",
+		"description": req.Reason,
+		"signature":   hmacSHA256(p.secretKey, rawSignature),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RefundResult{RefundRef: req.RefundRef, Status: StatusFailed, Raw: resp}
+	result.Message, _ = resp["message"].(string)
+	if int(number(resp["resultCode"])) == 0 {
+		result.Status = StatusRefunded
+	}
+	return result, nil
+}
+
+// QueryRefund tra cứu các lần hoàn tiền của giao dịch gốc và lấy kết quả của
+// lần hoàn có orderId là RefundRef.
+func (p *momoProvider) QueryRefund(ctx context.Context, req RefundQueryRequest) (*RefundResult, error) {
+	requestID := req.RefundRef + "_Q" + strconv.FormatInt(time.Now().Unix(), 10)
+	rawSignature := "accessKey=" + p.accessKey +
+		"&orderId=" + req.OrderRef +
+		"&partnerCode=" + p.partnerCode +
+		"&requestId=" + requestID
+
+	resp, err := p.post(ctx, "/v2/gateway/api/refund/query", map[string]interface{}{
+		"partnerCode": p.partnerCode,
+		"requestId":   requestID,
+		"orderId":     req.OrderRef,
+		"signature":   hmacSHA256(p.secretKey, rawSignature),
+		"lang":        "vi",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RefundResult{RefundRef: req.RefundRef, Status: StatusFailed, Raw: resp}
+	result.Message, _ = resp["message"].(string)
+	trans, _ := resp["refundTrans"].([]interface{})
+	for _, item := range trans {
+		refund, _ := item.(map[string]interface{})
+		if orderID, _ := refund["orderId"].(string); orderID != req.RefundRef {
+			continue
+		}
+		// 0: thành công, 1000/7000/7002: đang xử lý
+		switch int(number(refund["resultCode"])) {
+		case 0:
+			result.Status = StatusRefunded
+		case 1000, 7000, 7002:
+			result.Status = StatusPending
+		}
+		return result, nil
+	}
+	result.Message = "không tìm thấy yêu cầu hoàn tiền " + req.RefundRef
+	return result, nil
+}
+
+func (p *momoProvider) post(ctx context.Context, path string, payload map[string]interface{}) (map[string]interface{}, error) {
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(req)
+}
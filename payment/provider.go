@@ -0,0 +1,234 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"movie-ticket-booking/config"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Tên các cổng thanh toán, cũng là giá trị lưu ở Branch.PaymentProvider và
+// Order.PaymentProvider.
+const (
+	MoMo    = "momo"
+	VNPay   = "vnpay"
+	ZaloPay = "zalopay"
+	Fake    = "fake"
+)
+
+// Status là trạng thái giao dịch theo cổng thanh toán.
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusPaid     Status = "paid"
+	StatusFailed   Status = "failed"
+	StatusRefunded Status = "refunded"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("cổng thanh toán không tồn tại")
+	ErrProviderDisabled = errors.New("cổng thanh toán chưa được cấu hình")
+	ErrInvalidSignature = errors.New("chữ ký không hợp lệ")
+)
+
+type CreateRequest struct {
+	OrderRef  string // mã giao dịch phía hệ thống, duy nhất cho mỗi lần thanh toán
+	Amount    int64
+	OrderInfo string
+	ExtraData string // chỉ các cổng có SupportsExtraData mới mang theo được
+	ClientIP  string
+}
+
+type CreateResult struct {
+	PayURL   string
+	OrderRef string // mã giao dịch đã gửi sang cổng (có thể khác định dạng OrderRef yêu cầu)
+	Raw      map[string]interface{}
+}
+
+// CallbackResult là kết quả thanh toán đã xác thực chữ ký.
+type CallbackResult struct {
+	OrderRef  string
+	TransID   string
+	Amount    int64
+	Status    Status
+	Message   string
+	ExtraData string
+	Raw       map[string]interface{}
+}
+
+type QueryRequest struct {
+	OrderRef  string
+	TransID   string
+	Amount    int64
+	CreatedAt time.Time // thời điểm tạo giao dịch, VNPay cần khi tra cứu/hoàn tiền
+}
+
+type QueryResult struct {
+	OrderRef string
+	TransID  string
+	Amount   int64
+	Status   Status
+	Message  string
+	Raw      map[string]interface{}
+}
+
+type RefundRequest struct {
+	RefundRef      string // mã yêu cầu hoàn tiền, duy nhất
+	OrderRef       string
+	TransID        string
+	Amount         int64 // số tiền hoàn
+	OriginalAmount int64 // số tiền đã thanh toán
+	CreatedAt      time.Time
+	Reason         string
+	RequestedBy    string
+}
+
+type RefundResult struct {
+	RefundRef string
+	Status    Status // refunded, pending (cổng đang xử lý) hoặc failed
+	Message   string
+	Raw       map[string]interface{}
+}
+
+// RefundQueryRequest tra cứu một yêu cầu hoàn tiền cổng đang xử lý.
+type RefundQueryRequest struct {
+	RefundRef string // mã hoàn tiền cổng đã trả về (RefundResult.RefundRef)
+	OrderRef  string
+	TransID   string
+	CreatedAt time.Time // thời điểm tạo giao dịch gốc
+}
+
+// AckOutcome là kết quả xử lý callback, mỗi cổng trả lời theo định dạng riêng.
+type AckOutcome int
+
+const (
+	AckOK AckOutcome = iota
+	AckInvalidSignature
+	AckInvalidAmount
+	AckOrderNotFound
+	AckRetry // lỗi tạm thời, cổng nên gửi lại callback
+)
+
+// PaymentProvider là một cổng thanh toán.
+type PaymentProvider interface {
+	Name() string
+	// SupportsExtraData cho biết cổng có mang ExtraData qua callback hay không.
+	SupportsExtraData() bool
+	CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error)
+	// VerifyCallback đọc và xác thực callback/IPN của cổng.
+	VerifyCallback(r *http.Request) (*CallbackResult, error)
+	// Ack trả về HTTP status và body (nil = không có body) mà cổng chờ đợi.
+	Ack(outcome AckOutcome) (int, interface{})
+	QueryStatus(ctx context.Context, req QueryRequest) (*QueryResult, error)
+	Refund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+	// QueryRefund tra cứu yêu cầu hoàn tiền cổng trả về pending lúc gửi.
+	QueryRefund(ctx context.Context, req RefundQueryRequest) (*RefundResult, error)
+}
+
+type configurable interface {
+	configured() bool
+}
+
+// Get trả về cổng thanh toán đã được cấu hình theo tên.
+func Get(name string) (PaymentProvider, error) {
+	var provider PaymentProvider
+	switch name {
+	case MoMo:
+		provider = newMomo(config.GetMomoEnv())
+	case VNPay:
+		provider = newVNPay(config.GetVNPayEnv())
+	case ZaloPay:
+		provider = newZaloPay(config.GetZaloPayEnv())
+	case Fake:
+		if config.GetFakePaymentEnv()["ENABLED"] != "true" {
+			return nil, ErrProviderDisabled
+		}
+		return FakeGateway(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+	if c, ok := provider.(configurable); ok && !c.configured() {
+		return nil, fmt.Errorf("%w: %s", ErrProviderDisabled, name)
+	}
+	return provider, nil
+}
+
+// Enabled liệt kê các cổng thanh toán đang dùng được.
+func Enabled() []string {
+	var names []string
+	for _, name := range []string{MoMo, VNPay, ZaloPay, Fake} {
+		if _, err := Get(name); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// VNPay và ZaloPay dùng giờ Việt Nam (GMT+7) cho các trường ngày giờ.
+var vietnamTime = time.FixedZone("GMT+7", 7*60*60)
+
+func hmacSHA256(key, data string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hmacSHA512(key, data string) string {
+	h := hmac.New(sha512.New, []byte(key))
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func equalSignature(expected, actual string) bool {
+	return hmac.Equal([]byte(expected), []byte(actual))
+}
+
+// readBody đọc body của callback và gán lại để có thể đọc lần nữa.
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// doJSON gửi request và đọc response JSON của cổng thanh toán.
+func doJSON(req *http.Request) (map[string]interface{}, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("không đọc được phản hồi (HTTP %d): %w", resp.StatusCode, err)
+	}
+	return result, nil
+}
+
+// number đọc giá trị số trong JSON (float64 hoặc chuỗi số).
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
@@ -0,0 +1,254 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const vnpayDateLayout = "20060102150405"
+
+type vnpayProvider struct {
+	tmnCode    string
+	hashSecret string
+	payURL     string
+	apiURL     string
+	returnURL  string
+}
+
+func newVNPay(cfg map[string]string) *vnpayProvider {
+	return &vnpayProvider{
+		tmnCode:    cfg["TMN_CODE"],
+		hashSecret: cfg["HASH_SECRET"],
+		payURL:     cfg["PAY_URL"],
+		apiURL:     cfg["API_URL"],
+		returnURL:  cfg["RETURN_URL"],
+	}
+}
+
+func (p *vnpayProvider) configured() bool {
+	return p.tmnCode != "" && p.hashSecret != ""
+}
+
+func (p *vnpayProvider) Name() string { return VNPay }
+
+// VNPay không có trường dữ liệu kèm theo đi qua IPN.
+func (p *vnpayProvider) SupportsExtraData() bool { return false }
+
+// vnpayQuery sắp xếp tham số theo tên và URL-encode như thư viện mẫu của VNPay;
+// chuỗi này vừa là query string vừa là dữ liệu để ký.
+func vnpayQuery(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := params.Get(k)
+		if v == "" {
+			continue
+		}
+		parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+	}
+	return strings.Join(parts, "&")
+}
+
+func (p *vnpayProvider) CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error) {
+	now := time.Now().In(vietnamTime)
+	params := url.Values{}
+	params.Set("vnp_Version", "2.1.0")
+	params.Set("vnp_Command", "pay")
+	params.Set("vnp_TmnCode", p.tmnCode)
+	params.Set("vnp_Amount", strconv.FormatInt(req.Amount*100, 10))
+	params.Set("vnp_CurrCode", "VND")
+	params.Set("vnp_TxnRef", req.OrderRef)
+	params.Set("vnp_OrderInfo", req.OrderInfo)
+	params.Set("vnp_OrderType", "other")
+	params.Set("vnp_Locale", "vn")
+	params.Set("vnp_ReturnUrl", p.returnURL)
+	params.Set("vnp_IpAddr", req.ClientIP)
+	params.Set("vnp_CreateDate", now.Format(vnpayDateLayout))
+	params.Set("vnp_ExpireDate", now.Add(15*time.Minute).Format(vnpayDateLayout))
+
+	query := vnpayQuery(params)
+	payURL := p.payURL + "?" + query + "&vnp_SecureHash=" + hmacSHA512(p.hashSecret, query)
+	return &CreateResult{PayURL: payURL, OrderRef: req.OrderRef}, nil
+}
+
+// VerifyCallback đọc IPN (GET, tham số trên query string) của VNPay.
+func (p *vnpayProvider) VerifyCallback(r *http.Request) (*CallbackResult, error) {
+	params := r.URL.Query()
+	signature := params.Get("vnp_SecureHash")
+	params.Del("vnp_SecureHash")
+	params.Del("vnp_SecureHashType")
+
+	if !equalSignature(hmacSHA512(p.hashSecret, vnpayQuery(params)), strings.ToLower(signature)) {
+		return nil, ErrInvalidSignature
+	}
+	if params.Get("vnp_TmnCode") != p.tmnCode {
+		return nil, ErrInvalidSignature
+	}
+
+	raw := map[string]interface{}{}
+	for k := range params {
+		raw[k] = params.Get(k)
+	}
+
+	amount, _ := strconv.ParseInt(params.Get("vnp_Amount"), 10, 64)
+	status := StatusFailed
+	if params.Get("vnp_ResponseCode") == "00" && params.Get("vnp_TransactionStatus") == "00" {
+		status = StatusPaid
+	}
+	return &CallbackResult{
+		OrderRef: params.Get("vnp_TxnRef"),
+		TransID:  params.Get("vnp_TransactionNo"),
+		Amount:   amount / 100,
+		Status:   status,
+		Message:  params.Get("vnp_ResponseCode"),
+		Raw:      raw,
+	}, nil
+}
+
+// Ack: VNPay đọc RspCode trong body JSON, HTTP luôn là 200.
+func (p *vnpayProvider) Ack(outcome AckOutcome) (int, interface{}) {
+	codes := map[AckOutcome][2]string{
+		AckOK:               {"00", "Confirm Success"},
+		AckInvalidSignature: {"97", "Invalid Checksum"},
+		AckInvalidAmount:    {"04", "Invalid amount"},
+		AckOrderNotFound:    {"01", "Order not found"},
+		AckRetry:            {"99", "Unknown error"},
+	}
+	code := codes[outcome]
+	return http.StatusOK, map[string]string{"RspCode": code[0], "Message": code[1]}
+}
+
+func (p *vnpayProvider) QueryStatus(ctx context.Context, req QueryRequest) (*QueryResult, error) {
+	now := time.Now().In(vietnamTime)
+	requestID := strconv.FormatInt(now.UnixNano(), 10)
+	payload := map[string]string{
+		"vnp_RequestId":       requestID,
+		"vnp_Version":         "2.1.0",
+		"vnp_Command":         "querydr",
+		"vnp_TmnCode":         p.tmnCode,
+		"vnp_TxnRef":          req.OrderRef,
+		"vnp_OrderInfo":       "Tra cuu giao dich " + req.OrderRef,
+		"vnp_TransactionDate": req.CreatedAt.In(vietnamTime).Format(vnpayDateLayout),
+		"vnp_CreateDate":      now.Format(vnpayDateLayout),
+		"vnp_IpAddr":          "127.0.0.1",
+	}
+	payload["vnp_SecureHash"] = hmacSHA512(p.hashSecret, strings.Join([]string{
+		payload["vnp_RequestId"], payload["vnp_Version"], payload["vnp_Command"], payload["vnp_TmnCode"],
+		payload["vnp_TxnRef"], payload["vnp_TransactionDate"], payload["vnp_CreateDate"],
+		payload["vnp_IpAddr"], payload["vnp_OrderInfo"],
+	}, "|"))
+
+	resp, err := p.post(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{OrderRef: req.OrderRef, Raw: resp}
+	result.Amount = int64(number(resp["vnp_Amount"])) / 100
+	result.TransID, _ = resp["vnp_TransactionNo"].(string)
+	result.Message, _ = resp["vnp_Message"].(string)
+
+	if code, _ := resp["vnp_ResponseCode"].(string); code != "00" {
+		return nil, errors.New("VNPay querydr lỗi: " + code + " " + result.Message)
+	}
+	// vnp_TransactionStatus: 00 thành công, 01 chưa hoàn tất, 05/06 đã hoàn tiền
+	switch status, _ := resp["vnp_TransactionStatus"].(string); status {
+	case "00":
+		result.Status = StatusPaid
+	case "01":
+		result.Status = StatusPending
+	case "05", "06":
+		result.Status = StatusRefunded
+	default:
+		result.Status = StatusFailed
+	}
+	return result, nil
+}
+
+func (p *vnpayProvider) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	now := time.Now().In(vietnamTime)
+	transactionType := "02" // hoàn toàn phần
+	if req.Amount < req.OriginalAmount {
+		transactionType = "03"
+	}
+	createBy := req.RequestedBy
+	if createBy == "" {
+		createBy = "system"
+	}
+	payload := map[string]string{
+		"vnp_RequestId":       req.RefundRef,
+		"vnp_Version":         "2.1.0",
+		"vnp_Command":         "refund",
+		"vnp_TmnCode":         p.tmnCode,
+		"vnp_TransactionType": transactionType,
+		"vnp_TxnRef":          req.OrderRef,
+		"vnp_Amount":          strconv.FormatInt(req.Amount*100, 10),
+		"vnp_TransactionNo":   req.TransID,
+		"vnp_TransactionDate": req.CreatedAt.In(vietnamTime).Format(vnpayDateLayout),
+		"vnp_CreateBy":        createBy,
+		"vnp_CreateDate":      now.Format(vnpayDateLayout),
+		"vnp_IpAddr":          "127.0.0.1",
+		"vnp_OrderInfo":       req.Reason,
+	}
+	payload["vnp_SecureHash"] = hmacSHA512(p.hashSecret, strings.Join([]string{
+		payload["vnp_RequestId"], payload["vnp_Version"], payload["vnp_Command"], payload["vnp_TmnCode"],
+		payload["vnp_TransactionType"], payload["vnp_TxnRef"], payload["vnp_Amount"],
+		payload["vnp_TransactionNo"], payload["vnp_TransactionDate"], payload["vnp_CreateBy"],
+		payload["vnp_CreateDate"], payload["vnp_IpAddr"], payload["vnp_OrderInfo"],
+	}, "|"))
+
+	resp, err := p.post(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RefundResult{RefundRef: req.RefundRef, Status: StatusFailed, Raw: resp}
+	result.Message, _ = resp["vnp_Message"].(string)
+	if code, _ := resp["vnp_ResponseCode"].(string); code == "00" {
+		result.Status = StatusRefunded
+	}
+	return result, nil
+}
+
+// QueryRefund tra cứu giao dịch gốc bằng querydr: giao dịch hoàn tiền
+// (vnp_TransactionType 02/03) thành công có trạng thái 00, đang xử lý 05/06,
+// bị từ chối 09.
+func (p *vnpayProvider) QueryRefund(ctx context.Context, req RefundQueryRequest) (*RefundResult, error) {
+	query, err := p.QueryStatus(ctx, QueryRequest{OrderRef: req.OrderRef, TransID: req.TransID, CreatedAt: req.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RefundResult{RefundRef: req.RefundRef, Status: StatusPending, Message: query.Message, Raw: query.Raw}
+	transactionType, _ := query.Raw["vnp_TransactionType"].(string)
+	switch status, _ := query.Raw["vnp_TransactionStatus"].(string); {
+	case status == "00" && (transactionType == "02" || transactionType == "03"):
+		result.Status = StatusRefunded
+	case status == "09":
+		result.Status = StatusFailed
+	}
+	return result, nil
+}
+
+func (p *vnpayProvider) post(ctx context.Context, payload map[string]string) (map[string]interface{}, error) {
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.apiURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(req)
+}
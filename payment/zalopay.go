@@ -0,0 +1,250 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type zalopayProvider struct {
+	appID       string
+	key1        string
+	key2        string
+	endpoint    string
+	callbackURL string
+	redirectURL string
+}
+
+func newZaloPay(cfg map[string]string) *zalopayProvider {
+	return &zalopayProvider{
+		appID:       cfg["APP_ID"],
+		key1:        cfg["KEY1"],
+		key2:        cfg["KEY2"],
+		endpoint:    cfg["ENDPOINT"],
+		callbackURL: cfg["CALLBACK_URL"],
+		redirectURL: cfg["REDIRECT_URL"],
+	}
+}
+
+func (p *zalopayProvider) configured() bool {
+	return p.appID != "" && p.key1 != "" && p.key2 != ""
+}
+
+func (p *zalopayProvider) Name() string            { return ZaloPay }
+func (p *zalopayProvider) SupportsExtraData() bool { return true }
+
+// zalopayEmbedData được ZaloPay trả lại nguyên vẹn trong callback.
+type zalopayEmbedData struct {
+	RedirectURL string `json:"redirecturl,omitempty"`
+	ExtraData   string `json:"extraData,omitempty"`
+}
+
+// zalopayTransID: app_trans_id bắt buộc có tiền tố yymmdd theo giờ Việt Nam.
+func zalopayTransID(ref string) string {
+	prefix := time.Now().In(vietnamTime).Format("060102") + "_"
+	if strings.HasPrefix(ref, prefix) {
+		return ref
+	}
+	return prefix + ref
+}
+
+func (p *zalopayProvider) CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error) {
+	appTransID := zalopayTransID(req.OrderRef)
+	appTime := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	embed, _ := json.Marshal(zalopayEmbedData{RedirectURL: p.redirectURL, ExtraData: req.ExtraData})
+	item := "[]"
+	appUser := "movie-ticket"
+	amount := strconv.FormatInt(req.Amount, 10)
+
+	form := url.Values{}
+	form.Set("app_id", p.appID)
+	form.Set("app_user", appUser)
+	form.Set("app_trans_id", appTransID)
+	form.Set("app_time", appTime)
+	form.Set("amount", amount)
+	form.Set("item", item)
+	form.Set("embed_data", string(embed))
+	form.Set("description", req.OrderInfo)
+	form.Set("bank_code", "")
+	form.Set("callback_url", p.callbackURL)
+	form.Set("mac", hmacSHA256(p.key1, strings.Join([]string{
+		p.appID, appTransID, appUser, amount, appTime, string(embed), item,
+	}, "|")))
+
+	resp, err := p.post(ctx, "/create", form)
+	if err != nil {
+		return nil, err
+	}
+	orderURL, _ := resp["order_url"].(string)
+	if int(number(resp["return_code"])) != 1 || orderURL == "" {
+		return nil, fmt.Errorf("ZaloPay tạo đơn thất bại: %v", resp["return_message"])
+	}
+	return &CreateResult{PayURL: orderURL, OrderRef: appTransID, Raw: resp}, nil
+}
+
+// VerifyCallback đọc callback {data, mac, type}; mac = HMAC-SHA256(key2, data).
+// ZaloPay chỉ gửi callback khi thanh toán thành công.
+func (p *zalopayProvider) VerifyCallback(r *http.Request) (*CallbackResult, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	var callback struct {
+		Data string `json:"data"`
+		Mac  string `json:"mac"`
+	}
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return nil, err
+	}
+	if !equalSignature(hmacSHA256(p.key2, callback.Data), callback.Mac) {
+		return nil, ErrInvalidSignature
+	}
+
+	var data struct {
+		AppID      json.Number `json:"app_id"`
+		AppTransID string      `json:"app_trans_id"`
+		Amount     int64       `json:"amount"`
+		EmbedData  string      `json:"embed_data"`
+		ZpTransID  json.Number `json:"zp_trans_id"`
+	}
+	if err := json.Unmarshal([]byte(callback.Data), &data); err != nil {
+		return nil, err
+	}
+	if data.AppID.String() != p.appID {
+		return nil, ErrInvalidSignature
+	}
+
+	var embed zalopayEmbedData
+	_ = json.Unmarshal([]byte(data.EmbedData), &embed)
+	var raw map[string]interface{}
+	_ = json.Unmarshal([]byte(callback.Data), &raw)
+
+	return &CallbackResult{
+		OrderRef:  data.AppTransID,
+		TransID:   data.ZpTransID.String(),
+		Amount:    data.Amount,
+		Status:    StatusPaid,
+		ExtraData: embed.ExtraData,
+		Raw:       raw,
+	}, nil
+}
+
+// Ack: return_code 1 = thành công, 0 = ZaloPay gửi lại callback, -1 = từ chối.
+func (p *zalopayProvider) Ack(outcome AckOutcome) (int, interface{}) {
+	switch outcome {
+	case AckOK:
+		return http.StatusOK, map[string]interface{}{"return_code": 1, "return_message": "success"}
+	case AckRetry:
+		return http.StatusOK, map[string]interface{}{"return_code": 0, "return_message": "retry"}
+	case AckInvalidSignature:
+		return http.StatusOK, map[string]interface{}{"return_code": -1, "return_message": "mac not equal"}
+	default:
+		return http.StatusOK, map[string]interface{}{"return_code": -1, "return_message": "rejected"}
+	}
+}
+
+func (p *zalopayProvider) QueryStatus(ctx context.Context, req QueryRequest) (*QueryResult, error) {
+	form := url.Values{}
+	form.Set("app_id", p.appID)
+	form.Set("app_trans_id", req.OrderRef)
+	form.Set("mac", hmacSHA256(p.key1, p.appID+"|"+req.OrderRef+"|"+p.key1))
+
+	resp, err := p.post(ctx, "/query", form)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{OrderRef: req.OrderRef, Raw: resp}
+	result.Amount = int64(number(resp["amount"]))
+	if zpTransID := int64(number(resp["zp_trans_id"])); zpTransID != 0 {
+		result.TransID = strconv.FormatInt(zpTransID, 10)
+	}
+	result.Message, _ = resp["return_message"].(string)
+
+	// 1: thành công, 2: thất bại, 3: đang xử lý/chưa thanh toán
+	switch int(number(resp["return_code"])) {
+	case 1:
+		result.Status = StatusPaid
+	case 3:
+		result.Status = StatusPending
+	default:
+		result.Status = StatusFailed
+	}
+	return result, nil
+}
+
+func (p *zalopayProvider) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	// m_refund_id có dạng yymmdd_appid_xxx
+	refundID := time.Now().In(vietnamTime).Format("060102") + "_" + p.appID + "_" + req.RefundRef
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	amount := strconv.FormatInt(req.Amount, 10)
+
+	form := url.Values{}
+	form.Set("m_refund_id", refundID)
+	form.Set("app_id", p.appID)
+	form.Set("zp_trans_id", req.TransID)
+	form.Set("amount", amount)
+	form.Set("timestamp", timestamp)
+	form.Set("description", req.Reason)
+	form.Set("mac", hmacSHA256(p.key1, strings.Join([]string{
+		p.appID, req.TransID, amount, req.Reason, timestamp,
+	}, "|")))
+
+	resp, err := p.post(ctx, "/refund", form)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RefundResult{RefundRef: refundID, Raw: resp}
+	result.Message, _ = resp["return_message"].(string)
+	switch int(number(resp["return_code"])) {
+	case 1:
+		result.Status = StatusRefunded
+	case 3:
+		result.Status = StatusPending
+	default:
+		result.Status = StatusFailed
+	}
+	return result, nil
+}
+
+func (p *zalopayProvider) QueryRefund(ctx context.Context, req RefundQueryRequest) (*RefundResult, error) {
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	form := url.Values{}
+	form.Set("app_id", p.appID)
+	form.Set("m_refund_id", req.RefundRef)
+	form.Set("timestamp", timestamp)
+	form.Set("mac", hmacSHA256(p.key1, p.appID+"|"+req.RefundRef+"|"+timestamp))
+
+	resp, err := p.post(ctx, "/query_refund", form)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RefundResult{RefundRef: req.RefundRef, Raw: resp}
+	result.Message, _ = resp["return_message"].(string)
+	// 1: thành công, 2: thất bại, 3: đang xử lý
+	switch int(number(resp["return_code"])) {
+	case 1:
+		result.Status = StatusRefunded
+	case 3:
+		result.Status = StatusPending
+	default:
+		result.Status = StatusFailed
+	}
+	return result, nil
+}
+
+func (p *zalopayProvider) post(ctx context.Context, path string, form url.Values) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doJSON(req)
+}
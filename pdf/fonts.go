@@ -0,0 +1,23 @@
+package pdf
+
+import _ "embed"
+
+// Open Sans (Apache License 2.0, xem fonts/LICENSE.txt) có đủ chữ tiếng Việt,
+// được nhúng vào binary để PDF luôn giữ dấu kể cả khi không cấu hình font.
+var (
+	//go:embed fonts/OpenSans-Regular.ttf
+	openSansRegular []byte
+	//go:embed fonts/OpenSans-Bold.ttf
+	openSansBold []byte
+)
+
+// DefaultFonts trả về font thường và font đậm nhúng sẵn.
+func DefaultFonts() (regular, bold *Font, err error) {
+	if regular, err = ParseFont(openSansRegular); err != nil {
+		return nil, nil, err
+	}
+	if bold, err = ParseFont(openSansBold); err != nil {
+		return nil, nil, err
+	}
+	return regular, bold, nil
+}
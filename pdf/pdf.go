@@ -0,0 +1,287 @@
+// Package pdf là bộ dựng file PDF tối giản, thuần Go, đủ cho vé điện tử và hóa
+// đơn: chữ, đường kẻ, khung và ảnh (QR).
+//
+// Chữ dùng font TrueType được nạp qua SetFonts (nhúng phần glyph đã dùng, giữ
+// nguyên dấu tiếng Việt). Nếu không có font, tài liệu dùng Helvetica chuẩn của
+// PDF, chỉ có bảng mã WinAnsi nên chữ tiếng Việt bị bỏ dấu ("Hóa đơn" thành
+// "Hoa don").
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Kích thước trang A4 theo point (1/72 inch).
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document là một file PDF gồm nhiều trang.
+type Document struct {
+	pages  []*Page
+	images []image.Image
+	fonts  [2]*embeddedFont // thường, đậm; nil = Helvetica
+}
+
+// embeddedFont ghi lại các glyph đã dùng của font để nhúng và tạo ToUnicode.
+type embeddedFont struct {
+	*Font
+	used map[uint16]rune
+}
+
+// Page là một trang; tọa độ tính từ góc trên bên trái, đơn vị point.
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+	images  []int // chỉ số ảnh trong doc.images dùng ở trang này
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+// SetFonts dùng font TrueType cho chữ thường và chữ đậm. bold nil thì chữ đậm
+// dùng chung font thường.
+func (d *Document) SetFonts(regular, bold *Font) {
+	if regular == nil {
+		return
+	}
+	d.fonts[0] = &embeddedFont{Font: regular, used: map[uint16]rune{}}
+	d.fonts[1] = d.fonts[0]
+	if bold != nil && bold != regular {
+		d.fonts[1] = &embeddedFont{Font: bold, used: map[uint16]rune{}}
+	}
+}
+
+func (d *Document) font(bold bool) *embeddedFont {
+	if bold {
+		return d.fonts[1]
+	}
+	return d.fonts[0]
+}
+
+// TextWidth đo độ rộng của s theo font của tài liệu.
+func (d *Document) TextWidth(s string, size float64, bold bool) float64 {
+	f := d.font(bold)
+	if f == nil {
+		return TextWidth(s, size)
+	}
+	total := 0
+	for _, r := range s {
+		total += f.width(f.glyph(r))
+	}
+	return float64(total) * size / 1000
+}
+
+// encode chuyển s thành chuỗi hex các glyph (Identity-H) và ghi nhận glyph đã
+// dùng.
+func (f *embeddedFont) encode(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		if r == '\n' || r == '\t' {
+			r = ' '
+		}
+		gid := f.glyph(r)
+		f.used[gid] = r
+		fmt.Fprintf(&b, "%04X", gid)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// AddPage thêm một trang A4 mới.
+func (d *Document) AddPage() *Page {
+	p := &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+func num(f float64) string {
+	s := fmt.Sprintf("%.2f", f)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-" {
+		return "0"
+	}
+	return s
+}
+
+// Text viết s tại (x, y) với y là đường chân chữ.
+func (p *Page) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	text := "(" + escape(toWinAnsi(s)) + ")"
+	if f := p.doc.font(bold); f != nil {
+		text = f.encode(s)
+	}
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td %s Tj ET\n",
+		font, num(size), num(x), num(PageHeight-y), text)
+}
+
+// TextRight viết s căn phải tại x.
+func (p *Page) TextRight(x, y, size float64, bold bool, s string) {
+	p.Text(x-p.doc.TextWidth(s, size, bold), y, size, bold, s)
+}
+
+// TextCenter viết s căn giữa tại x.
+func (p *Page) TextCenter(x, y, size float64, bold bool, s string) {
+	p.Text(x-p.doc.TextWidth(s, size, bold)/2, y, size, bold, s)
+}
+
+// Line kẻ đoạn thẳng từ (x1, y1) đến (x2, y2).
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n",
+		num(width), num(x1), num(PageHeight-y1), num(x2), num(PageHeight-y2))
+}
+
+// Rect vẽ khung chữ nhật có góc trên bên trái tại (x, y).
+func (p *Page) Rect(x, y, w, h, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s %s %s re S\n",
+		num(width), num(x), num(PageHeight-y-h), num(w), num(h))
+}
+
+// FillRect tô nền xám (gray: 0 đen, 1 trắng) cho hình chữ nhật.
+func (p *Page) FillRect(x, y, w, h, gray float64) {
+	fmt.Fprintf(&p.content, "q %s g %s %s %s %s re f Q\n",
+		num(gray), num(x), num(PageHeight-y-h), num(w), num(h))
+}
+
+// Image vẽ ảnh (chuyển sang ảnh xám) vào khung có góc trên bên trái (x, y).
+func (p *Page) Image(img image.Image, x, y, w, h float64) {
+	p.doc.images = append(p.doc.images, img)
+	idx := len(p.doc.images) - 1
+	p.images = append(p.images, idx)
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm /Im%d Do Q\n",
+		num(w), num(h), num(x), num(PageHeight-y-h), idx+1)
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func grayPixels(img image.Image) (int, int, []byte) {
+	b := img.Bounds()
+	pixels := make([]byte, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			pixels = append(pixels, byte((299*r+587*g+114*bl)/1000>>8))
+		}
+	}
+	return b.Dx(), b.Dy(), pixels
+}
+
+// Bytes xuất file PDF.
+func (d *Document) Bytes() ([]byte, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string, stream []byte) int {
+		offsets = append(offsets, out.Len())
+		id := len(offsets)
+		fmt.Fprintf(&out, "%d 0 obj\n%s\n", id, body)
+		if stream != nil {
+			out.WriteString("stream\n")
+			out.Write(stream)
+			out.WriteString("\nendstream\n")
+		}
+		out.WriteString("endobj\n")
+		return id
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1: Catalog, 2: Pages (tham chiếu trước, ghi nội dung cố định số đối tượng)
+	firstPage := 5 + len(d.images)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)), nil)
+
+	// 3, 4: font thường/đậm. Font nhúng có các đối tượng phụ (CIDFont,
+	// FontDescriptor, FontFile2, ToUnicode) ghi sau các trang.
+	fontObjects := map[*embeddedFont]int{}
+	next := 5 + len(d.images) + 2*len(d.pages)
+	for _, f := range d.fonts {
+		if _, ok := fontObjects[f]; f != nil && !ok {
+			fontObjects[f] = next
+			next += 4
+		}
+	}
+	for i, base := range []string{"Helvetica", "Helvetica-Bold"} {
+		f := d.fonts[i]
+		if f == nil {
+			obj(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", base), nil)
+			continue
+		}
+		id := fontObjects[f]
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+			f.baseFont(), id, id+3), nil)
+	}
+
+	for _, img := range d.images {
+		w, h, pixels := grayPixels(img)
+		data := deflate(pixels)
+		obj(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+			w, h, len(data)), data)
+	}
+
+	for _, p := range d.pages {
+		var xobjects []string
+		for _, idx := range p.images {
+			xobjects = append(xobjects, fmt.Sprintf("/Im%d %d 0 R", idx+1, 5+idx))
+		}
+		resources := "<< /Font << /F1 3 0 R /F2 4 0 R >>"
+		if len(xobjects) > 0 {
+			resources += " /XObject << " + strings.Join(xobjects, " ") + " >>"
+		}
+		resources += " >>"
+		contentID := len(offsets) + 2
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources %s /Contents %d 0 R >>",
+			num(PageWidth), num(PageHeight), resources, contentID), nil)
+
+		data := deflate(p.content.Bytes())
+		obj(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>", len(data)), data)
+	}
+
+	for i, f := range d.fonts {
+		if f == nil || (i == 1 && f == d.fonts[0]) {
+			continue
+		}
+		id := fontObjects[f]
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /W [%s] /CIDToGIDMap /Identity >>",
+			f.baseFont(), id+1, f.widthArray()), nil)
+		obj(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+			f.baseFont(), f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+			f.scale(f.ascent), f.scale(f.descent), f.scale(f.ascent), id+2), nil)
+		font := f.subset(f.used)
+		data := deflate(font)
+		obj(fmt.Sprintf("<< /Length %d /Length1 %d /Filter /FlateDecode >>", len(data), len(font)), data)
+		data = deflate(f.toUnicode())
+		obj(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>", len(data)), data)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
@@ -0,0 +1,78 @@
+package pdf
+
+import "strings"
+
+// Độ rộng ký tự ASCII 32..126 của Helvetica (phần nghìn em), dùng để căn lề.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// TextWidth ước lượng độ rộng của s khi viết bằng Helvetica cỡ size. Tài liệu
+// có font nhúng dùng Document.TextWidth.
+func TextWidth(s string, size float64) float64 {
+	total := 0
+	for _, c := range toWinAnsi(s) {
+		if c >= 32 && c <= 126 {
+			total += helveticaWidths[c-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+var vietnameseFold = map[rune]rune{}
+
+func init() {
+	groups := map[rune]string{
+		'a':  "àáảãạăằắẳẵặâầấẩẫậ",
+		'A':  "ÀÁẢÃẠĂẰẮẲẴẶÂẦẤẨẪẬ",
+		'e':  "èéẻẽẹêềếểễệ",
+		'E':  "ÈÉẺẼẸÊỀẾỂỄỆ",
+		'i':  "ìíỉĩị",
+		'I':  "ÌÍỈĨỊ",
+		'o':  "òóỏõọôồốổỗộơờớởỡợ",
+		'O':  "ÒÓỎÕỌÔỒỐỔỖỘƠỜỚỞỠỢ",
+		'u':  "ùúủũụưừứửữự",
+		'U':  "ÙÚỦŨỤƯỪỨỬỮỰ",
+		'y':  "ỳýỷỹỵ",
+		'Y':  "ỲÝỶỸỴ",
+		'd':  "đ",
+		'D':  "Đ",
+		'-':  "–—",
+		'"':  "“”",
+		'\'': "‘’",
+	}
+	for base, chars := range groups {
+		for _, c := range chars {
+			vietnameseFold[c] = base
+		}
+	}
+}
+
+// toWinAnsi bỏ dấu tiếng Việt cho Helvetica (khi không có font nhúng), ký tự không biểu diễn được thay bằng "?".
+func toWinAnsi(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c == '\n' || c == '\t':
+			b.WriteByte(' ')
+		case c < 128:
+			b.WriteRune(c)
+		case vietnameseFold[c] != 0:
+			b.WriteRune(vietnameseFold[c])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
@@ -0,0 +1,534 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+var ErrUnsupportedFont = errors.New("chỉ hỗ trợ font TrueType (bảng glyf)")
+
+// Font là font TrueType dùng để viết chữ Unicode (tiếng Việt có dấu). Khi xuất
+// PDF chỉ nhúng các glyph đã dùng (subset).
+type Font struct {
+	name       string
+	tables     map[string][]byte
+	unitsPerEm int
+	ascent     int
+	descent    int
+	bbox       [4]int
+	numGlyphs  int
+	advances   []int
+	loca       []int
+	cmap       map[rune]uint16
+}
+
+// LoadFont đọc font TrueType (.ttf) từ file.
+func LoadFont(path string) (*Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFont(data)
+}
+
+// ParseFont đọc các bảng cần cho việc đo chữ và nhúng font.
+func ParseFont(data []byte) (*Font, error) {
+	if len(data) < 12 {
+		return nil, ErrUnsupportedFont
+	}
+	if version := binary.BigEndian.Uint32(data); version != 0x00010000 && version != 0x74727565 {
+		return nil, ErrUnsupportedFont
+	}
+
+	f := &Font{tables: map[string][]byte{}}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, fmt.Errorf("font hỏng: bảng thứ %d nằm ngoài file", i)
+		}
+		tag := string(data[rec : rec+4])
+		offset := int(binary.BigEndian.Uint32(data[rec+8:]))
+		length := int(binary.BigEndian.Uint32(data[rec+12:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, fmt.Errorf("font hỏng: bảng %q nằm ngoài file", tag)
+		}
+		f.tables[tag] = data[offset : offset+length]
+	}
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "loca", "glyf", "cmap"} {
+		if _, ok := f.tables[tag]; !ok {
+			if tag == "glyf" || tag == "loca" {
+				return nil, ErrUnsupportedFont
+			}
+			return nil, fmt.Errorf("font thiếu bảng %q", tag)
+		}
+	}
+
+	head, hhea, maxp := f.tables["head"], f.tables["hhea"], f.tables["maxp"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 {
+		return nil, errors.New("font hỏng: bảng head/hhea/maxp quá ngắn")
+	}
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	if f.unitsPerEm == 0 {
+		return nil, errors.New("font hỏng: unitsPerEm = 0")
+	}
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	f.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	f.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+	f.numGlyphs = int(binary.BigEndian.Uint16(maxp[4:]))
+
+	if err := f.parseMetrics(int(binary.BigEndian.Uint16(hhea[34:]))); err != nil {
+		return nil, err
+	}
+	if err := f.parseLoca(int(int16(binary.BigEndian.Uint16(head[50:])))); err != nil {
+		return nil, err
+	}
+	if err := f.parseCmap(); err != nil {
+		return nil, err
+	}
+	f.name = f.postScriptName()
+	return f, nil
+}
+
+func (f *Font) parseMetrics(numberOfHMetrics int) error {
+	hmtx := f.tables["hmtx"]
+	if numberOfHMetrics == 0 || len(hmtx) < 4*numberOfHMetrics {
+		return errors.New("font hỏng: bảng hmtx quá ngắn")
+	}
+	f.advances = make([]int, f.numGlyphs)
+	for gid := range f.advances {
+		i := gid
+		if i >= numberOfHMetrics {
+			i = numberOfHMetrics - 1
+		}
+		f.advances[gid] = int(binary.BigEndian.Uint16(hmtx[4*i:]))
+	}
+	return nil
+}
+
+func (f *Font) parseLoca(format int) error {
+	loca := f.tables["loca"]
+	f.loca = make([]int, f.numGlyphs+1)
+	for i := range f.loca {
+		if format == 0 {
+			if 2*i+2 > len(loca) {
+				return errors.New("font hỏng: bảng loca quá ngắn")
+			}
+			f.loca[i] = 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+		} else {
+			if 4*i+4 > len(loca) {
+				return errors.New("font hỏng: bảng loca quá ngắn")
+			}
+			f.loca[i] = int(binary.BigEndian.Uint32(loca[4*i:]))
+		}
+	}
+	glyf := f.tables["glyf"]
+	for i := 1; i < len(f.loca); i++ {
+		if f.loca[i] < f.loca[i-1] || f.loca[i] > len(glyf) {
+			return errors.New("font hỏng: bảng loca không hợp lệ")
+		}
+	}
+	return nil
+}
+
+// parseCmap đọc bảng mã Unicode: ưu tiên format 12 (đủ mọi ký tự), sau đó
+// format 4 (BMP, đủ cho tiếng Việt).
+func (f *Font) parseCmap() error {
+	cmap := f.tables["cmap"]
+	if len(cmap) < 4 {
+		return errors.New("font hỏng: bảng cmap quá ngắn")
+	}
+	var format4, format12 []byte
+	count := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < count; i++ {
+		rec := 4 + 8*i
+		if rec+8 > len(cmap) {
+			break
+		}
+		platform := binary.BigEndian.Uint16(cmap[rec:])
+		encoding := binary.BigEndian.Uint16(cmap[rec+2:])
+		offset := int(binary.BigEndian.Uint32(cmap[rec+4:]))
+		if offset+4 > len(cmap) || !(platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))) {
+			continue
+		}
+		switch binary.BigEndian.Uint16(cmap[offset:]) {
+		case 4:
+			format4 = cmap[offset:]
+		case 12:
+			format12 = cmap[offset:]
+		}
+	}
+
+	f.cmap = map[rune]uint16{}
+	switch {
+	case format12 != nil:
+		return f.parseCmap12(format12)
+	case format4 != nil:
+		return f.parseCmap4(format4)
+	}
+	return errors.New("font không có bảng mã Unicode")
+}
+
+func (f *Font) parseCmap4(sub []byte) error {
+	if len(sub) < 14 {
+		return errors.New("font hỏng: cmap format 4 quá ngắn")
+	}
+	segCount := int(binary.BigEndian.Uint16(sub[6:])) / 2
+	endCodes := 14
+	startCodes := endCodes + 2*segCount + 2
+	idDeltas := startCodes + 2*segCount
+	idRangeOffsets := idDeltas + 2*segCount
+	if idRangeOffsets+2*segCount > len(sub) {
+		return errors.New("font hỏng: cmap format 4 quá ngắn")
+	}
+	for i := 0; i < segCount; i++ {
+		end := int(binary.BigEndian.Uint16(sub[endCodes+2*i:]))
+		start := int(binary.BigEndian.Uint16(sub[startCodes+2*i:]))
+		delta := int(binary.BigEndian.Uint16(sub[idDeltas+2*i:]))
+		rangeOffset := int(binary.BigEndian.Uint16(sub[idRangeOffsets+2*i:]))
+		for c := start; c <= end && c != 0xFFFF; c++ {
+			gid := 0
+			if rangeOffset == 0 {
+				gid = (c + delta) & 0xFFFF
+			} else {
+				addr := idRangeOffsets + 2*i + rangeOffset + 2*(c-start)
+				if addr+2 > len(sub) {
+					continue
+				}
+				if gid = int(binary.BigEndian.Uint16(sub[addr:])); gid != 0 {
+					gid = (gid + delta) & 0xFFFF
+				}
+			}
+			if gid != 0 && gid < f.numGlyphs {
+				f.cmap[rune(c)] = uint16(gid)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Font) parseCmap12(sub []byte) error {
+	if len(sub) < 16 {
+		return errors.New("font hỏng: cmap format 12 quá ngắn")
+	}
+	groups := int(binary.BigEndian.Uint32(sub[12:]))
+	if 16+12*groups > len(sub) {
+		return errors.New("font hỏng: cmap format 12 quá ngắn")
+	}
+	for i := 0; i < groups; i++ {
+		g := sub[16+12*i:]
+		start := binary.BigEndian.Uint32(g)
+		end := binary.BigEndian.Uint32(g[4:])
+		startGlyph := binary.BigEndian.Uint32(g[8:])
+		if end > 0x10FFFF || end < start {
+			continue
+		}
+		for c := start; c <= end && startGlyph+(c-start) < uint32(f.numGlyphs); c++ {
+			f.cmap[rune(c)] = uint16(startGlyph + (c - start))
+		}
+	}
+	return nil
+}
+
+// postScriptName đọc tên PostScript (nameID 6), chỉ giữ ký tự hợp lệ trong
+// tên font PDF.
+func (f *Font) postScriptName() string {
+	name := f.tables["name"]
+	if len(name) >= 6 {
+		count := int(binary.BigEndian.Uint16(name[2:]))
+		storage := int(binary.BigEndian.Uint16(name[4:]))
+		for i := 0; i < count; i++ {
+			rec := 6 + 12*i
+			if rec+12 > len(name) {
+				break
+			}
+			platform := binary.BigEndian.Uint16(name[rec:])
+			if binary.BigEndian.Uint16(name[rec+6:]) != 6 {
+				continue
+			}
+			length := int(binary.BigEndian.Uint16(name[rec+8:]))
+			offset := storage + int(binary.BigEndian.Uint16(name[rec+10:]))
+			if offset+length > len(name) {
+				continue
+			}
+			raw := name[offset : offset+length]
+			var s string
+			if platform == 0 || platform == 3 {
+				units := make([]uint16, len(raw)/2)
+				for j := range units {
+					units[j] = binary.BigEndian.Uint16(raw[2*j:])
+				}
+				s = string(utf16.Decode(units))
+			} else {
+				s = string(raw)
+			}
+			s = strings.Map(func(r rune) rune {
+				if r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' {
+					return r
+				}
+				return -1
+			}, s)
+			if s != "" {
+				return s
+			}
+		}
+	}
+	return "EmbeddedFont"
+}
+
+// glyph trả về glyph của ký tự, 0 (.notdef) nếu font không có.
+func (f *Font) glyph(r rune) uint16 {
+	return f.cmap[r]
+}
+
+// width là độ rộng glyph theo phần nghìn em, đơn vị của PDF.
+func (f *Font) width(gid uint16) int {
+	if int(gid) >= len(f.advances) {
+		return 0
+	}
+	return f.advances[gid] * 1000 / f.unitsPerEm
+}
+
+func (f *Font) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
+
+func (f *Font) glyphData(gid int) []byte {
+	return f.tables["glyf"][f.loca[gid]:f.loca[gid+1]]
+}
+
+// Cờ của glyph ghép trong bảng glyf.
+const (
+	glyphArgWords     = 0x0001
+	glyphHaveScale    = 0x0008
+	glyphMoreParts    = 0x0020
+	glyphXYScale      = 0x0040
+	glyphTwoByTwo     = 0x0080
+	glyphHeaderLength = 10
+)
+
+// components trả về các glyph con của một glyph ghép (ví dụ "ế" ghép từ "e" và
+// dấu).
+func (f *Font) components(gid int) []int {
+	data := f.glyphData(gid)
+	if len(data) < glyphHeaderLength || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return nil
+	}
+	var parts []int
+	for pos := glyphHeaderLength; pos+4 <= len(data); {
+		flags := binary.BigEndian.Uint16(data[pos:])
+		parts = append(parts, int(binary.BigEndian.Uint16(data[pos+2:])))
+		pos += 4
+		if flags&glyphArgWords != 0 {
+			pos += 4
+		} else {
+			pos += 2
+		}
+		switch {
+		case flags&glyphHaveScale != 0:
+			pos += 2
+		case flags&glyphXYScale != 0:
+			pos += 4
+		case flags&glyphTwoByTwo != 0:
+			pos += 8
+		}
+		if flags&glyphMoreParts == 0 {
+			break
+		}
+	}
+	return parts
+}
+
+// subsetTag là tiền tố 6 chữ in hoa PDF yêu cầu cho font đã cắt bớt.
+func subsetTag(used map[uint16]rune) string {
+	gids := make([]int, 0, len(used))
+	for gid := range used {
+		gids = append(gids, int(gid))
+	}
+	sort.Ints(gids)
+	h := crc32.NewIEEE()
+	for _, gid := range gids {
+		binary.Write(h, binary.BigEndian, uint16(gid))
+	}
+	sum := h.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + byte(sum%26)
+		sum /= 26
+	}
+	return string(tag)
+}
+
+// subset tạo file font chỉ giữ dữ liệu của các glyph đã dùng (kèm glyph con
+// và .notdef). Chỉ số glyph giữ nguyên để dùng CIDToGIDMap /Identity.
+func (f *Font) subset(used map[uint16]rune) []byte {
+	keep := map[int]bool{0: true}
+	queue := []int{0}
+	for gid := range used {
+		queue = append(queue, int(gid))
+	}
+	for len(queue) > 0 {
+		gid := queue[0]
+		queue = queue[1:]
+		if gid >= f.numGlyphs {
+			continue
+		}
+		keep[gid] = true
+		for _, part := range f.components(gid) {
+			if !keep[part] {
+				keep[part] = true
+				queue = append(queue, part)
+			}
+		}
+	}
+
+	var glyf bytes.Buffer
+	loca := make([]byte, 4*(f.numGlyphs+1))
+	for gid := 0; gid < f.numGlyphs; gid++ {
+		binary.BigEndian.PutUint32(loca[4*gid:], uint32(glyf.Len()))
+		if keep[gid] {
+			glyf.Write(f.glyphData(gid))
+			for glyf.Len()%4 != 0 {
+				glyf.WriteByte(0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*f.numGlyphs:], uint32(glyf.Len()))
+
+	head := append([]byte(nil), f.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0)  // checkSumAdjustment tính lại bên dưới
+	binary.BigEndian.PutUint16(head[50:], 1) // loca dạng 32 bit
+
+	tables := map[string][]byte{
+		"head": head,
+		"hhea": f.tables["hhea"],
+		"maxp": f.tables["maxp"],
+		"hmtx": f.tables["hmtx"],
+		"loca": loca,
+		"glyf": glyf.Bytes(),
+	}
+	for _, tag := range []string{"cvt ", "fpgm", "prep"} {
+		if t, ok := f.tables[tag]; ok {
+			tables[tag] = t
+		}
+	}
+
+	out := writeFontTables(tables)
+	numTables := int(binary.BigEndian.Uint16(out[4:]))
+	for i := 0; i < numTables; i++ {
+		rec := out[12+16*i:]
+		if string(rec[:4]) == "head" {
+			offset := binary.BigEndian.Uint32(rec[8:])
+			binary.BigEndian.PutUint32(out[offset+8:], 0xB1B0AFBA-fontChecksum(out))
+			break
+		}
+	}
+	return out
+}
+
+func fontChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// writeFontTables ghép các bảng thành file TrueType, bảng sắp theo tag.
+func writeFontTables(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	n := len(tags)
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= n {
+		searchRange *= 2
+		entrySelector++
+	}
+	searchRange *= 16
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, []uint16{0x0001, 0x0000, uint16(n), uint16(searchRange), uint16(entrySelector), uint16(n*16 - searchRange)})
+
+	offset := 12 + 16*n
+	for _, tag := range tags {
+		data := tables[tag]
+		out.WriteString(tag)
+		binary.Write(&out, binary.BigEndian, []uint32{fontChecksum(data), uint32(offset), uint32(len(data))})
+		offset += (len(data) + 3) &^ 3
+	}
+	for _, tag := range tags {
+		out.Write(tables[tag])
+		for out.Len()%4 != 0 {
+			out.WriteByte(0)
+		}
+	}
+	return out.Bytes()
+}
+
+func (f *embeddedFont) sortedGlyphs() []int {
+	gids := make([]int, 0, len(f.used))
+	for gid := range f.used {
+		gids = append(gids, int(gid))
+	}
+	sort.Ints(gids)
+	return gids
+}
+
+func (f *embeddedFont) baseFont() string {
+	return subsetTag(f.used) + "+" + f.name
+}
+
+// widthArray là mảng /W của CIDFont cho các glyph đã dùng.
+func (f *embeddedFont) widthArray() string {
+	var parts []string
+	for _, gid := range f.sortedGlyphs() {
+		parts = append(parts, fmt.Sprintf("%d [%d]", gid, f.width(uint16(gid))))
+	}
+	return strings.Join(parts, " ")
+}
+
+// toUnicode tạo CMap ánh xạ glyph về ký tự để có thể tìm kiếm/sao chép chữ.
+func (f *embeddedFont) toUnicode() []byte {
+	var entries []string
+	for _, gid := range f.sortedGlyphs() {
+		if gid == 0 {
+			continue
+		}
+		var hex strings.Builder
+		for _, unit := range utf16.Encode([]rune{f.used[uint16(gid)]}) {
+			fmt.Fprintf(&hex, "%04X", unit)
+		}
+		entries = append(entries, fmt.Sprintf("<%04X> <%s>", gid, hex.String()))
+	}
+
+	var b bytes.Buffer
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	b.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	b.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	b.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for len(entries) > 0 {
+		n := len(entries)
+		if n > 100 {
+			n = 100
+		}
+		fmt.Fprintf(&b, "%d beginbfchar\n%s\nendbfchar\n", n, strings.Join(entries[:n], "\n"))
+		entries = entries[n:]
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CIDInit /ProcSet findresource /defineresource pop\nend\nend\n")
+	return b.Bytes()
+}
@@ -0,0 +1,156 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// fontTables đọc bảng thư mục của file TrueType.
+func fontTables(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	tables := map[string][]byte{}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		rec := data[12+16*i:]
+		offset := binary.BigEndian.Uint32(rec[8:])
+		length := binary.BigEndian.Uint32(rec[12:])
+		if int(offset+length) > len(data) {
+			t.Fatalf("bảng %q nằm ngoài file", rec[:4])
+		}
+		table := data[offset : offset+length]
+		if sum := fontChecksum(table); string(rec[:4]) != "head" && sum != binary.BigEndian.Uint32(rec[4:]) {
+			t.Errorf("checksum bảng %q = %08X, ghi %08X", rec[:4], sum, binary.BigEndian.Uint32(rec[4:]))
+		}
+		tables[string(rec[:4])] = table
+	}
+	return tables
+}
+
+func TestParseFontRejectsUnsupported(t *testing.T) {
+	regular, _, err := DefaultFonts()
+	if err != nil {
+		t.Fatalf("DefaultFonts: %v", err)
+	}
+	withoutGlyf := writeFontTables(map[string][]byte{
+		"head": regular.tables["head"],
+		"hhea": regular.tables["hhea"],
+		"maxp": regular.tables["maxp"],
+		"hmtx": regular.tables["hmtx"],
+		"cmap": regular.tables["cmap"],
+	})
+	withoutCmap := writeFontTables(map[string][]byte{
+		"head": regular.tables["head"],
+		"hhea": regular.tables["hhea"],
+		"maxp": regular.tables["maxp"],
+		"hmtx": regular.tables["hmtx"],
+		"loca": regular.tables["loca"],
+		"glyf": regular.tables["glyf"],
+	})
+
+	tests := []struct {
+		name        string
+		data        []byte
+		unsupported bool
+	}{
+		{name: "quá ngắn", data: []byte{0, 1, 0, 0}, unsupported: true},
+		{name: "CFF (OTTO)", data: append([]byte("OTTO"), make([]byte, 8)...), unsupported: true},
+		{name: "thiếu glyf", data: withoutGlyf, unsupported: true},
+		{name: "thiếu cmap", data: withoutCmap},
+		{name: "bảng nằm ngoài file", data: openSansRegular[:1024]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFont(tt.data)
+			if err == nil {
+				t.Fatal("muốn lỗi")
+			}
+			if errors.Is(err, ErrUnsupportedFont) != tt.unsupported {
+				t.Errorf("err = %v, ErrUnsupportedFont = %v", err, tt.unsupported)
+			}
+		})
+	}
+}
+
+func TestSubset(t *testing.T) {
+	font, _, err := DefaultFonts()
+	if err != nil {
+		t.Fatalf("DefaultFonts: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		composite bool // có glyph ghép nên subset phải kéo thêm glyph con
+	}{
+		{name: "chỉ .notdef", text: ""},
+		{name: "chữ Latin", text: "CINEMA 2D"},
+		{name: "chữ tiếng Việt ghép dấu", text: "Đặt vé ưu đãi ế ỗ ự", composite: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used := map[uint16]rune{}
+			for _, r := range tt.text {
+				gid := font.glyph(r)
+				if gid == 0 {
+					t.Fatalf("font thiếu glyph cho %q", r)
+				}
+				used[gid] = r
+			}
+
+			// Glyph phải giữ: .notdef, glyph đã dùng và mọi glyph con
+			want := map[int]bool{0: true}
+			var walk func(gid int)
+			walk = func(gid int) {
+				want[gid] = true
+				for _, part := range font.components(gid) {
+					walk(part)
+				}
+			}
+			for gid := range used {
+				walk(int(gid))
+			}
+			if hasParts := len(want) > len(used)+1; hasParts != tt.composite {
+				t.Fatalf("có glyph con = %v, muốn %v", hasParts, tt.composite)
+			}
+
+			out := font.subset(used)
+			if sum := fontChecksum(out); sum != 0xB1B0AFBA {
+				t.Errorf("checksum toàn file = %08X, muốn B1B0AFBA", sum)
+			}
+			tables := fontTables(t, out)
+			for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "loca", "glyf"} {
+				if _, ok := tables[tag]; !ok {
+					t.Fatalf("subset thiếu bảng %q", tag)
+				}
+			}
+			if _, ok := tables["cmap"]; ok {
+				t.Error("subset không cần bảng cmap (dùng CIDToGIDMap /Identity)")
+			}
+			if format := binary.BigEndian.Uint16(tables["head"][50:]); format != 1 {
+				t.Errorf("indexToLocFormat = %d, muốn 1", format)
+			}
+
+			loca, glyf := tables["loca"], tables["glyf"]
+			if len(loca) != 4*(font.numGlyphs+1) {
+				t.Fatalf("loca dài %d, muốn %d", len(loca), 4*(font.numGlyphs+1))
+			}
+			for gid := 0; gid < font.numGlyphs; gid++ {
+				start := binary.BigEndian.Uint32(loca[4*gid:])
+				end := binary.BigEndian.Uint32(loca[4*gid+4:])
+				data := glyf[start:end]
+				if !want[gid] {
+					if len(data) != 0 {
+						t.Errorf("glyph %d không dùng nhưng vẫn còn %d byte", gid, len(data))
+					}
+					continue
+				}
+				original := font.glyphData(gid)
+				if !bytes.Equal(bytes.TrimRight(data, "\x00"), bytes.TrimRight(original, "\x00")) {
+					t.Errorf("glyph %d bị thay đổi khi cắt font", gid)
+				}
+			}
+		})
+	}
+}
@@ -15,5 +15,6 @@ func BranchRoutes(router *gin.Engine) {
 
 		branchGroup.GET("/get-details-branch/:BranchID", middleware.RequireLogin, controllers.GetDetailsBranch)
 		branchGroup.PUT("/update-branch/:BranchID", middleware.RequireLogin, controllers.UpdateBranch)
+		branchGroup.PUT("/update-branch-settings/:BranchID", middleware.RequireLogin, controllers.UpdateBranchSettings)
 	}
 }
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"movie-ticket-booking/controllers"
+	"movie-ticket-booking/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CheckinRoutes(router *gin.Engine) {
+	checkinGroup := router.Group("/checkin")
+	{
+		checkinGroup.POST("/scan", middleware.RequireLogin, controllers.ScanTicket)
+		checkinGroup.GET("/get-ticket-keys/:BranchID", middleware.RequireLogin, controllers.GetBranchTicketKeys)
+		checkinGroup.PUT("/rotate-ticket-key/:BranchID", middleware.RequireLogin, controllers.RotateBranchTicketKey)
+		checkinGroup.GET("/get-manifest/:BranchID", middleware.RequireLogin, controllers.GetCheckinManifest)
+		checkinGroup.POST("/sync-scans/:BranchID", middleware.RequireLogin, controllers.SyncOfflineScans)
+	}
+}
@@ -13,5 +13,9 @@ func CronjobRoutes(router *gin.Engine) {
 		cronjobGroup.POST("/update-movie-status", services.DailyUpdateMoviesHandler)
 		cronjobGroup.POST("/unlock-seat", services.AutoUnlockSeatsHandler)
 		cronjobGroup.POST("/close-showtime", services.AutoCloseShowtimesHandler)
+		cronjobGroup.POST("/backfill-showtime-seats", services.BackfillShowtimeSeatsHandler)
+		cronjobGroup.POST("/cleanup-idempotency-keys", services.CleanupIdempotencyKeysHandler)
+		cronjobGroup.POST("/reconcile-payments", services.ReconcilePaymentsHandler)
+		cronjobGroup.POST("/reconciliation-report", services.ReconciliationReportHandler)
 	}
 }
@@ -8,14 +8,18 @@ import (
 )
 
 func OrderRoutes(router *gin.Engine) {
-	orderGroup := router.Group("/order")
+	orderGroup := router.Group("/order", middleware.Idempotency)
 	{
 		orderGroup.GET("/get-orders-of-account/:AccountID", middleware.RequireLogin, controllers.GetOrdersOfAccount)
+		orderGroup.GET("/:OrderID/ticket.pdf", middleware.OptionalLogin, controllers.DownloadOrderTicketPDF)
 
-		orderGroup.POST("/add-order", controllers.AddOrder)
-		orderGroup.POST("/create-payment", controllers.CreateMomoPayment)
-		// orderGroup.POST("/result-payment", controllers.MomoResultHandler)
+		orderGroup.POST("/add-order", middleware.RequireLogin, controllers.AddOrder)
+		orderGroup.POST("/quote", middleware.OptionalLogin, controllers.GetOrderQuote)
+		orderGroup.POST("/checkout", middleware.OptionalLogin, controllers.CreateCheckout)
+		orderGroup.POST("/create-payment", middleware.OptionalLogin, controllers.CreatePayment)
+		orderGroup.POST("/momo-ipn", controllers.MomoIPNHandler)
 		orderGroup.POST("/create-after-payment", controllers.CreateOrderAfterPayment)
+		orderGroup.POST("/:OrderID/cancel", middleware.OptionalLogin, controllers.CancelOrder)
 
 	}
 }
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"movie-ticket-booking/controllers"
+	"movie-ticket-booking/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PaymentRoutes(router *gin.Engine) {
+	paymentGroup := router.Group("/payment")
+	{
+		// VNPay gửi IPN bằng GET, các cổng còn lại dùng POST
+		paymentGroup.GET("/callback/:Provider", controllers.PaymentCallbackHandler)
+		paymentGroup.POST("/callback/:Provider", controllers.PaymentCallbackHandler)
+
+		paymentGroup.GET("/fake/pay/:Ref", controllers.FakeGatewayPay)
+
+		paymentGroup.GET("/get-payments", middleware.RequireLogin, controllers.GetPayments)
+		paymentGroup.GET("/get-payment-details/:PaymentID", middleware.RequireLogin, controllers.GetPaymentDetails)
+		paymentGroup.GET("/get-payments-of-order/:OrderID", middleware.RequireLogin, controllers.GetPaymentsOfOrder)
+		paymentGroup.GET("/get-reconciliation-report", middleware.RequireLogin, controllers.GetReconciliationReport)
+	}
+}
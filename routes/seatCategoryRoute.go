@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"movie-ticket-booking/controllers"
+	"movie-ticket-booking/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SeatCategoryRoutes(router *gin.Engine) {
+	seatCategoryGroup := router.Group("/seat-category")
+	{
+		seatCategoryGroup.GET("/get-all", controllers.GetAllSeatCategories)
+		seatCategoryGroup.POST("/add", middleware.RequireLogin, controllers.AddSeatCategory)
+		seatCategoryGroup.GET("/get-prices-of-theater/:TheaterID", middleware.RequireLogin, controllers.GetSeatCategoryPricesOfTheater)
+		seatCategoryGroup.PUT("/set-prices/:TheaterID", middleware.RequireLogin, controllers.SetSeatCategoryPrices)
+		seatCategoryGroup.PUT("/assign-seats", middleware.RequireLogin, controllers.AssignSeatCategory)
+	}
+}
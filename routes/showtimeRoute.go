@@ -15,7 +15,10 @@ func ShowtimeRoutes(router *gin.Engine) {
 		showtimeGroup.GET("/get-details-showtime/:ShowtimeID", middleware.RequireLogin, controllers.GetDetailsShowtime)
 		showtimeGroup.PUT("/open-order-showtime/:ShowtimeID", middleware.RequireLogin, controllers.OpenOrderShowtime)
 		showtimeGroup.PUT("/cancel-showtime/:ShowtimeID", middleware.RequireLogin, controllers.CancelShowtime)
+		showtimeGroup.GET("/get-cancellation-refunds/:ShowtimeID", middleware.RequireLogin, controllers.GetShowtimeRefunds)
+		showtimeGroup.PUT("/retry-cancellation-refunds/:ShowtimeID", middleware.RequireLogin, controllers.RetryShowtimeRefunds)
 		showtimeGroup.DELETE("/delete-showtime/:ShowtimeID", middleware.RequireLogin, controllers.DeleteShowtime)
+		showtimeGroup.PUT("/update-seat-hold/:ShowtimeID", middleware.RequireLogin, controllers.UpdateShowtimeSeatHold)
 
 		showtimeGroup.GET("/get-showtimes-of-date/:MovieID", controllers.GetAllShowtimesOfDate)
 		showtimeGroup.GET("/get-showtimes-info-in-selectSeat/:ShowtimeID", controllers.GetShowtimeInfo)
@@ -14,5 +14,12 @@ func ShowtimeSeatRoutes(router *gin.Engine) {
 		showtimeSeatGroup.DELETE("/delete-showtime-seats/:ShowtimeID", middleware.RequireLogin, controllers.DeleteShowtimeSeats)
 
 		showtimeSeatGroup.GET("/get-seat-of-showtime", controllers.GetSeatOfShowtime)
+		showtimeSeatGroup.GET("/best-available", controllers.GetBestAvailableSeats)
+		showtimeSeatGroup.GET("/seat-map", controllers.GetShowtimeSeatMap)
+
+		showtimeSeatGroup.POST("/hold", middleware.OptionalLogin, controllers.HoldShowtimeSeats)
+		showtimeSeatGroup.DELETE("/hold", middleware.OptionalLogin, controllers.ReleaseShowtimeSeats)
+		showtimeSeatGroup.POST("/hold/extend", middleware.OptionalLogin, controllers.ExtendShowtimeSeatHold)
+		showtimeSeatGroup.POST("/hold/release-all", middleware.OptionalLogin, controllers.ReleaseAllShowtimeSeatHolds)
 	}
 }
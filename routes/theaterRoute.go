@@ -19,6 +19,15 @@ func TheaterRoutes(router *gin.Engine) {
 		theaterGroup.PUT("/update-col-row/:TheaterID", middleware.RequireLogin, controllers.UpdateColRow)
 		theaterGroup.PUT("/delete-rows-and-seats/:TheaterID", middleware.RequireLogin, controllers.MarkRowsAndSeatsOld)
 
+		theaterGroup.GET("/get-layout-versions/:TheaterID", middleware.RequireLogin, controllers.GetLayoutVersions)
+		theaterGroup.GET("/get-layout-diff/:TheaterID", middleware.RequireLogin, controllers.GetLayoutDiff)
+		theaterGroup.PUT("/migrate-showtimes-layout/:TheaterID", middleware.RequireLogin, controllers.MigrateShowtimesToCurrentLayout)
+		theaterGroup.GET("/get-sold-seats-missing/:TheaterID", middleware.RequireLogin, controllers.GetSoldSeatsMissingFromLayout)
+
+		theaterGroup.GET("/:TheaterID/layout/export", middleware.RequireLogin, controllers.ExportTheaterLayout)
+		theaterGroup.POST("/:TheaterID/layout/import", middleware.RequireLogin, controllers.ImportTheaterLayout)
+		theaterGroup.GET("/:TheaterID/seat-map", middleware.RequireLogin, controllers.GetTheaterSeatMap)
+
 		theaterGroup.PUT("/change-theater-status/:TheaterID", middleware.RequireLogin, controllers.ChangeTheaterStatus)
 	}
 }
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"errors"
+	"movie-ticket-booking/models"
+	"movie-ticket-booking/ticketqr"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Số giờ mặc định/tối đa của manifest soát vé offline.
+const (
+	DefaultManifestHours = 12
+	MaxManifestHours     = 72
+)
+
+// BuildCheckinManifest tạo manifest đã ký gồm mọi vé của các suất chiếu tại
+// chi nhánh có thời gian soát vé giao với khoảng [now, now+hours].
+func BuildCheckinManifest(db *gorm.DB, branchID, hours int) (string, *ticketqr.Manifest, error) {
+	if hours <= 0 {
+		hours = DefaultManifestHours
+	}
+	if hours > MaxManifestHours {
+		hours = MaxManifestHours
+	}
+	now := time.Now()
+	to := now.Add(time.Duration(hours) * time.Hour)
+
+	// Lấy từ hôm qua để gồm cả suất chiếu qua nửa đêm đang diễn ra
+	var showtimes []models.Showtime
+	if err := db.Table("showtimes st").
+		Select("st.*").
+		Joins("JOIN theaters t ON t.TheaterID = st.TheaterID").
+		Where("t.BranchID = ? AND st.Status = ?", branchID, 1).
+		Where("st.ShowDate BETWEEN ? AND ?", now.AddDate(0, 0, -1).Format("2006-01-02"), to.Format("2006-01-02")).
+		Scan(&showtimes).Error; err != nil {
+		return "", nil, err
+	}
+
+	type window struct{ notBefore, expiresAt time.Time }
+	windows := map[int]window{}
+	showtimeIDs := []int{}
+	for i := range showtimes {
+		notBefore, expiresAt, err := ticketValidity(&showtimes[i])
+		if err != nil || !expiresAt.After(now) || !notBefore.Before(to) {
+			continue
+		}
+		windows[showtimes[i].ShowtimeID] = window{notBefore, expiresAt}
+		showtimeIDs = append(showtimeIDs, showtimes[i].ShowtimeID)
+	}
+
+	manifest := &ticketqr.Manifest{
+		BranchID:    branchID,
+		GeneratedAt: now,
+		From:        now,
+		To:          to,
+		Tickets:     []ticketqr.ManifestTicket{},
+	}
+	if len(showtimeIDs) > 0 {
+		var tickets []models.Ticket
+		if err := db.Where("ShowtimeID IN ?", showtimeIDs).Order("ShowtimeID, TicketID").Find(&tickets).Error; err != nil {
+			return "", nil, err
+		}
+
+		var seatRows []struct {
+			OrderID int
+			Label   string
+		}
+		if err := db.Raw(`
+			SELECT ss.OrderID, CONCAT(ss.RowName, s.SeatNumber) AS Label
+			FROM showtime_seats ss
+			JOIN seats s ON s.SeatID = ss.SeatID
+			WHERE ss.ShowtimeID IN ? AND ss.OrderID IS NOT NULL
+			ORDER BY ss.RowName, s.SeatNumber
+		`, showtimeIDs).Scan(&seatRows).Error; err != nil {
+			return "", nil, err
+		}
+		seats := map[int][]string{}
+		for _, r := range seatRows {
+			seats[r.OrderID] = append(seats[r.OrderID], r.Label)
+		}
+
+		for _, t := range tickets {
+			w := windows[t.ShowtimeID]
+			manifest.Tickets = append(manifest.Tickets, ticketqr.ManifestTicket{
+				Code:       t.Code,
+				OrderID:    t.OrderID,
+				ShowtimeID: t.ShowtimeID,
+				Seats:      seats[t.OrderID],
+				Status:     t.Status,
+				UsedAt:     t.UsedAt,
+				NotBefore:  w.notBefore.Unix(),
+				ExpiresAt:  w.expiresAt.Unix(),
+			})
+		}
+	}
+
+	key, err := ActiveBranchKey(db, branchID)
+	if err != nil {
+		return "", nil, err
+	}
+	qrKey, err := toQRKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := ticketqr.SignManifest(qrKey, *manifest)
+	return token, manifest, err
+}
+
+// OfflineScan là một lần quét vé máy soát vé thực hiện khi mất kết nối.
+type OfflineScan struct {
+	ClientScanID string    `json:"ClientScanID" binding:"required"`
+	Code         string    `json:"Code" binding:"required"` // mã vé hoặc nội dung QR đã ký
+	ShowtimeID   int       `json:"ShowtimeID"`
+	ScannedAt    time.Time `json:"ScannedAt" binding:"required"`
+}
+
+// ScanRef là lần quét đầu tiên được chấp nhận của một vé.
+type ScanRef struct {
+	DeviceID  string    `json:"DeviceID"`
+	Source    string    `json:"Source"`
+	ScannedAt time.Time `json:"ScannedAt"`
+	ScannedBy int       `json:"ScannedBy"`
+}
+
+// ScanSyncResult là kết quả đồng bộ của một lần quét offline.
+type ScanSyncResult struct {
+	ClientScanID string   `json:"ClientScanID"`
+	Result       string   `json:"Result"` // accepted | rejected | conflict | duplicate
+	Reason       string   `json:"Reason,omitempty"`
+	TicketID     int      `json:"TicketID,omitempty"`
+	OrderID      int      `json:"OrderID,omitempty"`
+	FirstScan    *ScanRef `json:"FirstScan,omitempty"` // với conflict: lần quét đã được chấp nhận trước đó
+}
+
+type ScanSyncReport struct {
+	Accepted   int              `json:"Accepted"`
+	Rejected   int              `json:"Rejected"`
+	Conflicts  int              `json:"Conflicts"`
+	Duplicates int              `json:"Duplicates"`
+	Results    []ScanSyncResult `json:"Results"`
+}
+
+// SyncOfflineScans ghi nhận các lần quét offline của một máy soát vé theo thứ
+// tự thời gian quét. Vé đã được quét ở cửa khác (hoặc quét hai lần) và vé đã
+// hủy nhưng vẫn cho vào được báo là conflict. Mỗi ClientScanID của một máy chỉ
+// được xử lý một lần nên máy có thể gửi lại khi đồng bộ lỗi giữa chừng.
+func SyncOfflineScans(db *gorm.DB, staffID, branchID int, deviceID string, scans []OfflineScan) (*ScanSyncReport, error) {
+	sort.SliceStable(scans, func(i, j int) bool { return scans[i].ScannedAt.Before(scans[j].ScannedAt) })
+
+	report := &ScanSyncReport{Results: make([]ScanSyncResult, 0, len(scans))}
+	now := time.Now()
+	for _, scan := range scans {
+		result := ScanSyncResult{ClientScanID: scan.ClientScanID}
+
+		var existing models.TicketScan
+		err := db.Where("DeviceID = ? AND ClientScanID = ?", deviceID, scan.ClientScanID).First(&existing).Error
+		if err == nil {
+			result.Result = ScanResultDuplicate
+			result.Reason = existing.Reason
+			report.Duplicates++
+			report.Results = append(report.Results, result)
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		// Đồng hồ máy soát vé có thể chạy nhanh
+		scannedAt := scan.ScannedAt
+		if scannedAt.After(now) {
+			scannedAt = now
+		}
+		ticket, reason, err := admitTicket(db, staffID, ScanRequest{
+			Code:       scan.Code,
+			BranchID:   branchID,
+			ShowtimeID: scan.ShowtimeID,
+		}, scannedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		clientScanID := scan.ClientScanID
+		record := &models.TicketScan{
+			BranchID:     branchID,
+			DeviceID:     deviceID,
+			ClientScanID: &clientScanID,
+			Source:       ScanSourceOffline,
+			ScannedAt:    scannedAt,
+			ScannedBy:    staffID,
+		}
+		if err := logTicketScan(db, record, ticket, reason); err != nil {
+			return nil, err
+		}
+
+		result.Result = record.Result
+		result.Reason = reason
+		if ticket != nil && reason != ScanWrongBranch {
+			result.TicketID = ticket.TicketID
+			result.OrderID = ticket.OrderID
+		}
+		switch record.Result {
+		case ScanResultAccepted:
+			report.Accepted++
+		case ScanResultConflict:
+			report.Conflicts++
+			if reason == ScanAlreadyUsed {
+				first, err := firstAcceptedScan(db, ticket.TicketID, record.TicketScanID)
+				if err != nil {
+					return nil, err
+				}
+				result.FirstScan = first
+				// Lần quét offline diễn ra trước lần đã ghi nhận: vé được dùng từ lúc sớm hơn
+				if err := db.Model(&models.Ticket{}).
+					Where("TicketID = ? AND UsedAt > ?", ticket.TicketID, scannedAt).
+					Update("UsedAt", scannedAt).Error; err != nil {
+					return nil, err
+				}
+			}
+		default:
+			report.Rejected++
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// firstAcceptedScan trả về lần quét được chấp nhận của vé, trừ lần quét exclude.
+// Vé đánh dấu đã dùng trước khi có ticket_scans thì lấy theo tickets.UsedAt.
+func firstAcceptedScan(db *gorm.DB, ticketID, exclude int) (*ScanRef, error) {
+	var scan models.TicketScan
+	err := db.Where("TicketID = ? AND Result = ? AND TicketScanID <> ?", ticketID, ScanResultAccepted, exclude).
+		Order("ScannedAt").First(&scan).Error
+	if err == nil {
+		return &ScanRef{DeviceID: scan.DeviceID, Source: scan.Source, ScannedAt: scan.ScannedAt, ScannedBy: scan.ScannedBy}, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	var ticket models.Ticket
+	if err := db.First(&ticket, ticketID).Error; err != nil {
+		return nil, err
+	}
+	if ticket.UsedAt == nil {
+		return nil, nil
+	}
+	ref := &ScanRef{ScannedAt: *ticket.UsedAt}
+	if ticket.UsedBy != nil {
+		ref.ScannedBy = *ticket.UsedBy
+	}
+	return ref, nil
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"movie-ticket-booking/config"
+	"movie-ticket-booking/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trạng thái của orders.Status
+const (
+	OrderStatusPaid      = "paid"
+	OrderStatusRefunded  = "refunded"
+	OrderStatusCancelled = "cancelled"
+)
+
+// CheckoutPayload là dữ liệu đơn hàng lưu trong phiên thanh toán và được đọc
+// lại khi cổng thanh toán báo kết quả.
+type CheckoutPayload struct {
+	Order              models.Order       `json:"order"`
+	OrderFoods         []models.OrderFood `json:"orderFoods"`
+	ShowtimeSeatUpdate struct {
+		ShowtimeSeatIDs []int `json:"ShowtimeSeatIDs"`
+	} `json:"showtimeSeatUpdates"`
+	Quote *Quote `json:"quote,omitempty"` // báo giá đã ký, gắn vào khi tạo thanh toán
+}
+
+// Trạng thái của pending_checkouts.Status
+const (
+	CheckoutOpen      = "open"
+	CheckoutCompleted = "completed"
+	CheckoutExpired   = "expired"
+)
+
+var (
+	ErrCheckoutNotFound = errors.New("không tìm thấy phiên thanh toán")
+	ErrCheckoutExpired  = errors.New("phiên thanh toán đã hết hạn, vui lòng chọn ghế lại")
+)
+
+func newCheckoutRef() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreatePendingCheckout lưu dữ liệu đơn hàng đã báo giá ở server và trả về
+// phiên thanh toán. Mọi ghế của đơn phải đang được owner giữ và chưa hết hạn,
+// ngược lại trả về *SeatConflictError. Phiên hết hạn cùng lúc với ghế hết hạn
+// sớm nhất, hoặc theo hạn báo giá nếu đơn không có ghế.
+func CreatePendingCheckout(db *gorm.DB, owner HoldOwner, payload CheckoutPayload) (*models.PendingCheckout, error) {
+	if payload.Quote == nil {
+		return nil, ErrInvalidQuote
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := newCheckoutRef()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := payload.Quote.ExpiresAt
+	if ids := uniqueIDs(payload.ShowtimeSeatUpdate.ShowtimeSeatIDs); len(ids) > 0 {
+		holdExpiresAt, err := ownerHoldExpiry(db, owner, payload.Order.ShowtimeID, ids, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		expiresAt = holdExpiresAt
+	}
+
+	checkout := &models.PendingCheckout{
+		CheckoutRef: ref,
+		ShowtimeID:  payload.Order.ShowtimeID,
+		AccountID:   payload.Order.AccountID,
+		HoldToken:   owner.HoldToken,
+		Email:       payload.Order.Email,
+		Amount:      payload.Order.Total,
+		Payload:     string(raw),
+		Status:      CheckoutOpen,
+		ExpiresAt:   expiresAt,
+	}
+	if err := db.Create(checkout).Error; err != nil {
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// ownerHoldExpiry kiểm tra owner đang giữ mọi ghế trong ids và trả về hạn giữ
+// sớm nhất. Ghế chưa giữ hoặc đã hết hạn giữ có Reason "not_held".
+func ownerHoldExpiry(db *gorm.DB, owner HoldOwner, showtimeID int, ids []int, now time.Time) (time.Time, error) {
+	var rows []heldSeatRow
+	if err := db.Raw(`
+		SELECT ss.ShowtimeSeatID, ss.RowName, s.SeatNumber, ss.Status, ss.LockedBy, ss.HoldToken, ss.HoldExpiresAt
+		FROM showtime_seats ss
+		JOIN seats s ON s.SeatID = ss.SeatID
+		WHERE ss.ShowtimeID = ? AND ss.ShowtimeSeatID IN ?
+	`, showtimeID, ids).Scan(&rows).Error; err != nil {
+		return time.Time{}, err
+	}
+
+	found := make(map[int]heldSeatRow, len(rows))
+	for _, r := range rows {
+		found[r.ShowtimeSeatID] = r
+	}
+
+	var earliest time.Time
+	var conflicts []SeatConflict
+	for _, id := range ids {
+		r, ok := found[id]
+		live := ok && r.Status == SeatStatusHeld && r.HoldExpiresAt != nil && r.HoldExpiresAt.After(now)
+		switch {
+		case !ok:
+			conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, Reason: "not_found"})
+		case r.Status == SeatStatusSold:
+			conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, RowName: r.RowName, SeatNumber: r.SeatNumber, Reason: "sold"})
+		case live && !owner.owns(r.LockedBy, r.HoldToken):
+			conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, RowName: r.RowName, SeatNumber: r.SeatNumber, Reason: "held"})
+		case !live:
+			conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, RowName: r.RowName, SeatNumber: r.SeatNumber, Reason: "not_held"})
+		case earliest.IsZero() || r.HoldExpiresAt.Before(earliest):
+			earliest = *r.HoldExpiresAt
+		}
+	}
+	if len(conflicts) > 0 {
+		return time.Time{}, &SeatConflictError{Conflicts: conflicts}
+	}
+	return earliest, nil
+}
+
+// FindOpenCheckout trả về phiên thanh toán còn dùng được để tạo giao dịch.
+func FindOpenCheckout(db *gorm.DB, checkoutRef string) (*models.PendingCheckout, error) {
+	var checkout models.PendingCheckout
+	err := db.Where("CheckoutRef = ?", checkoutRef).First(&checkout).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCheckoutNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if checkout.Status != CheckoutOpen || !time.Now().Before(checkout.ExpiresAt) {
+		return nil, ErrCheckoutExpired
+	}
+	return &checkout, nil
+}
+
+// CheckoutPayloadOf đọc lại dữ liệu đơn hàng của phiên thanh toán.
+func CheckoutPayloadOf(checkout *models.PendingCheckout) (CheckoutPayload, error) {
+	var payload CheckoutPayload
+	err := json.Unmarshal([]byte(checkout.Payload), &payload)
+	return payload, err
+}
+
+// ExpireCheckouts đóng các phiên thanh toán đã quá hạn giữ ghế. Giao dịch đã
+// tạo từ phiên vẫn được ghi nhận nếu cổng báo thành công muộn.
+func ExpireCheckouts(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Model(&models.PendingCheckout{}).
+		Where("Status = ? AND ExpiresAt <= ?", CheckoutOpen, now).
+		Update("Status", CheckoutExpired)
+	return result.RowsAffected, result.Error
+}
+
+// BranchPaymentProvider trả về cổng thanh toán chi nhánh của suất chiếu đang
+// dùng, hoặc cổng mặc định nếu chi nhánh chưa cấu hình.
+func BranchPaymentProvider(db *gorm.DB, showtimeID int) (string, error) {
+	var provider string
+	err := db.Raw(`
+		SELECT b.PaymentProvider
+		FROM showtimes st
+		JOIN theaters t ON t.TheaterID = st.TheaterID
+		JOIN branches b ON b.BranchID = t.BranchID
+		WHERE st.ShowtimeID = ?
+	`, showtimeID).Scan(&provider).Error
+	if err != nil {
+		return "", err
+	}
+	if provider == "" {
+		provider = config.GetDefaultPaymentProvider()
+	}
+	return provider, nil
+}
+
+// FindOrderByPaymentRef trả về đơn hàng đã tạo cho một giao dịch, nil nếu chưa có.
+func FindOrderByPaymentRef(db *gorm.DB, paymentRef string) (*models.Order, error) {
+	var order models.Order
+	err := db.Where("PaymentRef = ?", paymentRef).First(&order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// FinalizePaidOrder tạo đơn hàng, món ăn, cập nhật ghế đã bán và cộng điểm
+// cho một giao dịch đã thanh toán thành công, tất cả trong một transaction.
+// Giá lấy từ báo giá đã ký trong payload, không dùng số tiền client gửi. Ghế
+// phải thuộc suất chiếu của đơn và còn trống hoặc do người mua giữ, nếu không
+// thì rollback và trả về *SeatConflictError. Mỗi paymentRef chỉ tạo một đơn
+// hàng (PaymentRef là unique): lần gọi lặp lại trả về đơn hàng đã có với
+// created = false.
+func FinalizePaidOrder(db *gorm.DB, provider, paymentRef, transID string, payload CheckoutPayload) (order *models.Order, created bool, err error) {
+	if existing, err := FindOrderByPaymentRef(db, paymentRef); err != nil || existing != nil {
+		return existing, false, err
+	}
+	if err := VerifyQuote(payload.Quote); err != nil {
+		return nil, false, err
+	}
+	ApplyQuote(&payload, payload.Quote)
+
+	newOrder := payload.Order
+	newOrder.OrderID = 0
+	newOrder.OrderFoods = nil
+	newOrder.Status = OrderStatusPaid
+	newOrder.PointsEarned = 0
+	if newOrder.AccountID != 0 {
+		newOrder.PointsEarned = newOrder.Total
+	}
+	newOrder.PaymentProvider = provider
+	newOrder.PaymentRef = paymentRef
+	newOrder.PaymentTransID = transID
+	newOrder.CreatedAt = time.Now()
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lưu order
+		if err := tx.Create(&newOrder).Error; err != nil {
+			return err
+		}
+
+		// Lưu order foods
+		for _, food := range payload.OrderFoods {
+			food.OrderFoodID = 0
+			food.OrderID = newOrder.OrderID
+			if err := tx.Create(&food).Error; err != nil {
+				return err
+			}
+		}
+
+		// Gắn đơn hàng vào giao dịch thanh toán
+		if err := tx.Model(&models.Payment{}).
+			Where("PaymentRef = ?", paymentRef).
+			Update("OrderID", newOrder.OrderID).Error; err != nil {
+			return err
+		}
+
+		// Đóng phiên thanh toán của giao dịch
+		if err := tx.Exec(`
+			UPDATE pending_checkouts
+			SET Status = ?
+			WHERE PendingCheckoutID = (SELECT CheckoutID FROM payments WHERE PaymentRef = ?)
+		`, CheckoutCompleted, paymentRef).Error; err != nil {
+			return err
+		}
+
+		// Cập nhật ghế đã bán, chỉ khi ghế còn trống hoặc do chính người mua giữ
+		owner, err := paymentHoldOwner(tx, paymentRef, newOrder.AccountID)
+		if err != nil {
+			return err
+		}
+		if err := sellSeats(tx, owner, newOrder.ShowtimeID, newOrder.OrderID, payload.ShowtimeSeatUpdate.ShowtimeSeatIDs); err != nil {
+			return err
+		}
+
+		// Mã vé dùng để soát vé
+		if _, err := CreateOrderTicket(tx, &newOrder); err != nil {
+			return err
+		}
+
+		// Trừ điểm đã dùng cùng lúc tạo đơn, số dư phải còn đủ
+		if newOrder.AccountID != 0 && newOrder.PointsUsed > 0 {
+			res := tx.Model(&models.Account{}).
+				Where("AccountID = ? AND Point >= ?", newOrder.AccountID, newOrder.PointsUsed).
+				Update("Point", gorm.Expr("Point - ?", newOrder.PointsUsed))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrInsufficientPoints
+			}
+		}
+
+		// Nếu có AccountID thì cộng thêm Point = số tiền đã thanh toán
+		if newOrder.AccountID != 0 && newOrder.PointsEarned > 0 {
+			if err := tx.Model(&models.Account{}).
+				Where("AccountID = ?", newOrder.AccountID).
+				Update("Point", gorm.Expr("Point + ?", newOrder.PointsEarned)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var conflictErr *SeatConflictError
+	if errors.As(err, &conflictErr) || errors.Is(err, ErrInsufficientPoints) {
+		return nil, false, err
+	}
+	if err != nil {
+		// Một lần gọi khác cho cùng giao dịch đã tạo đơn trước (trùng PaymentRef)
+		if existing, findErr := FindOrderByPaymentRef(db, paymentRef); findErr == nil && existing != nil {
+			return existing, false, nil
+		}
+		return nil, false, err
+	}
+	return &newOrder, true, nil
+}
+
+// paymentHoldOwner là người mua của giao dịch: tài khoản của đơn hoặc
+// HoldToken của khách vãng lai lưu trong phiên thanh toán.
+func paymentHoldOwner(tx *gorm.DB, paymentRef string, accountID int) (HoldOwner, error) {
+	owner := HoldOwner{AccountID: accountID}
+	if accountID != 0 {
+		return owner, nil
+	}
+	var holdToken *string
+	err := tx.Raw(`
+		SELECT pc.HoldToken
+		FROM payments p
+		JOIN pending_checkouts pc ON pc.PendingCheckoutID = p.CheckoutID
+		WHERE p.PaymentRef = ?
+	`, paymentRef).Scan(&holdToken).Error
+	if holdToken != nil {
+		owner.HoldToken = *holdToken
+	}
+	return owner, err
+}
+
+// sellSeats khóa (FOR UPDATE) và chuyển các ghế sang đã bán cho orderID. Ghế
+// không thuộc suất chiếu, đã bán, hoặc đang được người khác giữ (chưa hết hạn)
+// được trả về trong *SeatConflictError.
+func sellSeats(tx *gorm.DB, owner HoldOwner, showtimeID, orderID int, ids []int) error {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rows []heldSeatRow
+	if err := tx.Raw(`
+		SELECT ss.ShowtimeSeatID, ss.RowName, s.SeatNumber, ss.Status, ss.LockedBy, ss.HoldToken, ss.HoldExpiresAt
+		FROM showtime_seats ss
+		JOIN seats s ON s.SeatID = ss.SeatID
+		WHERE ss.ShowtimeID = ? AND ss.ShowtimeSeatID IN ?
+		FOR UPDATE
+	`, showtimeID, ids).Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	found := make(map[int]heldSeatRow, len(rows))
+	for _, r := range rows {
+		found[r.ShowtimeSeatID] = r
+	}
+
+	now := time.Now()
+	var conflicts []SeatConflict
+	for _, id := range ids {
+		r, ok := found[id]
+		switch {
+		case !ok:
+			conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, Reason: "not_found"})
+		case r.Status == SeatStatusSold:
+			conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, RowName: r.RowName, SeatNumber: r.SeatNumber, Reason: "sold"})
+		case r.Status == SeatStatusHeld && !owner.owns(r.LockedBy, r.HoldToken) &&
+			(r.HoldExpiresAt == nil || r.HoldExpiresAt.After(now)):
+			conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, RowName: r.RowName, SeatNumber: r.SeatNumber, Reason: "held"})
+		}
+	}
+	if len(conflicts) > 0 {
+		return &SeatConflictError{Conflicts: conflicts}
+	}
+
+	return tx.Exec(`
+		UPDATE showtime_seats
+		SET Status = ?, OrderID = ?,
+		    LockedBy = NULL, HoldToken = NULL, LockedAt = NULL, HoldExpiresAt = NULL, HoldExtended = 0
+		WHERE ShowtimeID = ? AND ShowtimeSeatID IN ?
+	`, SeatStatusSold, orderID, showtimeID, ids).Error
+}
@@ -3,8 +3,10 @@ package services
 import (
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"movie-ticket-booking/config"
 	"movie-ticket-booking/database"
 	"movie-ticket-booking/models"
 
@@ -40,13 +42,20 @@ func DailyUpdateMoviesHandler(c *gin.Context) {
 
 // -------------------- Task 2: Unlock seat hết hạn --------------------
 func AutoUnlockSeatsHandler(c *gin.Context) {
-	cutoff := time.Now().Add(-3 * time.Minute)
+	now := time.Now()
+	// Ghế giữ trước khi có HoldExpiresAt vẫn tính theo LockedAt + TTL mặc định
+	legacyCutoff := now.Add(-time.Duration(config.GetSeatHoldMinutes()) * time.Minute)
 
 	result := database.DB.Model(&models.ShowtimeSeat{}).
-		Where("Status = ? AND LockedAt <= ?", 1, cutoff).
+		Where("Status = ?", 1).
+		Where("(HoldExpiresAt <= ?) OR (HoldExpiresAt IS NULL AND LockedAt <= ?)", now, legacyCutoff).
 		Updates(map[string]interface{}{
-			"Status":   0,
-			"LockedBy": nil,
+			"Status":        0,
+			"LockedBy":      nil,
+			"HoldToken":     nil,
+			"LockedAt":      nil,
+			"HoldExpiresAt": nil,
+			"HoldExtended":  false,
 		})
 
 	if result.Error != nil {
@@ -55,9 +64,16 @@ func AutoUnlockSeatsHandler(c *gin.Context) {
 		return
 	}
 
+	// Phiên thanh toán hết hạn cùng ghế đang giữ
+	expiredCheckouts, err := ExpireCheckouts(database.DB, now)
+	if err != nil {
+		log.Printf("[AutoUnlockSeats] expire checkouts error: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":       "AutoUnlockSeats executed",
-		"rows_affected": result.RowsAffected,
+		"message":           "AutoUnlockSeats executed",
+		"rows_affected":     result.RowsAffected,
+		"expired_checkouts": expiredCheckouts,
 	})
 }
 
@@ -84,3 +100,99 @@ func AutoCloseShowtimesHandler(c *gin.Context) {
 		"rows_affected": result.RowsAffected,
 	})
 }
+
+// -------------------- Task 4: Bổ sung ghế cho suất chiếu thiếu ghế --------------------
+func BackfillShowtimeSeatsHandler(c *gin.Context) {
+	results, err := BackfillMissingShowtimeSeats(database.DB)
+	if err != nil {
+		log.Printf("[BackfillShowtimeSeats] error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "BackfillShowtimeSeats executed",
+		"showtimes": results,
+	})
+}
+
+// -------------------- Task 5: Xóa Idempotency-Key hết hạn --------------------
+func CleanupIdempotencyKeysHandler(c *gin.Context) {
+	result := database.DB.Where("ExpiresAt < ?", time.Now()).Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		log.Printf("[CleanupIdempotencyKeys] error: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "CleanupIdempotencyKeys executed",
+		"rows_affected": result.RowsAffected,
+	})
+}
+
+// -------------------- Task 6: Đối soát giao dịch pending --------------------
+func ReconcilePaymentsHandler(c *gin.Context) {
+	minutes := config.GetPaymentReconcileMinutes()
+	if value, err := strconv.Atoi(c.Query("minutes")); err == nil && value > 0 {
+		minutes = value
+	}
+
+	results, err := ReconcilePendingPayments(database.DB, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		log.Printf("[ReconcilePayments] error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+			log.Printf("[ReconcilePayments] payment %d (%s): %s", r.PaymentID, r.PaymentRef, r.Error)
+		}
+	}
+
+	// Yêu cầu hoàn tiền cổng đang xử lý
+	refunds, err := ResolveProcessingRefunds(database.DB, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		log.Printf("[ReconcilePayments] refunds error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, r := range refunds {
+		if r.Error != "" {
+			failed++
+			log.Printf("[ReconcilePayments] refund %d (order %d): %s", r.RefundID, r.OrderID, r.Error)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "ReconcilePayments executed",
+		"checked":  len(results),
+		"failed":   failed,
+		"payments": results,
+		"refunds":  refunds,
+	})
+}
+
+// -------------------- Task 7: Báo cáo đối soát hằng ngày --------------------
+func ReconciliationReportHandler(c *gin.Context) {
+	// Mặc định đối soát ngày hôm qua
+	date := c.DefaultQuery("date", time.Now().AddDate(0, 0, -1).Format("2006-01-02"))
+
+	report, err := BuildReconciliationReport(database.DB, date)
+	if err != nil {
+		log.Printf("[ReconciliationReport] error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(report.Issues) > 0 {
+		log.Printf("[ReconciliationReport] %s: %d giao dịch cần kiểm tra", date, len(report.Issues))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ReconciliationReport executed",
+		"report":  report,
+	})
+}
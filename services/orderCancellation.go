@@ -0,0 +1,236 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"movie-ticket-booking/config"
+	"movie-ticket-booking/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Người hủy đơn hàng
+const (
+	CancelRoleCustomer = "customer"
+	CancelRoleGuest    = "guest"
+	CancelRoleStaff    = "staff"
+)
+
+// Cách hoàn tiền khi hủy đơn
+const (
+	RefundMethodOriginal = "original" // hoàn về phương thức thanh toán gốc
+	RefundMethodCredit   = "credit"   // hoàn thành điểm tích lũy
+	RefundMethodNone     = "none"     // không còn tiền để hoàn
+)
+
+var (
+	ErrOrderNotCancellable   = errors.New("đơn hàng đã bị hủy hoặc đã hoàn tiền")
+	ErrCancelWindowClosed    = errors.New("đã quá thời hạn hủy vé của suất chiếu")
+	ErrTicketAlreadyUsed     = errors.New("vé đã được sử dụng, không thể hủy")
+	ErrCreditRequiresAccount = errors.New("cần tài khoản để nhận hoàn tiền bằng điểm")
+	ErrCreditUnavailable     = errors.New("hoàn tiền bằng điểm không khả dụng")
+	ErrInvalidRefundMethod   = errors.New("cách hoàn tiền không hợp lệ")
+)
+
+// CancelRequest là yêu cầu hủy đơn; CancelledBy/AccountID/Role do controller
+// gán theo người gọi.
+type CancelRequest struct {
+	Reason       string
+	RefundMethod string // original | credit, mặc định original
+	CancelledBy  string
+	AccountID    int
+	Role         string
+}
+
+// CancellationQuote là số tiền được hoàn nếu hủy đơn tại một thời điểm.
+type CancellationQuote struct {
+	HoursBefore  float64 `json:"HoursBefore"`
+	PaidAmount   int     `json:"PaidAmount"`
+	FoodAmount   int     `json:"FoodAmount"` // tiền thức ăn không được hoàn
+	FeePercent   int     `json:"FeePercent"`
+	FeeAmount    int     `json:"FeeAmount"`
+	RefundAmount int     `json:"RefundAmount"`
+}
+
+func showtimeStartAt(showtime *models.Showtime) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04", showtime.ShowDate+" "+showtime.StartTime, time.Local)
+}
+
+// cancellationFeePercent chọn mức phí có HoursBefore lớn nhất mà thời gian còn
+// lại vẫn đạt được; không có mức nào phù hợp thì miễn phí.
+func cancellationFeePercent(policy *config.CancellationPolicy, hoursBefore float64) int {
+	for _, tier := range policy.FeeTiers {
+		if hoursBefore >= float64(tier.HoursBefore) {
+			return tier.FeePercent
+		}
+	}
+	return 0
+}
+
+// QuoteCancellation tính phí hủy và số tiền được hoàn của đơn hàng theo chính
+// sách hiện hành. Trả về ErrCancelWindowClosed nếu đã quá hạn hủy.
+func QuoteCancellation(db *gorm.DB, order *models.Order, now time.Time) (*CancellationQuote, error) {
+	var showtime models.Showtime
+	if err := db.First(&showtime, order.ShowtimeID).Error; err != nil {
+		return nil, err
+	}
+	start, err := showtimeStartAt(&showtime)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := config.GetCancellationPolicy()
+	quote := &CancellationQuote{
+		HoursBefore: math.Floor(start.Sub(now).Hours()*100) / 100,
+		PaidAmount:  order.Total,
+	}
+	if quote.HoursBefore < float64(policy.CutoffHours) {
+		return quote, ErrCancelWindowClosed
+	}
+
+	if !policy.RefundFood {
+		if err := db.Model(&models.OrderFood{}).
+			Where("OrderID = ?", order.OrderID).
+			Select("COALESCE(SUM(TotalPrice), 0)").
+			Scan(&quote.FoodAmount).Error; err != nil {
+			return nil, err
+		}
+		if quote.FoodAmount > quote.PaidAmount {
+			quote.FoodAmount = quote.PaidAmount
+		}
+	}
+
+	refundable := quote.PaidAmount - quote.FoodAmount
+	quote.FeePercent = cancellationFeePercent(policy, quote.HoursBefore)
+	quote.FeeAmount = refundable * quote.FeePercent / 100
+	quote.RefundAmount = refundable - quote.FeeAmount
+	return quote, nil
+}
+
+// CancelOrder hủy đơn hàng đã thanh toán theo chính sách hủy: trả ghế, trừ lại
+// điểm đã cộng, hoàn điểm đã dùng, hủy vé và hoàn tiền về cổng thanh toán
+// (Refund pending, gọi ProcessRefund để thực hiện) hoặc cộng điểm tích lũy.
+// Mọi lần hủy được ghi vào order_cancellations.
+func CancelOrder(db *gorm.DB, orderID int, req CancelRequest) (*models.OrderCancellation, *models.Refund, error) {
+	if req.RefundMethod == "" {
+		req.RefundMethod = RefundMethodOriginal
+	}
+	if req.RefundMethod != RefundMethodOriginal && req.RefundMethod != RefundMethodCredit {
+		return nil, nil, ErrInvalidRefundMethod
+	}
+	pointValue := config.GetPointsConfig().ValueVND
+	if req.RefundMethod == RefundMethodCredit && pointValue <= 0 {
+		return nil, nil, ErrCreditUnavailable
+	}
+
+	var cancellation *models.OrderCancellation
+	var refund *models.Refund
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			return err
+		}
+		if order.Status != OrderStatusPaid {
+			return ErrOrderNotCancellable
+		}
+		if req.RefundMethod == RefundMethodCredit && order.AccountID == 0 {
+			return ErrCreditRequiresAccount
+		}
+
+		var used int64
+		if err := tx.Model(&models.Ticket{}).
+			Where("OrderID = ? AND Status = ?", order.OrderID, TicketUsed).
+			Count(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return ErrTicketAlreadyUsed
+		}
+
+		quote, err := QuoteCancellation(tx, &order, time.Now())
+		if err != nil {
+			return err
+		}
+
+		p, err := refundablePayment(tx, order.OrderID)
+		if err != nil {
+			return err
+		}
+		seats, points, err := VoidOrder(tx, &order)
+		if err != nil {
+			return err
+		}
+
+		cancellation = &models.OrderCancellation{
+			OrderID:      order.OrderID,
+			ShowtimeID:   order.ShowtimeID,
+			CancelledBy:  req.CancelledBy,
+			Role:         req.Role,
+			Reason:       req.Reason,
+			HoursBefore:  quote.HoursBefore,
+			PaidAmount:   quote.PaidAmount,
+			FoodAmount:   quote.FoodAmount,
+			FeePercent:   quote.FeePercent,
+			FeeAmount:    quote.FeeAmount,
+			RefundAmount: quote.RefundAmount,
+			RefundMethod: req.RefundMethod,
+			Seats:        seats,
+		}
+		if req.AccountID != 0 {
+			accountID := req.AccountID
+			cancellation.CancelledByAccount = &accountID
+		}
+		if order.AccountID != 0 {
+			cancellation.PointsReversed = points
+			cancellation.PointsRestored = order.PointsUsed
+		}
+
+		// Không hoàn quá số tiền còn lại của giao dịch
+		amount := quote.RefundAmount
+		if p != nil && amount > p.Amount-p.RefundedAmount {
+			amount = p.Amount - p.RefundedAmount
+		}
+		cancellation.RefundAmount = amount
+
+		switch {
+		case amount <= 0:
+			cancellation.RefundAmount = 0
+			cancellation.RefundMethod = RefundMethodNone
+		case req.RefundMethod == RefundMethodCredit:
+			credited := amount / pointValue
+			if err := tx.Model(&models.Account{}).
+				Where("AccountID = ?", order.AccountID).
+				Update("Point", gorm.Expr("Point + ?", credited)).Error; err != nil {
+				return err
+			}
+			cancellation.PointsCredited = credited
+		default:
+			refund = &models.Refund{
+				OrderID:        order.OrderID,
+				ShowtimeID:     order.ShowtimeID,
+				Source:         RefundSourceCustomerCancel,
+				Amount:         amount,
+				Reason:         req.Reason,
+				Status:         RefundPending,
+				Seats:          seats,
+				PointsReversed: points,
+				CreatedBy:      req.CancelledBy,
+			}
+			if p != nil {
+				refund.PaymentID = &p.PaymentID
+			}
+			if err := tx.Create(refund).Error; err != nil {
+				return err
+			}
+			cancellation.RefundID = &refund.RefundID
+		}
+
+		return tx.Create(cancellation).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return cancellation, refund, nil
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"movie-ticket-booking/config"
+	"movie-ticket-booking/models"
+	"movie-ticket-booking/pdf"
+	"movie-ticket-booking/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DocumentSeat/DocumentFood là một dòng ghế/món ăn trên vé và hóa đơn.
+type DocumentSeat struct {
+	RowName     string
+	SeatNumber  string
+	TicketPrice int
+}
+
+type DocumentFood struct {
+	FoodName    string
+	Description string
+	Quantity    int
+	UnitPrice   int
+	Amount      int
+}
+
+// OrderDocument là dữ liệu dùng chung cho email hóa đơn, vé điện tử và hóa
+// đơn PDF của một đơn hàng.
+type OrderDocument struct {
+	OrderID       int
+	AccountID     int
+	Email         string
+	Status        string
+	CreatedAt     time.Time
+	MovieName     string
+	TheaterName   string
+	BranchName    string
+	BranchAddress string
+	BranchPhone   string
+	ShowDate      string
+	StartTime     string
+	Total         int
+	PointsUsed    int
+
+	Seats     []DocumentSeat
+	Foods     []DocumentFood
+	Discounts []QuoteDiscount
+
+	TicketCode string
+	QRToken    string // nội dung QR đã ký
+	QRImage    []byte // PNG
+}
+
+// Subtotal là tổng tiền ghế và món ăn trước giảm giá.
+func (d *OrderDocument) Subtotal() int {
+	total := 0
+	for _, s := range d.Seats {
+		total += s.TicketPrice
+	}
+	for _, f := range d.Foods {
+		total += f.Amount
+	}
+	return total
+}
+
+// LoadOrderDocument đọc đơn hàng, ghế, món ăn, giảm giá (từ báo giá của giao
+// dịch) và tạo mã QR đã ký của vé.
+func LoadOrderDocument(db *gorm.DB, orderID int) (*OrderDocument, error) {
+	doc := &OrderDocument{}
+	if err := db.
+		Table("orders o").
+		Select(`o.OrderID, o.AccountID, o.Email, o.Status, o.CreatedAt, m.MovieName, t.TheaterName,
+			b.BranchName, b.Address AS BranchAddress, b.PhoneNumber AS BranchPhone,
+			s.ShowDate, s.StartTime, o.Total, o.PointsUsed`).
+		Joins("JOIN showtimes s ON s.ShowtimeID = o.ShowtimeID").
+		Joins("JOIN movies m ON m.MovieID = s.MovieID").
+		Joins("JOIN theaters t ON t.TheaterID = s.TheaterID").
+		Joins("JOIN branches b ON b.BranchID = t.BranchID").
+		Where("o.OrderID = ?", orderID).
+		Take(doc).Error; err != nil {
+		return nil, fmt.Errorf("order not found: %v", err)
+	}
+
+	// Lấy danh sách ghế
+	if err := db.Raw(`
+		SELECT ss.RowName, se.SeatNumber, ss.TicketPrice
+		FROM showtime_seats ss
+		JOIN seats se ON se.SeatID = ss.SeatID
+		WHERE ss.OrderID = ?
+		ORDER BY ss.RowName, se.SeatNumber
+	`, orderID).Scan(&doc.Seats).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch seats: %v", err)
+	}
+
+	// Lấy danh sách món ăn, giá theo số tiền đã thu
+	if err := db.Raw(`
+		SELECT f.FoodName, f.Description, ofs.Quantity, ofs.TotalPrice AS Amount
+		FROM order_foods ofs
+		JOIN foods f ON f.FoodID = ofs.FoodID
+		WHERE ofs.OrderID = ?
+	`, orderID).Scan(&doc.Foods).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch order foods: %v", err)
+	}
+	for i := range doc.Foods {
+		if doc.Foods[i].Quantity > 0 {
+			doc.Foods[i].UnitPrice = doc.Foods[i].Amount / doc.Foods[i].Quantity
+		}
+	}
+
+	// Giảm giá lấy từ báo giá đã ký của giao dịch
+	var p models.Payment
+	if err := db.Where("OrderID = ?", orderID).Order("PaymentID DESC").Limit(1).Find(&p).Error; err != nil {
+		return nil, err
+	}
+	if p.PaymentID != 0 {
+		if payload, err := PaymentCheckoutPayload(db, &p); err == nil && payload.Quote != nil {
+			doc.Discounts = payload.Quote.Discounts
+		}
+	}
+
+	ticket, err := EnsureOrderTicket(db, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ticket code: %v", err)
+	}
+	doc.TicketCode = ticket.Code
+	if doc.QRToken, err = IssueTicketToken(db, ticket); err != nil {
+		return nil, fmt.Errorf("failed to sign ticket QR: %v", err)
+	}
+	if doc.QRImage, err = utils.GenerateQRCode(doc.QRToken); err != nil {
+		return nil, fmt.Errorf("failed to generate QR code")
+	}
+	return doc, nil
+}
+
+// CanViewOrderDocument cho biết ai được tải vé/hóa đơn: tài khoản đặt đơn,
+// hoặc khách vãng lai cung cấp đúng email đặt vé và mã vé. Chỉ đọc mã vé đã
+// có, không tạo vé cho người chưa được xác thực.
+func CanViewOrderDocument(db *gorm.DB, order *models.Order, accountID int, email, code string) (bool, error) {
+	if accountID != 0 && order.AccountID == accountID {
+		return true, nil
+	}
+	var ticket models.Ticket
+	err := db.Where("OrderID = ?", order.OrderID).First(&ticket).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return MatchesGuestOrder(order.Email, ticket.Code, email, code), nil
+}
+
+// MatchesGuestOrder kiểm tra email và mã vé khách vãng lai cung cấp có khớp với
+// đơn hàng không.
+func MatchesGuestOrder(orderEmail, ticketCode, email, code string) bool {
+	if email == "" || code == "" || orderEmail == "" || ticketCode == "" {
+		return false
+	}
+	emailOK := strings.EqualFold(strings.TrimSpace(email), orderEmail)
+	codeOK := subtle.ConstantTimeCompare([]byte(strings.ToUpper(strings.TrimSpace(code))), []byte(ticketCode)) == 1
+	return emailOK && codeOK
+}
+
+// FormatVND định dạng số tiền kiểu 120.000đ.
+func FormatVND(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	s := strconv.Itoa(amount)
+	var parts []string
+	for len(s) > 3 {
+		parts = append([]string{s[len(s)-3:]}, parts...)
+		s = s[:len(s)-3]
+	}
+	parts = append([]string{s}, parts...)
+	return sign + strings.Join(parts, ".") + "đ"
+}
+
+var (
+	pdfFontsOnce sync.Once
+	pdfRegular   *pdf.Font
+	pdfBold      *pdf.Font
+)
+
+// loadPDFFonts nạp font Unicode một lần: font theo PDF_FONT_PATH/
+// PDF_FONT_BOLD_PATH nếu có cấu hình, ngược lại (hoặc khi không đọc được) dùng
+// font nhúng sẵn trong package pdf.
+func loadPDFFonts() (*pdf.Font, *pdf.Font) {
+	pdfFontsOnce.Do(func() {
+		var err error
+		if pdfRegular, pdfBold, err = pdf.DefaultFonts(); err != nil {
+			log.Printf("❌ Không nạp được font PDF mặc định: %v", err)
+		}
+
+		cfg := config.GetPDFFontConfig()
+		if cfg.RegularPath == "" {
+			return
+		}
+		regular, err := pdf.LoadFont(cfg.RegularPath)
+		if err != nil {
+			log.Printf("❌ Không nạp được font PDF %s, dùng font mặc định: %v", cfg.RegularPath, err)
+			return
+		}
+		pdfRegular, pdfBold = regular, nil
+		if cfg.BoldPath != "" {
+			if pdfBold, err = pdf.LoadFont(cfg.BoldPath); err != nil {
+				log.Printf("❌ Không nạp được font PDF %s: %v", cfg.BoldPath, err)
+			}
+		}
+	})
+	return pdfRegular, pdfBold
+}
+
+// RenderOrderPDF tạo file PDF gồm vé điện tử (trang 1) và hóa đơn (trang 2).
+func RenderOrderPDF(d *OrderDocument) ([]byte, error) {
+	qr, err := png.Decode(bytes.NewReader(d.QRImage))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := pdf.New()
+	doc.SetFonts(loadPDFFonts())
+	renderTicketPage(doc.AddPage(), d, qr)
+	renderInvoicePage(doc.AddPage(), d)
+	return doc.Bytes()
+}
+
+const (
+	pdfLeft  = 50.0
+	pdfRight = pdf.PageWidth - 50
+)
+
+func seatLabels(seats []DocumentSeat) string {
+	labels := make([]string, 0, len(seats))
+	for _, s := range seats {
+		labels = append(labels, s.RowName+s.SeatNumber)
+	}
+	return strings.Join(labels, ", ")
+}
+
+func renderTicketPage(page *pdf.Page, d *OrderDocument, qr image.Image) {
+	page.FillRect(pdfLeft, 40, pdfRight-pdfLeft, 50, 0.9)
+	page.Text(pdfLeft+15, 72, 20, true, "VÉ ĐIỆN TỬ - CINÉMÀ")
+	page.TextRight(pdfRight-15, 72, 11, false, fmt.Sprintf("Đơn hàng #%d", d.OrderID))
+
+	y := 130.0
+	row := func(label, value string) {
+		page.Text(pdfLeft, y, 10, false, label)
+		page.Text(pdfLeft+110, y, 12, true, value)
+		y += 24
+	}
+	row("Phim", d.MovieName)
+	row("Rạp", d.TheaterName+" - "+d.BranchName)
+	if d.BranchAddress != "" {
+		row("Địa chỉ", d.BranchAddress)
+	}
+	row("Ngày chiếu", d.ShowDate)
+	row("Giờ chiếu", d.StartTime)
+	row("Ghế", seatLabels(d.Seats))
+
+	if len(d.Foods) > 0 {
+		y += 6
+		page.Text(pdfLeft, y, 12, true, "Thức ăn kèm theo")
+		y += 20
+		for _, f := range d.Foods {
+			page.Text(pdfLeft+10, y, 10, false, fmt.Sprintf("%d x %s", f.Quantity, f.FoodName))
+			y += 16
+		}
+	}
+
+	// QR và mã vé
+	qrSize := 200.0
+	qrX := (pdf.PageWidth - qrSize) / 2
+	qrY := y + 30
+	page.Rect(qrX-10, qrY-10, qrSize+20, qrSize+20, 1)
+	page.Image(qr, qrX, qrY, qrSize, qrSize)
+	page.TextCenter(pdf.PageWidth/2, qrY+qrSize+40, 16, true, d.TicketCode)
+	page.TextCenter(pdf.PageWidth/2, qrY+qrSize+62, 10, false, "Vui lòng đưa mã QR cho nhân viên soát vé để vào rạp")
+
+	if d.Status != OrderStatusPaid {
+		page.TextCenter(pdf.PageWidth/2, qrY+qrSize+90, 14, true, "VÉ ĐÃ HỦY")
+	}
+}
+
+func renderInvoicePage(page *pdf.Page, d *OrderDocument) {
+	cfg := config.GetInvoiceConfig()
+
+	page.TextCenter(pdf.PageWidth/2, 70, 18, true, "HÓA ĐƠN BÁN HÀNG")
+	page.TextCenter(pdf.PageWidth/2, 90, 10, false, fmt.Sprintf("Số: HD%08d - Ngày %s", d.OrderID, d.CreatedAt.Format("02/01/2006")))
+
+	y := 125.0
+	line := func(label, value string) {
+		if value == "" {
+			return
+		}
+		page.Text(pdfLeft, y, 10, false, label+": "+value)
+		y += 16
+	}
+	line("Đơn vị bán hàng", cfg.CompanyName)
+	line("Mã số thuế", cfg.TaxCode)
+	line("Địa chỉ", cfg.Address)
+	line("Chi nhánh", d.BranchName)
+	line("Điện thoại", d.BranchPhone)
+	y += 8
+	line("Người mua", d.Email)
+	line("Suất chiếu", fmt.Sprintf("%s - %s %s", d.MovieName, d.ShowDate, d.StartTime))
+
+	// Bảng hàng hóa, dịch vụ
+	y += 12
+	cols := []float64{pdfLeft, pdfLeft + 30, pdfLeft + 300, pdfLeft + 360, pdfRight}
+	page.FillRect(pdfLeft, y, pdfRight-pdfLeft, 22, 0.9)
+	page.Rect(pdfLeft, y, pdfRight-pdfLeft, 22, 0.5)
+	page.Text(cols[0]+5, y+15, 10, true, "STT")
+	page.Text(cols[1]+5, y+15, 10, true, "Hàng hóa, dịch vụ")
+	page.TextRight(cols[3]-5, y+15, 10, true, "SL")
+	page.TextRight(cols[3]+70, y+15, 10, true, "Đơn giá")
+	page.TextRight(cols[4]-5, y+15, 10, true, "Thành tiền")
+	y += 22
+
+	index := 0
+	item := func(name string, qty, unit, amount int) {
+		index++
+		page.Text(cols[0]+5, y+15, 10, false, strconv.Itoa(index))
+		page.Text(cols[1]+5, y+15, 10, false, name)
+		page.TextRight(cols[3]-5, y+15, 10, false, strconv.Itoa(qty))
+		page.TextRight(cols[3]+70, y+15, 10, false, FormatVND(unit))
+		page.TextRight(cols[4]-5, y+15, 10, false, FormatVND(amount))
+		page.Line(pdfLeft, y+22, pdfRight, y+22, 0.3)
+		y += 22
+	}
+	for _, s := range d.Seats {
+		item("Vé xem phim - ghế "+s.RowName+s.SeatNumber, 1, s.TicketPrice, s.TicketPrice)
+	}
+	for _, f := range d.Foods {
+		item(f.FoodName, f.Quantity, f.UnitPrice, f.Amount)
+	}
+
+	// Tổng cộng, VAT đã gồm trong giá
+	y += 14
+	total := func(label string, amount int, bold bool) {
+		page.Text(cols[2], y, 10, bold, label)
+		page.TextRight(cols[4]-5, y, 10, bold, FormatVND(amount))
+		y += 18
+	}
+	total("Cộng tiền hàng", d.Subtotal(), false)
+	for _, discount := range d.Discounts {
+		total(discount.Name, -discount.Amount, false)
+	}
+	if cfg.VATPercent > 0 {
+		beforeTax := d.Total * 100 / (100 + cfg.VATPercent)
+		total("Tiền trước thuế", beforeTax, false)
+		total(fmt.Sprintf("Thuế GTGT (%d%%)", cfg.VATPercent), d.Total-beforeTax, false)
+	}
+	page.Line(cols[2], y-10, pdfRight, y-10, 0.5)
+	y += 4
+	total("Tổng thanh toán", d.Total, true)
+
+	if d.Status != OrderStatusPaid {
+		y += 10
+		page.Text(pdfLeft, y, 12, true, "Đơn hàng đã hủy/hoàn tiền")
+	}
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"movie-ticket-booking/models"
+	"movie-ticket-booking/payment"
+
+	"gorm.io/gorm"
+)
+
+// Trạng thái của payments.Status
+const (
+	PaymentPending           = "pending"
+	PaymentAuthorized        = "authorized"
+	PaymentCaptured          = "captured"
+	PaymentFailed            = "failed"
+	PaymentExpired           = "expired"
+	PaymentRefunded          = "refunded"
+	PaymentPartiallyRefunded = "partially_refunded"
+)
+
+// PaymentProviderPoints là "cổng" của đơn trả hoàn toàn bằng điểm tích lũy.
+const PaymentProviderPoints = "points"
+
+// Nguồn của một lần đổi trạng thái.
+const (
+	PaymentSourceCreate   = "create"
+	PaymentSourceCallback = "callback"
+	PaymentSourceQuery    = "query"
+	PaymentSourceRefund   = "refund"
+	PaymentSourceAdmin    = "admin"
+)
+
+// paymentTransitions liệt kê các trạng thái được phép chuyển tới. Giao dịch
+// failed/expired vẫn có thể thành captured vì cổng có thể báo kết quả trễ:
+// khách đã bị trừ tiền thì phải ghi nhận.
+var paymentTransitions = map[string][]string{
+	PaymentPending:           {PaymentAuthorized, PaymentCaptured, PaymentFailed, PaymentExpired},
+	PaymentAuthorized:        {PaymentCaptured, PaymentFailed, PaymentExpired},
+	PaymentFailed:            {PaymentCaptured},
+	PaymentExpired:           {PaymentCaptured},
+	PaymentCaptured:          {PaymentRefunded, PaymentPartiallyRefunded},
+	PaymentPartiallyRefunded: {PaymentPartiallyRefunded, PaymentRefunded},
+}
+
+var (
+	ErrPaymentNotFound       = errors.New("không tìm thấy giao dịch thanh toán")
+	ErrPaymentStatusChanged  = errors.New("trạng thái giao dịch vừa bị thay đổi, vui lòng thử lại")
+	ErrPaymentAmountMismatch = errors.New("số tiền thanh toán không khớp giao dịch")
+)
+
+type PaymentTransitionError struct {
+	From, To string
+}
+
+func (e *PaymentTransitionError) Error() string {
+	return fmt.Sprintf("không thể chuyển giao dịch từ %s sang %s", e.From, e.To)
+}
+
+// CanTransitionPayment cho biết có được chuyển giao dịch từ from sang to không.
+func CanTransitionPayment(from, to string) bool {
+	for _, next := range paymentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentEvent mô tả lý do đổi trạng thái, Raw là dữ liệu gốc của cổng.
+type PaymentEvent struct {
+	Source    string
+	Note      string
+	Raw       interface{}
+	CreatedBy string
+}
+
+func (ev PaymentEvent) rawJSON() string {
+	if ev.Raw == nil {
+		return ""
+	}
+	raw, err := json.Marshal(ev.Raw)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+// TransitionPayment chuyển p sang trạng thái to và ghi payment_transitions.
+// Câu UPDATE có điều kiện Status cũ, nếu giao dịch vừa bị xử lý ở nơi khác thì
+// trả về ErrPaymentStatusChanged. Chuyển sang chính trạng thái hiện tại (callback
+// gửi lại) là no-op, trừ partially_refunded.
+func TransitionPayment(tx *gorm.DB, p *models.Payment, to string, ev PaymentEvent, updates map[string]interface{}) error {
+	from := p.Status
+	if from == to && to != PaymentPartiallyRefunded {
+		return nil
+	}
+	if !CanTransitionPayment(from, to) {
+		return &PaymentTransitionError{From: from, To: to}
+	}
+
+	values := map[string]interface{}{"Status": to}
+	for k, v := range updates {
+		values[k] = v
+	}
+	return tx.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Payment{}).
+			Where("PaymentID = ? AND Status = ?", p.PaymentID, from).
+			Updates(values)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrPaymentStatusChanged
+		}
+
+		if err := tx.Create(&models.PaymentTransition{
+			PaymentID:  p.PaymentID,
+			FromStatus: from,
+			ToStatus:   to,
+			Source:     ev.Source,
+			Note:       ev.Note,
+			RawPayload: ev.rawJSON(),
+			CreatedBy:  ev.CreatedBy,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.First(p, p.PaymentID).Error
+	})
+}
+
+// CreatePaymentRecord lưu lần thanh toán mới của phiên thanh toán ở trạng thái
+// pending, trước khi gửi sang cổng thanh toán. Điểm chỉ được kiểm tra số dư ở
+// đây; điểm bị trừ khi tạo đơn hàng (FinalizePaidOrder) nên lần thanh toán bỏ
+// dở không giữ điểm của khách.
+func CreatePaymentRecord(db *gorm.DB, provider, paymentRef string, checkout *models.PendingCheckout) (*models.Payment, error) {
+	payload, err := CheckoutPayloadOf(checkout)
+	if err != nil {
+		return nil, err
+	}
+	p := &models.Payment{
+		CheckoutID: &checkout.PendingCheckoutID,
+		PointsUsed: payload.Order.PointsUsed,
+		ShowtimeID: payload.Order.ShowtimeID,
+		AccountID:  payload.Order.AccountID,
+		Email:      payload.Order.Email,
+		Provider:   provider,
+		PaymentRef: paymentRef,
+		Amount:     payload.Order.Total,
+		Status:     PaymentPending,
+	}
+	if p.PointsUsed > 0 {
+		var enough int64
+		if err := db.Model(&models.Account{}).
+			Where("AccountID = ? AND Point >= ?", p.AccountID, p.PointsUsed).
+			Count(&enough).Error; err != nil {
+			return nil, err
+		}
+		if enough == 0 {
+			return nil, ErrInsufficientPoints
+		}
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(p).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PaymentTransition{
+			PaymentID: p.PaymentID,
+			ToStatus:  PaymentPending,
+			Source:    PaymentSourceCreate,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// FindPaymentByRef trả về giao dịch theo mã đã gửi sang cổng, nil nếu không có.
+func FindPaymentByRef(db *gorm.DB, paymentRef string) (*models.Payment, error) {
+	var p models.Payment
+	err := db.Where("PaymentRef = ?", paymentRef).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PaymentCheckoutPayload đọc lại dữ liệu đơn hàng từ phiên thanh toán của
+// giao dịch (giao dịch cũ lưu thẳng trong payments.Payload).
+func PaymentCheckoutPayload(db *gorm.DB, p *models.Payment) (CheckoutPayload, error) {
+	if p.CheckoutID == nil {
+		var payload CheckoutPayload
+		err := json.Unmarshal([]byte(p.Payload), &payload)
+		return payload, err
+	}
+	var checkout models.PendingCheckout
+	if err := db.First(&checkout, *p.CheckoutID).Error; err != nil {
+		return CheckoutPayload{}, err
+	}
+	return CheckoutPayloadOf(&checkout)
+}
+
+// paymentCheckoutRef là mã phiên thanh toán đã gửi kèm giao dịch qua cổng.
+func paymentCheckoutRef(db *gorm.DB, p *models.Payment) (string, error) {
+	if p.CheckoutID == nil {
+		return "", nil
+	}
+	var ref string
+	err := db.Model(&models.PendingCheckout{}).
+		Where("PendingCheckoutID = ?", *p.CheckoutID).
+		Pluck("CheckoutRef", &ref).Error
+	return ref, err
+}
+
+// PaymentResult là kết quả giao dịch do cổng thanh toán báo về (callback hoặc
+// tra cứu).
+type PaymentResult struct {
+	Provider  string
+	Ref       string
+	TransID   string
+	Amount    int64
+	Status    payment.Status
+	Message   string
+	ExtraData string // mã phiên thanh toán cổng gửi lại (nếu cổng hỗ trợ)
+	Raw       interface{}
+	Source    string
+}
+
+// ApplyPaymentResult cập nhật giao dịch theo kết quả của cổng và tạo đơn hàng
+// khi giao dịch thành công. Dữ liệu đơn hàng chỉ đọc từ phiên thanh toán lưu ở
+// server; ExtraData cổng gửi lại phải khớp mã phiên. Trả về đơn hàng (nếu có)
+// và created = true khi đơn vừa được tạo.
+func ApplyPaymentResult(db *gorm.DB, result PaymentResult) (*models.Order, bool, error) {
+	p, err := FindPaymentByRef(db, result.Ref)
+	if err != nil {
+		return nil, false, err
+	}
+	if p == nil {
+		return nil, false, ErrPaymentNotFound
+	}
+	if result.ExtraData != "" {
+		ref, err := paymentCheckoutRef(db, p)
+		if err != nil {
+			return nil, false, err
+		}
+		if ref != "" && ref != result.ExtraData {
+			return nil, false, ErrPaymentNotFound
+		}
+	}
+
+	event := PaymentEvent{Source: result.Source, Note: result.Message, Raw: result.Raw}
+	switch result.Status {
+	case payment.StatusPaid:
+	case payment.StatusFailed:
+		return nil, false, TransitionPayment(db, p, PaymentFailed, event, nil)
+	default:
+		return nil, false, nil
+	}
+
+	payload, err := PaymentCheckoutPayload(db, p)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := VerifyQuote(payload.Quote); err != nil {
+		return nil, false, err
+	}
+	if result.Amount != int64(p.Amount) || result.Amount != int64(payload.Quote.Total) {
+		return nil, false, ErrPaymentAmountMismatch
+	}
+
+	err = TransitionPayment(db, p, PaymentCaptured, event, map[string]interface{}{"TransID": result.TransID})
+	if errors.Is(err, ErrPaymentStatusChanged) {
+		// Một callback khác vừa xử lý cùng giao dịch
+		if err = db.First(p, p.PaymentID).Error; err == nil && p.Status != PaymentCaptured {
+			err = &PaymentTransitionError{From: p.Status, To: PaymentCaptured}
+		}
+	}
+	if err != nil {
+		// Giao dịch đã hoàn tiền thì không tạo lại đơn hàng
+		return nil, false, err
+	}
+	order, created, err := FinalizePaidOrder(db, p.Provider, p.PaymentRef, result.TransID, payload)
+	var conflict *SeatConflictError
+	if errors.As(err, &conflict) || errors.Is(err, ErrInsufficientPoints) {
+		// Khách đã trả tiền nhưng không còn ghế hoặc không đủ điểm: hoàn tiền
+		refund, rerr := refundUnfulfilledPayment(db, p, err.Error())
+		if rerr != nil {
+			return nil, false, rerr
+		}
+		return nil, false, &UnfulfilledPaymentError{RefundID: refund.RefundID, Err: err}
+	}
+	return order, created, err
+}
+
+// CompletePointsOnlyOrder tạo đơn hàng trả hoàn toàn bằng điểm: ghi giao dịch
+// captured, tạo đơn và trừ điểm trong cùng một transaction.
+func CompletePointsOnlyOrder(db *gorm.DB, paymentRef string, checkout *models.PendingCheckout) (*models.Order, error) {
+	payload, err := CheckoutPayloadOf(checkout)
+	if err != nil {
+		return nil, err
+	}
+	var order *models.Order
+	err = db.Transaction(func(tx *gorm.DB) error {
+		p, err := CreatePaymentRecord(tx, PaymentProviderPoints, paymentRef, checkout)
+		if err != nil {
+			return err
+		}
+		if err := TransitionPayment(tx, p, PaymentCaptured, PaymentEvent{
+			Source: PaymentSourceCreate,
+			Note:   fmt.Sprintf("Thanh toán bằng %d điểm", p.PointsUsed),
+		}, nil); err != nil {
+			return err
+		}
+		order, _, err = FinalizePaidOrder(tx, PaymentProviderPoints, paymentRef, "", payload)
+		return err
+	})
+	return order, err
+}
@@ -0,0 +1,427 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"movie-ticket-booking/config"
+	"movie-ticket-booking/models"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DiscountCodePoints là dòng giảm giá khi trả bằng điểm tích lũy.
+const DiscountCodePoints = "POINTS"
+
+var (
+	ErrInsufficientPoints  = errors.New("số điểm tích lũy không đủ")
+	ErrPointsRequireLogin  = errors.New("cần đăng nhập để dùng điểm tích lũy")
+	ErrShowtimeNotBookable = errors.New("suất chiếu không còn mở bán")
+	ErrEmptyQuote          = errors.New("đơn hàng chưa có ghế nào")
+	ErrInvalidQuote        = errors.New("báo giá không hợp lệ")
+)
+
+// QuoteRequest là những gì người mua chọn; giá luôn được tính lại ở server.
+type QuoteRequest struct {
+	ShowtimeID      int                `json:"ShowtimeID"`
+	ShowtimeSeatIDs []int              `json:"ShowtimeSeatIDs"`
+	Foods           []QuoteFoodRequest `json:"Foods"`
+	Points          int                `json:"Points"` // số điểm muốn dùng
+	AccountID       int                `json:"-"`      // người mua, lấy từ token
+}
+
+type QuoteFoodRequest struct {
+	FoodID   int `json:"FoodID"`
+	Quantity int `json:"Quantity"`
+}
+
+// QuoteLine là một dòng của báo giá: một ghế hoặc một món ăn.
+type QuoteLine struct {
+	ID        int    `json:"ID"` // ShowtimeSeatID hoặc FoodID
+	Name      string `json:"Name"`
+	Quantity  int    `json:"Quantity"`
+	UnitPrice int    `json:"UnitPrice"`
+	Amount    int    `json:"Amount"`
+}
+
+type QuoteDiscount struct {
+	Code   string `json:"Code"`
+	Name   string `json:"Name"`
+	Amount int    `json:"Amount"`
+}
+
+// Quote là báo giá chi tiết do server tính và ký. Bước thanh toán chỉ thu đúng
+// Total của báo giá.
+type Quote struct {
+	ShowtimeID    int             `json:"ShowtimeID"`
+	Seats         []QuoteLine     `json:"Seats"`
+	Foods         []QuoteLine     `json:"Foods"`
+	Discounts     []QuoteDiscount `json:"Discounts"`
+	Subtotal      int             `json:"Subtotal"`
+	DiscountTotal int             `json:"DiscountTotal"`
+	Total         int             `json:"Total"`
+	PointsUsed    int             `json:"PointsUsed"`
+	AccountID     int             `json:"AccountID"`
+	IssuedAt      time.Time       `json:"IssuedAt"`
+	ExpiresAt     time.Time       `json:"ExpiresAt"`
+	Signature     string          `json:"Signature"`
+}
+
+// QuoteItemError liệt kê các món ăn không bán được hoặc số điểm tích lũy vượt
+// giới hạn trong báo giá.
+type QuoteItemError struct {
+	Problems []string
+}
+
+func (e *QuoteItemError) Error() string {
+	return "Báo giá không hợp lệ: " + strings.Join(e.Problems, "; ")
+}
+
+// PriceDiff là một khoản mà client và server tính khác nhau.
+type PriceDiff struct {
+	Item   string `json:"Item"`
+	Client int    `json:"Client"`
+	Server int    `json:"Server"`
+}
+
+// PriceMismatchError được trả về khi số tiền client gửi lên khác báo giá.
+type PriceMismatchError struct {
+	Diffs []PriceDiff
+	Quote *Quote
+}
+
+func (e *PriceMismatchError) Error() string {
+	parts := make([]string, 0, len(e.Diffs))
+	for _, d := range e.Diffs {
+		parts = append(parts, fmt.Sprintf("%s: %d ≠ %d", d.Item, d.Client, d.Server))
+	}
+	return "Giá đã thay đổi, vui lòng kiểm tra lại đơn hàng (" + strings.Join(parts, ", ") + ")"
+}
+
+// ComputeQuote tính giá vé theo showtime_seats.TicketPrice và giá món ăn theo
+// foods.Price của chi nhánh. Ghế không thuộc suất chiếu hoặc đã bán trả về
+// *SeatConflictError, món ăn hoặc số điểm không hợp lệ trả về *QuoteItemError.
+func ComputeQuote(db *gorm.DB, req QuoteRequest) (*Quote, error) {
+	var showtime struct {
+		Status   int
+		BranchID int
+	}
+	if err := db.Raw(`
+		SELECT st.Status, t.BranchID
+		FROM showtimes st
+		JOIN theaters t ON t.TheaterID = st.TheaterID
+		WHERE st.ShowtimeID = ?
+	`, req.ShowtimeID).Scan(&showtime).Error; err != nil {
+		return nil, err
+	}
+	if showtime.BranchID == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if showtime.Status != 1 {
+		return nil, ErrShowtimeNotBookable
+	}
+
+	seatIDs := uniqueIDs(req.ShowtimeSeatIDs)
+	if len(seatIDs) == 0 {
+		return nil, ErrEmptyQuote
+	}
+
+	quote := &Quote{ShowtimeID: req.ShowtimeID, Seats: []QuoteLine{}, Foods: []QuoteLine{}, Discounts: []QuoteDiscount{}}
+	if err := quoteSeats(db, quote, seatIDs); err != nil {
+		return nil, err
+	}
+	foods, err := quoteFoods(db, showtime.BranchID, req.Foods)
+	if err != nil {
+		return nil, err
+	}
+	quote.Foods = append(quote.Foods, foods...)
+
+	quote.AccountID = req.AccountID
+	quote.recalculate()
+	if err := applyPoints(db, quote, req.Points); err != nil {
+		return nil, err
+	}
+
+	ttl, err := HoldTTL(db, req.ShowtimeID)
+	if err != nil {
+		return nil, err
+	}
+	quote.IssuedAt = time.Now().Truncate(time.Second)
+	quote.ExpiresAt = quote.IssuedAt.Add(ttl)
+	quote.sign()
+	return quote, nil
+}
+
+func quoteSeats(db *gorm.DB, quote *Quote, ids []int) error {
+	var seats []struct {
+		ShowtimeSeatID int
+		RowName        string
+		SeatNumber     int
+		TicketPrice    int
+		Status         int8
+	}
+	if err := db.Raw(`
+		SELECT ss.ShowtimeSeatID, r.RowName, s.SeatNumber, ss.TicketPrice, ss.Status
+		FROM showtime_seats ss
+		JOIN seats s ON ss.SeatID = s.SeatID
+		JOIN `+"`rows`"+` r ON s.RowID = r.RowID
+		WHERE ss.ShowtimeID = ? AND ss.ShowtimeSeatID IN ?
+		ORDER BY r.RowName, s.SeatNumber
+	`, quote.ShowtimeID, ids).Scan(&seats).Error; err != nil {
+		return err
+	}
+
+	found := make(map[int]bool, len(seats))
+	var conflicts []SeatConflict
+	for _, seat := range seats {
+		found[seat.ShowtimeSeatID] = true
+		if seat.Status == SeatStatusSold {
+			conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: seat.ShowtimeSeatID, RowName: seat.RowName, SeatNumber: seat.SeatNumber, Reason: "sold"})
+			continue
+		}
+		quote.Seats = append(quote.Seats, QuoteLine{
+			ID:        seat.ShowtimeSeatID,
+			Name:      fmt.Sprintf("%s%d", seat.RowName, seat.SeatNumber),
+			Quantity:  1,
+			UnitPrice: seat.TicketPrice,
+			Amount:    seat.TicketPrice,
+		})
+	}
+	for _, id := range ids {
+		if !found[id] {
+			conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, Reason: "not_found"})
+		}
+	}
+	if len(conflicts) > 0 {
+		return &SeatConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+func quoteFoods(db *gorm.DB, branchID int, items []QuoteFoodRequest) ([]QuoteLine, error) {
+	lines := []QuoteLine{}
+	quantities := map[int]int{}
+	var order []int
+	var problems []string
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			problems = append(problems, fmt.Sprintf("món #%d có số lượng %d", item.FoodID, item.Quantity))
+			continue
+		}
+		if _, ok := quantities[item.FoodID]; !ok {
+			order = append(order, item.FoodID)
+		}
+		quantities[item.FoodID] += item.Quantity
+	}
+	if len(order) == 0 {
+		if len(problems) > 0 {
+			return nil, &QuoteItemError{Problems: problems}
+		}
+		return lines, nil
+	}
+
+	var foods []models.Food
+	if err := db.Where("FoodID IN ?", order).Find(&foods).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int]models.Food, len(foods))
+	for _, food := range foods {
+		byID[food.FoodID] = food
+	}
+
+	for _, id := range order {
+		food, ok := byID[id]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("món #%d không tồn tại", id))
+		case food.BranchID != branchID:
+			problems = append(problems, fmt.Sprintf("%s không bán tại chi nhánh này", food.FoodName))
+		case !food.Status:
+			problems = append(problems, fmt.Sprintf("%s đã ngừng bán", food.FoodName))
+		default:
+			lines = append(lines, QuoteLine{
+				ID:        food.FoodID,
+				Name:      food.FoodName,
+				Quantity:  quantities[id],
+				UnitPrice: food.Price,
+				Amount:    food.Price * quantities[id],
+			})
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &QuoteItemError{Problems: problems}
+	}
+	return lines, nil
+}
+
+// applyPoints quy đổi điểm tích lũy thành giảm giá theo POINTS_VALUE_VND, giới
+// hạn bởi số dư, POINTS_MAX_PERCENT giá trị đơn và POINTS_MAX_PER_ORDER. Số
+// điểm vượt giới hạn không bị cắt bớt mà trả về *QuoteItemError nêu rõ giới hạn
+// để khách chọn lại.
+func applyPoints(db *gorm.DB, quote *Quote, points int) error {
+	if points <= 0 {
+		return nil
+	}
+	if quote.AccountID == 0 {
+		return ErrPointsRequireLogin
+	}
+
+	var balance int
+	if err := db.Model(&models.Account{}).Where("AccountID = ?", quote.AccountID).
+		Select("Point").Scan(&balance).Error; err != nil {
+		return err
+	}
+
+	cfg := config.GetPointsConfig()
+	if cfg.ValueVND <= 0 {
+		return &QuoteItemError{Problems: []string{"chưa hỗ trợ dùng điểm tích lũy"}}
+	}
+	var problems []string
+	if points > balance {
+		problems = append(problems, fmt.Sprintf("số dư chỉ có %d điểm, không đủ dùng %d điểm", balance, points))
+	}
+	if maxPercent := quote.Subtotal * cfg.MaxPercent / 100 / cfg.ValueVND; points > maxPercent {
+		problems = append(problems, fmt.Sprintf("chỉ được dùng tối đa %d điểm (%d%% giá trị đơn hàng)", maxPercent, cfg.MaxPercent))
+	}
+	if cfg.MaxPointsPerOrder > 0 && points > cfg.MaxPointsPerOrder {
+		problems = append(problems, fmt.Sprintf("chỉ được dùng tối đa %d điểm mỗi đơn hàng", cfg.MaxPointsPerOrder))
+	}
+	if len(problems) > 0 {
+		return &QuoteItemError{Problems: problems}
+	}
+
+	quote.PointsUsed = points
+	quote.Discounts = append(quote.Discounts, QuoteDiscount{
+		Code:   DiscountCodePoints,
+		Name:   fmt.Sprintf("Dùng %d điểm tích lũy", points),
+		Amount: points * cfg.ValueVND,
+	})
+	quote.recalculate()
+	return nil
+}
+
+// recalculate cộng lại Subtotal/DiscountTotal/Total từ các dòng của báo giá.
+// Giảm giá không vượt quá Subtotal.
+func (q *Quote) recalculate() {
+	q.Subtotal = 0
+	for _, line := range q.Seats {
+		q.Subtotal += line.Amount
+	}
+	for _, line := range q.Foods {
+		q.Subtotal += line.Amount
+	}
+	q.DiscountTotal = 0
+	for _, d := range q.Discounts {
+		q.DiscountTotal += d.Amount
+	}
+	if q.DiscountTotal > q.Subtotal {
+		q.DiscountTotal = q.Subtotal
+	}
+	q.Total = q.Subtotal - q.DiscountTotal
+}
+
+func (q *Quote) computeSignature() string {
+	unsigned := *q
+	unsigned.Signature = ""
+	raw, _ := json.Marshal(unsigned)
+	h := hmac.New(sha256.New, config.GetQuoteSecret())
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (q *Quote) sign() {
+	q.Signature = q.computeSignature()
+}
+
+// VerifyQuote kiểm tra báo giá do server ký và chưa bị sửa. Không kiểm tra
+// hạn: giao dịch đã thanh toán vẫn được ghi nhận dù callback tới muộn.
+func VerifyQuote(q *Quote) error {
+	if q == nil || q.Signature == "" {
+		return ErrInvalidQuote
+	}
+	if !hmac.Equal([]byte(q.computeSignature()), []byte(q.Signature)) {
+		return ErrInvalidQuote
+	}
+	return nil
+}
+
+// CompareClientTotals so sánh tổng tiền và tiền từng món client gửi lên với
+// báo giá; khác nhau thì trả về *PriceMismatchError kèm chi tiết.
+func CompareClientTotals(q *Quote, clientTotal int, clientFoods []models.OrderFood) error {
+	var diffs []PriceDiff
+
+	clientFoodTotals := map[int]int{}
+	for _, food := range clientFoods {
+		clientFoodTotals[food.FoodID] += food.TotalPrice
+	}
+	serverFoodTotals := map[int]QuoteLine{}
+	for _, line := range q.Foods {
+		serverFoodTotals[line.ID] = line
+	}
+	foodIDs := make([]int, 0, len(clientFoodTotals))
+	for id := range clientFoodTotals {
+		foodIDs = append(foodIDs, id)
+	}
+	sort.Ints(foodIDs)
+	for _, id := range foodIDs {
+		line := serverFoodTotals[id]
+		if clientFoodTotals[id] != line.Amount {
+			name := line.Name
+			if name == "" {
+				name = fmt.Sprintf("món #%d", id)
+			}
+			diffs = append(diffs, PriceDiff{Item: name, Client: clientFoodTotals[id], Server: line.Amount})
+		}
+	}
+
+	if clientTotal != q.Total {
+		diffs = append(diffs, PriceDiff{Item: "Total", Client: clientTotal, Server: q.Total})
+	}
+	if len(diffs) > 0 {
+		return &PriceMismatchError{Diffs: diffs, Quote: q}
+	}
+	return nil
+}
+
+// QuoteRequestFromCheckout lấy ra lựa chọn ghế và món ăn của đơn hàng.
+func QuoteRequestFromCheckout(payload CheckoutPayload) QuoteRequest {
+	req := QuoteRequest{
+		ShowtimeID:      payload.Order.ShowtimeID,
+		ShowtimeSeatIDs: payload.ShowtimeSeatUpdate.ShowtimeSeatIDs,
+		Points:          payload.Order.PointsUsed,
+		AccountID:       payload.Order.AccountID,
+	}
+	for _, food := range payload.OrderFoods {
+		req.Foods = append(req.Foods, QuoteFoodRequest{FoodID: food.FoodID, Quantity: food.Quantity})
+	}
+	return req
+}
+
+// ApplyQuote ghi giá của báo giá vào đơn hàng: Total và TotalPrice của từng
+// món đều lấy từ server. Suất chiếu và danh sách ghế cũng lấy theo báo giá đã
+// ký để ghế luôn thuộc đúng suất chiếu của đơn.
+func ApplyQuote(payload *CheckoutPayload, q *Quote) {
+	payload.Order.ShowtimeID = q.ShowtimeID
+	payload.ShowtimeSeatUpdate.ShowtimeSeatIDs = make([]int, 0, len(q.Seats))
+	for _, line := range q.Seats {
+		payload.ShowtimeSeatUpdate.ShowtimeSeatIDs = append(payload.ShowtimeSeatUpdate.ShowtimeSeatIDs, line.ID)
+	}
+	payload.Order.Total = q.Total
+	payload.Order.PointsUsed = q.PointsUsed
+	payload.Order.AccountID = q.AccountID
+	payload.OrderFoods = make([]models.OrderFood, 0, len(q.Foods))
+	for _, line := range q.Foods {
+		payload.OrderFoods = append(payload.OrderFoods, models.OrderFood{
+			FoodID:     line.ID,
+			Quantity:   line.Quantity,
+			TotalPrice: line.Amount,
+		})
+	}
+	payload.Quote = q
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"movie-ticket-booking/config"
+	"movie-ticket-booking/models"
+	"movie-ticket-booking/payment"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const reconcileQueryTimeout = 20 * time.Second
+
+// ReconcileResult là kết quả tra cứu lại một giao dịch pending.
+type ReconcileResult struct {
+	PaymentID  int    `json:"PaymentID"`
+	PaymentRef string `json:"PaymentRef"`
+	Provider   string `json:"Provider"`
+	Status     string `json:"Status"` // trạng thái giao dịch sau khi đối soát
+	OrderID    int    `json:"OrderID,omitempty"`
+	Error      string `json:"Error,omitempty"`
+}
+
+// ReconcilePendingPayments tra cứu ở cổng thanh toán mọi giao dịch còn pending
+// sau olderThan: thanh toán thành công thì tạo đơn hàng, thất bại hoặc quá
+// PAYMENT_EXPIRE_MINUTES thì chuyển failed/expired và trả ghế người mua đang
+// giữ.
+func ReconcilePendingPayments(db *gorm.DB, olderThan time.Duration) ([]ReconcileResult, error) {
+	now := time.Now()
+	var pending []models.Payment
+	if err := db.Where("Status IN ? AND CreatedAt <= ?", []string{PaymentPending, PaymentAuthorized}, now.Add(-olderThan)).
+		Order("PaymentID").Find(&pending).Error; err != nil {
+		return nil, err
+	}
+
+	expireBefore := now.Add(-time.Duration(config.GetPaymentExpireMinutes()) * time.Minute)
+	results := make([]ReconcileResult, 0, len(pending))
+	for i := range pending {
+		p := &pending[i]
+		result := ReconcileResult{PaymentID: p.PaymentID, PaymentRef: p.PaymentRef, Provider: p.Provider, Status: p.Status}
+		if err := reconcilePayment(db, p, expireBefore, &result); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func reconcilePayment(db *gorm.DB, p *models.Payment, expireBefore time.Time, result *ReconcileResult) error {
+	provider, err := payment.Get(p.Provider)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileQueryTimeout)
+	defer cancel()
+	query, err := provider.QueryStatus(ctx, payment.QueryRequest{
+		OrderRef:  p.PaymentRef,
+		TransID:   p.TransID,
+		Amount:    int64(p.Amount),
+		CreatedAt: p.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch query.Status {
+	case payment.StatusPaid, payment.StatusFailed:
+		order, _, err := ApplyPaymentResult(db, PaymentResult{
+			Provider: p.Provider,
+			Ref:      p.PaymentRef,
+			TransID:  query.TransID,
+			Amount:   query.Amount,
+			Status:   query.Status,
+			Message:  query.Message,
+			Raw:      query.Raw,
+			Source:   PaymentSourceQuery,
+		})
+		if order != nil {
+			result.OrderID = order.OrderID
+		}
+		var unfulfilled *UnfulfilledPaymentError
+		if errors.As(err, &unfulfilled) {
+			if _, err := ProcessRefund(db, unfulfilled.RefundID); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+	case payment.StatusPending:
+		if p.CreatedAt.After(expireBefore) {
+			return nil
+		}
+		if err := TransitionPayment(db, p, PaymentExpired, PaymentEvent{
+			Source: PaymentSourceQuery,
+			Note:   "Quá hạn thanh toán",
+			Raw:    query.Raw,
+		}, nil); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("trạng thái %q không hợp lệ", query.Status)
+	}
+
+	if err := db.First(p, p.PaymentID).Error; err != nil {
+		return err
+	}
+	result.Status = p.Status
+	if p.Status == PaymentFailed || p.Status == PaymentExpired {
+		return releasePaymentHolds(db, p)
+	}
+	return nil
+}
+
+// releasePaymentHolds trả các ghế của giao dịch không thành công đã hết hạn
+// giữ. Ghế người mua còn giữ chỉ được trả khi người mua không còn phiên thanh
+// toán mở hoặc giao dịch khác đang chờ cho suất chiếu này, vì lượt giữ đó có
+// thể thuộc một lần thanh toán mới hơn.
+func releasePaymentHolds(db *gorm.DB, p *models.Payment) error {
+	payload, err := PaymentCheckoutPayload(db, p)
+	if err != nil {
+		return err
+	}
+	ids := uniqueIDs(payload.ShowtimeSeatUpdate.ShowtimeSeatIDs)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	owner, err := paymentHoldOwner(db, p.PaymentRef, p.AccountID)
+	if err != nil {
+		return err
+	}
+	active, err := hasActiveCheckout(db, p, owner, now)
+	if err != nil {
+		return err
+	}
+	if active || (owner.AccountID == 0 && owner.HoldToken == "") {
+		return db.Exec(`
+			UPDATE showtime_seats
+			SET `+clearHoldSQL+`
+			WHERE ShowtimeID = ? AND ShowtimeSeatID IN ? AND Status = ? AND HoldExpiresAt <= ?
+		`, p.ShowtimeID, ids, SeatStatusHeld, now).Error
+	}
+
+	ownerSQL, ownerArg := owner.ownerCondition("")
+	return db.Exec(`
+		UPDATE showtime_seats
+		SET `+clearHoldSQL+`
+		WHERE ShowtimeID = ? AND ShowtimeSeatID IN ? AND Status = ?
+		  AND (HoldExpiresAt <= ? OR `+ownerSQL+`)
+	`, p.ShowtimeID, ids, SeatStatusHeld, now, ownerArg).Error
+}
+
+// hasActiveCheckout cho biết người mua của giao dịch p còn phiên thanh toán
+// chưa hết hạn hoặc giao dịch khác đang chờ cho cùng suất chiếu.
+func hasActiveCheckout(db *gorm.DB, p *models.Payment, owner HoldOwner, now time.Time) (bool, error) {
+	checkouts := db.Model(&models.PendingCheckout{}).
+		Where("ShowtimeID = ? AND Status = ? AND ExpiresAt > ?", p.ShowtimeID, CheckoutOpen, now)
+	payments := db.Model(&models.Payment{}).
+		Where("PaymentID <> ? AND ShowtimeID = ? AND Status IN ?", p.PaymentID, p.ShowtimeID, []string{PaymentPending, PaymentAuthorized})
+	if owner.AccountID != 0 {
+		checkouts = checkouts.Where("AccountID = ?", owner.AccountID)
+		payments = payments.Where("AccountID = ?", owner.AccountID)
+	} else {
+		checkouts = checkouts.Where("(AccountID IS NULL OR AccountID = 0) AND HoldToken = ?", owner.HoldToken)
+		payments = payments.Where("CheckoutID IN (SELECT PendingCheckoutID FROM pending_checkouts WHERE (AccountID IS NULL OR AccountID = 0) AND HoldToken = ?)", owner.HoldToken)
+	}
+
+	var count int64
+	if err := checkouts.Count(&count).Error; err != nil || count > 0 {
+		return count > 0, err
+	}
+	err := payments.Count(&count).Error
+	return count > 0, err
+}
+
+// ReconciliationIssue là một giao dịch cần người kiểm tra.
+type ReconciliationIssue struct {
+	Type           string `json:"Type"` // amount_mismatch | captured_without_order | provider_status_mismatch | query_failed
+	PaymentID      int    `json:"PaymentID"`
+	PaymentRef     string `json:"PaymentRef"`
+	Provider       string `json:"Provider"`
+	OrderID        int    `json:"OrderID,omitempty"`
+	Amount         int    `json:"Amount"`
+	ExpectedAmount int    `json:"ExpectedAmount,omitempty"`
+	Detail         string `json:"Detail,omitempty"`
+}
+
+type ReconciliationStatusSummary struct {
+	Status string `json:"Status"`
+	Count  int    `json:"Count"`
+	Amount int    `json:"Amount"`
+}
+
+// ReconciliationReport là báo cáo đối soát các giao dịch tạo trong một ngày.
+type ReconciliationReport struct {
+	Date        string                        `json:"Date"`
+	GeneratedAt time.Time                     `json:"GeneratedAt"`
+	Statuses    []ReconciliationStatusSummary `json:"Statuses"`
+	Issues      []ReconciliationIssue         `json:"Issues"`
+}
+
+// BuildReconciliationReport đối soát các giao dịch tạo trong ngày date
+// (YYYY-MM-DD): số tiền đã thu so với đơn hàng và với cổng thanh toán, và các
+// giao dịch đã thu tiền nhưng không có đơn hàng. Báo cáo được lưu vào
+// reconciliation_reports (chạy lại cùng ngày sẽ ghi đè).
+func BuildReconciliationReport(db *gorm.DB, date string) (*ReconciliationReport, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	report := &ReconciliationReport{
+		Date:        date,
+		GeneratedAt: time.Now(),
+		Statuses:    []ReconciliationStatusSummary{},
+		Issues:      []ReconciliationIssue{},
+	}
+
+	if err := db.Raw(`
+		SELECT Status, COUNT(*) AS Count, COALESCE(SUM(Amount), 0) AS Amount
+		FROM payments
+		WHERE CreatedAt >= ? AND CreatedAt < ?
+		GROUP BY Status
+		ORDER BY Status
+	`, day, day.AddDate(0, 0, 1)).Scan(&report.Statuses).Error; err != nil {
+		return nil, err
+	}
+
+	var captured []struct {
+		PaymentID  int
+		OrderID    *int
+		Provider   string
+		PaymentRef string
+		TransID    string
+		Amount     int
+		Status     string
+		CreatedAt  time.Time
+		OrderTotal *int
+	}
+	if err := db.Raw(`
+		SELECT p.PaymentID, p.OrderID, p.Provider, p.PaymentRef, p.TransID, p.Amount, p.Status, p.CreatedAt,
+		       o.Total AS OrderTotal
+		FROM payments p
+		LEFT JOIN orders o ON o.OrderID = p.OrderID
+		WHERE p.CreatedAt >= ? AND p.CreatedAt < ?
+		  AND p.Status IN ?
+		ORDER BY p.PaymentID
+	`, day, day.AddDate(0, 0, 1), []string{PaymentCaptured, PaymentPartiallyRefunded, PaymentRefunded}).
+		Scan(&captured).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range captured {
+		p := models.Payment{
+			PaymentID:  row.PaymentID,
+			OrderID:    row.OrderID,
+			Provider:   row.Provider,
+			PaymentRef: row.PaymentRef,
+			TransID:    row.TransID,
+			Amount:     row.Amount,
+			Status:     row.Status,
+			CreatedAt:  row.CreatedAt,
+		}
+		issue := ReconciliationIssue{PaymentID: p.PaymentID, PaymentRef: p.PaymentRef, Provider: p.Provider, Amount: p.Amount}
+		if p.OrderID != nil {
+			issue.OrderID = *p.OrderID
+		}
+
+		switch {
+		case p.OrderID == nil && p.Status == PaymentCaptured:
+			issue.Type = "captured_without_order"
+			issue.Detail = "Khách đã thanh toán nhưng chưa có đơn hàng"
+			report.Issues = append(report.Issues, issue)
+		case row.OrderTotal != nil && *row.OrderTotal != p.Amount:
+			issue.Type = "amount_mismatch"
+			issue.ExpectedAmount = *row.OrderTotal
+			issue.Detail = "Số tiền giao dịch khác tổng đơn hàng"
+			report.Issues = append(report.Issues, issue)
+		}
+
+		if p.Provider == PaymentProviderPoints {
+			continue
+		}
+		if providerIssue := checkProviderAmount(p); providerIssue != nil {
+			report.Issues = append(report.Issues, *providerIssue)
+		}
+	}
+
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	record := models.ReconciliationReport{ReportDate: date}
+	err = db.Where("ReportDate = ?", date).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	record.IssueCount = len(report.Issues)
+	record.Report = string(raw)
+	if err := db.Save(&record).Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// checkProviderAmount so sánh giao dịch đã thu với kết quả tra cứu ở cổng.
+func checkProviderAmount(p models.Payment) *ReconciliationIssue {
+	issue := &ReconciliationIssue{PaymentID: p.PaymentID, PaymentRef: p.PaymentRef, Provider: p.Provider, Amount: p.Amount}
+	if p.OrderID != nil {
+		issue.OrderID = *p.OrderID
+	}
+
+	provider, err := payment.Get(p.Provider)
+	if err != nil {
+		issue.Type = "query_failed"
+		issue.Detail = err.Error()
+		return issue
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileQueryTimeout)
+	defer cancel()
+	query, err := provider.QueryStatus(ctx, payment.QueryRequest{
+		OrderRef:  p.PaymentRef,
+		TransID:   p.TransID,
+		Amount:    int64(p.Amount),
+		CreatedAt: p.CreatedAt,
+	})
+	if err != nil {
+		issue.Type = "query_failed"
+		issue.Detail = err.Error()
+		return issue
+	}
+
+	switch {
+	case query.Status != payment.StatusPaid && query.Status != payment.StatusRefunded:
+		issue.Type = "provider_status_mismatch"
+		issue.Detail = fmt.Sprintf("Cổng thanh toán báo trạng thái %s", query.Status)
+		return issue
+	case query.Amount != 0 && query.Amount != int64(p.Amount):
+		issue.Type = "amount_mismatch"
+		issue.ExpectedAmount = int(query.Amount)
+		issue.Detail = "Số tiền giao dịch khác số tiền cổng thanh toán ghi nhận"
+		return issue
+	}
+	return nil
+}
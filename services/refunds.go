@@ -0,0 +1,507 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"movie-ticket-booking/models"
+	"movie-ticket-booking/payment"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Trạng thái của refunds.Status
+const (
+	RefundPending    = "pending"
+	RefundProcessing = "processing" // cổng đã nhận yêu cầu, chưa có kết quả
+	RefundSucceeded  = "succeeded"
+	RefundFailed     = "failed"
+)
+
+// Nguồn của yêu cầu hoàn tiền
+const (
+	RefundSourceShowtimeCancel = "showtime_cancel"
+	RefundSourceCustomerCancel = "customer_cancel"
+	RefundSourceSeatConflict   = "seat_conflict" // đã thu tiền nhưng không tạo được đơn (hết ghế/không đủ điểm)
+)
+
+const refundTimeout = 60 * time.Second
+
+var ErrShowtimeAlreadyCancelled = errors.New("suất chiếu đã bị hủy trước đó")
+
+// VoidOrder hủy hiệu lực đơn hàng trong tx: trả ghế về trạng thái trống, trừ
+// lại điểm đã cộng khi mua, hoàn điểm khách đã dùng và chuyển đơn sang
+// cancelled. Trả về danh sách ghế của đơn (để lưu lại vì ghế không còn gắn với
+// đơn) và số điểm đã trừ.
+func VoidOrder(tx *gorm.DB, order *models.Order) (seats string, points int, err error) {
+	var labels []string
+	if err := tx.Raw(`
+		SELECT CONCAT(r.RowName, s.SeatNumber)
+		FROM showtime_seats ss
+		JOIN seats s ON s.SeatID = ss.SeatID
+		JOIN `+"`rows`"+` r ON r.RowID = s.RowID
+		WHERE ss.OrderID = ?
+		ORDER BY r.RowName, s.SeatNumber
+	`, order.OrderID).Scan(&labels).Error; err != nil {
+		return "", 0, err
+	}
+
+	if err := tx.Exec(`
+		UPDATE showtime_seats
+		SET `+clearHoldSQL+`, OrderID = NULL
+		WHERE OrderID = ?
+	`, order.OrderID).Error; err != nil {
+		return "", 0, err
+	}
+
+	// Trừ điểm đã cộng khi mua và trả lại điểm khách đã dùng. Đơn tạo trước khi
+	// có PointsEarned được cộng điểm bằng Total.
+	if order.AccountID != 0 {
+		points = order.PointsEarned
+		if points == 0 && order.PointsUsed == 0 {
+			points = order.Total
+		}
+		if points > 0 || order.PointsUsed > 0 {
+			if err := tx.Model(&models.Account{}).
+				Where("AccountID = ?", order.AccountID).
+				Update("Point", gorm.Expr("GREATEST(Point - ? + ?, 0)", points, order.PointsUsed)).Error; err != nil {
+				return "", 0, err
+			}
+		}
+	}
+
+	if err := VoidOrderTicket(tx, order.OrderID); err != nil {
+		return "", 0, err
+	}
+	if err := tx.Model(order).Update("Status", OrderStatusCancelled).Error; err != nil {
+		return "", 0, err
+	}
+	return strings.Join(labels, ", "), points, nil
+}
+
+// UnfulfilledPaymentError: giao dịch đã thu tiền nhưng không tạo được đơn
+// hàng (Err là SeatConflictError hoặc ErrInsufficientPoints); yêu cầu hoàn tiền RefundID đã được
+// tạo, gọi ProcessRefund để thực hiện.
+type UnfulfilledPaymentError struct {
+	RefundID int
+	Err      error
+}
+
+func (e *UnfulfilledPaymentError) Error() string {
+	return fmt.Sprintf("không tạo được đơn hàng, đã tạo yêu cầu hoàn tiền #%d: %v", e.RefundID, e.Err)
+}
+
+func (e *UnfulfilledPaymentError) Unwrap() error { return e.Err }
+
+// refundUnfulfilledPayment tạo yêu cầu hoàn tiền (pending) cho giao dịch đã thu
+// tiền mà không tạo được đơn hàng. Điểm chỉ bị trừ khi tạo đơn nên không có
+// điểm cần trả lại. Gọi lại nhiều lần (callback lặp) chỉ tạo một yêu cầu.
+func refundUnfulfilledPayment(db *gorm.DB, p *models.Payment, reason string) (*models.Refund, error) {
+	var refund models.Refund
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, p.PaymentID).Error; err != nil {
+			return err
+		}
+		err := tx.Where("PaymentID = ? AND Source = ?", locked.PaymentID, RefundSourceSeatConflict).First(&refund).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if len(reason) > 255 {
+			reason = reason[:255]
+		}
+		refund = models.Refund{
+			PaymentID:  &locked.PaymentID,
+			ShowtimeID: locked.ShowtimeID,
+			Source:     RefundSourceSeatConflict,
+			Amount:     locked.Amount - locked.RefundedAmount,
+			Reason:     reason,
+			Status:     RefundPending,
+			CreatedBy:  "system",
+		}
+		return tx.Create(&refund).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// refundablePayment trả về giao dịch đã thu tiền của đơn hàng, nil nếu đơn
+// không thanh toán qua cổng (ví dụ đơn tạo tại quầy).
+func refundablePayment(tx *gorm.DB, orderID int) (*models.Payment, error) {
+	var p models.Payment
+	err := tx.Where("OrderID = ? AND Status IN ?", orderID, []string{PaymentCaptured, PaymentPartiallyRefunded}).
+		Order("PaymentID DESC").First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CancelShowtimeWithRefunds hủy suất chiếu và, trong cùng transaction, hủy mọi
+// đơn hàng đã thanh toán của suất chiếu đó và tạo yêu cầu hoàn tiền ở trạng
+// thái pending. Việc gọi cổng thanh toán do ProcessShowtimeRefunds thực hiện.
+func CancelShowtimeWithRefunds(db *gorm.DB, showtimeID int, reason, by string) ([]models.Refund, error) {
+	var refunds []models.Refund
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Showtime{}).
+			Where("ShowtimeID = ? AND Status <> ?", showtimeID, 2).
+			Updates(map[string]interface{}{
+				"Status":        2,
+				"CancelReason":  reason,
+				"LastUpdatedAt": time.Now(),
+				"LastUpdatedBy": by,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrShowtimeAlreadyCancelled
+		}
+
+		// Ghế đang giữ của suất chiếu không còn ý nghĩa
+		if err := tx.Exec(`
+			UPDATE showtime_seats SET `+clearHoldSQL+`
+			WHERE ShowtimeID = ? AND Status = ?
+		`, showtimeID, SeatStatusHeld).Error; err != nil {
+			return err
+		}
+
+		var orders []models.Order
+		if err := tx.Where("ShowtimeID = ? AND Status = ?", showtimeID, OrderStatusPaid).Find(&orders).Error; err != nil {
+			return err
+		}
+
+		for i := range orders {
+			order := &orders[i]
+			p, err := refundablePayment(tx, order.OrderID)
+			if err != nil {
+				return err
+			}
+			seats, points, err := VoidOrder(tx, order)
+			if err != nil {
+				return err
+			}
+
+			refund := models.Refund{
+				OrderID:        order.OrderID,
+				ShowtimeID:     showtimeID,
+				Source:         RefundSourceShowtimeCancel,
+				Amount:         order.Total,
+				Reason:         reason,
+				Status:         RefundPending,
+				Seats:          seats,
+				PointsReversed: points,
+				CreatedBy:      by,
+			}
+			if p != nil {
+				refund.PaymentID = &p.PaymentID
+				refund.Amount = p.Amount - p.RefundedAmount
+			}
+			if err := tx.Create(&refund).Error; err != nil {
+				return err
+			}
+			refunds = append(refunds, refund)
+		}
+		return nil
+	})
+	return refunds, err
+}
+
+// ProcessRefund gửi yêu cầu hoàn tiền sang cổng thanh toán của giao dịch gốc.
+// Yêu cầu đang pending hoặc failed mới được xử lý; thành công thì giao dịch
+// chuyển sang refunded/partially_refunded và đơn sang refunded.
+//
+// Yêu cầu được nhận xử lý bằng một UPDATE có điều kiện (chuyển sang processing)
+// nên khi nhiều tiến trình cùng xử lý (hủy suất chiếu và bấm thử lại) chỉ một
+// tiến trình gọi cổng thanh toán.
+func ProcessRefund(db *gorm.DB, refundID int) (*models.Refund, error) {
+	res := db.Model(&models.Refund{}).
+		Where("RefundID = ? AND Status IN ?", refundID, []string{RefundPending, RefundFailed}).
+		Updates(map[string]interface{}{
+			"Status":   RefundProcessing,
+			"Attempts": gorm.Expr("Attempts + 1"),
+		})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	var refund models.Refund
+	if err := db.First(&refund, refundID).Error; err != nil {
+		return nil, err
+	}
+	if res.RowsAffected != 1 {
+		return &refund, nil
+	}
+
+	if refund.PaymentID == nil {
+		return &refund, markRefundFailed(db, &refund, "Đơn hàng không có giao dịch thanh toán, cần hoàn tiền thủ công")
+	}
+	var p models.Payment
+	if err := db.First(&p, *refund.PaymentID).Error; err != nil {
+		return nil, err
+	}
+	// Đơn trả hoàn toàn bằng điểm: điểm đã được hoàn khi hủy đơn
+	if refund.Amount == 0 {
+		return &refund, completeRefund(db, &refund, &p, &payment.RefundResult{Status: payment.StatusRefunded})
+	}
+	provider, err := payment.Get(p.Provider)
+	if err != nil {
+		return &refund, markRefundFailed(db, &refund, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), refundTimeout)
+	defer cancel()
+	result, err := provider.Refund(ctx, payment.RefundRequest{
+		RefundRef:      fmt.Sprintf("RF%d_%d", refund.RefundID, refund.Attempts),
+		OrderRef:       p.PaymentRef,
+		TransID:        p.TransID,
+		Amount:         int64(refund.Amount),
+		OriginalAmount: int64(p.Amount),
+		CreatedAt:      p.CreatedAt,
+		Reason:         refund.Reason,
+		RequestedBy:    refund.CreatedBy,
+	})
+	if err != nil {
+		return &refund, markRefundFailed(db, &refund, err.Error())
+	}
+
+	switch result.Status {
+	case payment.StatusRefunded:
+		return &refund, completeRefund(db, &refund, &p, result)
+	case payment.StatusPending:
+		refund.Status = RefundProcessing
+		refund.ProviderRef = result.RefundRef
+		return &refund, db.Model(&refund).Updates(map[string]interface{}{
+			"Status":      refund.Status,
+			"ProviderRef": refund.ProviderRef,
+			"LastError":   "",
+		}).Error
+	default:
+		return &refund, markRefundFailed(db, &refund, result.Message)
+	}
+}
+
+// RefundCheck là kết quả tra cứu lại một yêu cầu hoàn tiền đang processing.
+type RefundCheck struct {
+	RefundID int    `json:"RefundID"`
+	OrderID  int    `json:"OrderID"`
+	Status   string `json:"Status"` // trạng thái sau khi tra cứu
+	Error    string `json:"Error,omitempty"`
+}
+
+// ResolveProcessingRefunds tra cứu ở cổng thanh toán các yêu cầu hoàn tiền
+// đang processing quá olderThan (cổng trả về pending khi gửi, ví dụ ZaloPay)
+// và cập nhật kết quả. Yêu cầu processing chưa có ProviderRef là lần gửi bị
+// gián đoạn giữa chừng: không gửi lại mà báo lỗi để kiểm tra thủ công, tránh
+// hoàn tiền hai lần.
+func ResolveProcessingRefunds(db *gorm.DB, olderThan time.Duration) ([]RefundCheck, error) {
+	var refunds []models.Refund
+	if err := db.Where("Status = ? AND UpdatedAt <= ?", RefundProcessing, time.Now().Add(-olderThan)).
+		Order("RefundID").Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+
+	checks := make([]RefundCheck, 0, len(refunds))
+	for i := range refunds {
+		refund := &refunds[i]
+		check := RefundCheck{RefundID: refund.RefundID, OrderID: refund.OrderID, Status: refund.Status}
+		if err := resolveProcessingRefund(db, refund); err != nil {
+			check.Error = err.Error()
+		}
+		check.Status = refund.Status
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func resolveProcessingRefund(db *gorm.DB, refund *models.Refund) error {
+	if refund.ProviderRef == "" || refund.PaymentID == nil {
+		return errors.New("không rõ kết quả gửi yêu cầu hoàn tiền sang cổng, cần kiểm tra thủ công")
+	}
+	var p models.Payment
+	if err := db.First(&p, *refund.PaymentID).Error; err != nil {
+		return err
+	}
+	provider, err := payment.Get(p.Provider)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), refundTimeout)
+	defer cancel()
+	result, err := provider.QueryRefund(ctx, payment.RefundQueryRequest{
+		RefundRef: refund.ProviderRef,
+		OrderRef:  p.PaymentRef,
+		TransID:   p.TransID,
+		CreatedAt: p.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch result.Status {
+	case payment.StatusRefunded:
+		return completeRefund(db, refund, &p, result)
+	case payment.StatusFailed:
+		return markRefundFailed(db, refund, result.Message)
+	}
+	return nil
+}
+
+func markRefundFailed(db *gorm.DB, refund *models.Refund, message string) error {
+	if len(message) > 255 {
+		message = message[:255]
+	}
+	refund.Status = RefundFailed
+	refund.LastError = message
+	return db.Model(refund).Updates(map[string]interface{}{
+		"Status":    refund.Status,
+		"LastError": refund.LastError,
+	}).Error
+}
+
+func completeRefund(db *gorm.DB, refund *models.Refund, p *models.Payment, result *payment.RefundResult) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		refunded := p.RefundedAmount + refund.Amount
+		status := PaymentRefunded
+		if refunded < p.Amount {
+			status = PaymentPartiallyRefunded
+		}
+		if err := TransitionPayment(tx, p, status, PaymentEvent{
+			Source:    PaymentSourceRefund,
+			Note:      refund.Reason,
+			Raw:       result.Raw,
+			CreatedBy: refund.CreatedBy,
+		}, map[string]interface{}{"RefundedAmount": refunded}); err != nil {
+			return err
+		}
+
+		refund.Status = RefundSucceeded
+		refund.ProviderRef = result.RefundRef
+		refund.LastError = ""
+		if err := tx.Model(refund).Updates(map[string]interface{}{
+			"Status":      refund.Status,
+			"ProviderRef": refund.ProviderRef,
+			"LastError":   "",
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Order{}).
+			Where("OrderID = ?", refund.OrderID).
+			Update("Status", OrderStatusRefunded).Error
+	})
+}
+
+// ProcessShowtimeRefunds xử lý lần lượt các yêu cầu hoàn tiền chưa thành công
+// của suất chiếu bị hủy và gửi email cho người giữ vé (mỗi đơn một lần).
+func ProcessShowtimeRefunds(db *gorm.DB, showtimeID int) {
+	var refunds []models.Refund
+	if err := db.Where("ShowtimeID = ? AND Source = ? AND Status IN ?",
+		showtimeID, RefundSourceShowtimeCancel, []string{RefundPending, RefundFailed}).
+		Order("RefundID").Find(&refunds).Error; err != nil {
+		log.Printf("❌ Không đọc được yêu cầu hoàn tiền của suất chiếu %d: %v", showtimeID, err)
+		return
+	}
+
+	for _, r := range refunds {
+		refund, err := ProcessRefund(db, r.RefundID)
+		if err != nil {
+			log.Printf("❌ Hoàn tiền #%d thất bại: %v", r.RefundID, err)
+			continue
+		}
+		if refund.EmailSentAt == nil {
+			if err := notifyShowtimeCancelled(db, refund); err != nil {
+				log.Printf("❌ Gửi email hủy suất chiếu cho đơn %d thất bại: %v", refund.OrderID, err)
+			}
+		}
+	}
+}
+
+func notifyShowtimeCancelled(db *gorm.DB, refund *models.Refund) error {
+	var info struct {
+		Email     string
+		MovieName string
+		ShowDate  string
+		StartTime string
+	}
+	if err := db.Raw(`
+		SELECT COALESCE(NULLIF(o.Email, ''), a.Email) AS Email, m.MovieName, s.ShowDate, s.StartTime
+		FROM orders o
+		JOIN showtimes s ON s.ShowtimeID = o.ShowtimeID
+		JOIN movies m ON m.MovieID = s.MovieID
+		LEFT JOIN accounts a ON a.AccountID = o.AccountID
+		WHERE o.OrderID = ?
+	`, refund.OrderID).Scan(&info).Error; err != nil {
+		return err
+	}
+	if info.Email == "" {
+		return nil
+	}
+
+	refundLine := fmt.Sprintf("Số tiền %dđ đã được hoàn về phương thức thanh toán của bạn.", refund.Amount)
+	if refund.Status != RefundSucceeded {
+		refundLine = fmt.Sprintf("Số tiền %dđ đang được hoàn, chúng tôi sẽ liên hệ nếu cần thêm thông tin.", refund.Amount)
+	}
+	body := fmt.Sprintf(
+		"Suất chiếu %s lúc %s ngày %s (ghế %s) đã bị hủy.\nLý do: %s\n%s\nMã đơn hàng: %d",
+		info.MovieName, info.StartTime, info.ShowDate, refund.Seats, refund.Reason, refundLine, refund.OrderID,
+	)
+	if err := SendPlainEmail(info.Email, "Suất chiếu của bạn đã bị hủy - CINEMA", body); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	refund.EmailSentAt = &now
+	return db.Model(refund).Update("EmailSentAt", now).Error
+}
+
+// RefundProgress tổng hợp tình trạng hoàn tiền của một suất chiếu bị hủy.
+type RefundProgress struct {
+	ShowtimeID     int             `json:"ShowtimeID"`
+	Total          int             `json:"Total"`
+	Pending        int             `json:"Pending"`
+	Processing     int             `json:"Processing"`
+	Succeeded      int             `json:"Succeeded"`
+	Failed         int             `json:"Failed"`
+	AmountTotal    int             `json:"AmountTotal"`
+	AmountRefunded int             `json:"AmountRefunded"`
+	Refunds        []models.Refund `json:"Refunds"`
+}
+
+func GetShowtimeRefundProgress(db *gorm.DB, showtimeID int) (*RefundProgress, error) {
+	progress := &RefundProgress{ShowtimeID: showtimeID}
+	if err := db.Where("ShowtimeID = ? AND Source = ?", showtimeID, RefundSourceShowtimeCancel).
+		Order("RefundID").Find(&progress.Refunds).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range progress.Refunds {
+		progress.Total++
+		progress.AmountTotal += r.Amount
+		switch r.Status {
+		case RefundPending:
+			progress.Pending++
+		case RefundProcessing:
+			progress.Processing++
+		case RefundSucceeded:
+			progress.Succeeded++
+			progress.AmountRefunded += r.Amount
+		case RefundFailed:
+			progress.Failed++
+		}
+	}
+	return progress, nil
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SeatCell là một ghế của suất chiếu kèm toạ độ trên lưới phòng chiếu.
+type SeatCell struct {
+	ShowtimeSeatID     int        `json:"ShowtimeSeatID"`
+	SeatID             int        `json:"SeatID"`
+	SeatNumber         int        `json:"SeatNumber"`
+	RowName            string     `json:"RowName"`
+	Row                int        `json:"Row"`
+	Column             int        `json:"Column"`
+	Status             int8       `json:"Status"`
+	PairShowtimeSeatID *int       `json:"PairShowtimeSeatID,omitempty"` // nửa còn lại nếu là ghế đôi
+	LockedBy           *int       `json:"-"`
+	HoldToken          *string    `json:"-"`
+	HoldExpiresAt      *time.Time `json:"-"`
+}
+
+// Available cho biết ghế còn có thể giữ: đang trống hoặc đã hết hạn giữ.
+func (s SeatCell) Available(now time.Time) bool {
+	if s.Status == SeatStatusFree {
+		return true
+	}
+	return s.Status == SeatStatusHeld && s.HoldExpiresAt != nil && !s.HoldExpiresAt.After(now)
+}
+
+// LoadShowtimeSeatGrid đọc toàn bộ ghế của suất chiếu, sắp theo hàng và cột.
+func LoadShowtimeSeatGrid(db *gorm.DB, showtimeID int) ([]SeatCell, error) {
+	var cells []SeatCell
+	err := db.Raw(`
+		SELECT ss.ShowtimeSeatID, s.SeatID, s.SeatNumber, r.RowName, s.Row, s.Column,
+		       ss.Status, ps.ShowtimeSeatID AS PairShowtimeSeatID,
+		       ss.LockedBy, ss.HoldToken, ss.HoldExpiresAt
+		FROM showtime_seats ss
+		JOIN seats s ON ss.SeatID = s.SeatID
+		JOIN `+"`rows`"+` r ON s.RowID = r.RowID
+		LEFT JOIN showtime_seats ps ON ps.ShowtimeID = ss.ShowtimeID AND ps.SeatID = s.PairSeatID
+		WHERE ss.ShowtimeID = ?
+		ORDER BY s.Row ASC, s.Column ASC
+	`, showtimeID).Scan(&cells).Error
+	return cells, err
+}
+
+type BestSeatsResult struct {
+	Seats []SeatCell `json:"Seats"`
+	Split bool       `json:"Split"` // true nếu nhóm phải chia sang hai hàng liền kề
+	Score float64    `json:"Score"`
+}
+
+var ErrNotEnoughSeats = fmt.Errorf("không đủ ghế trống phù hợp cho nhóm")
+
+// seatBlock là một dãy ghế trống liền nhau trong cùng một hàng.
+type seatBlock struct {
+	depth int
+	seats []SeatCell
+	score float64
+}
+
+// seatGeometry gom ghế theo hàng. Hàng được xếp theo Seat.Row (vị trí trên lưới
+// phòng chiếu) tăng dần, hàng đầu tiên là hàng gần màn hình nhất. depth là
+// khoảng cách thật tới màn hình tính theo Row nên hàng trống trên lưới (lối đi
+// ngang) vẫn được tính.
+type seatGeometry struct {
+	cells          []SeatCell
+	rows           [][]SeatCell
+	depths         []int
+	centerColumn   float64
+	halfWidth      float64
+	idealDepth     float64
+	maxDepth       int
+	preventOrphans bool
+}
+
+func newSeatGeometry(cells []SeatCell, preventOrphans bool) seatGeometry {
+	byRow := make(map[int][]SeatCell)
+	gridRows := []int{}
+	minCol, maxCol := math.MaxInt32, math.MinInt32
+	for _, cell := range cells {
+		if _, ok := byRow[cell.Row]; !ok {
+			gridRows = append(gridRows, cell.Row)
+		}
+		byRow[cell.Row] = append(byRow[cell.Row], cell)
+		if cell.Column < minCol {
+			minCol = cell.Column
+		}
+		if cell.Column > maxCol {
+			maxCol = cell.Column
+		}
+	}
+	sort.Ints(gridRows)
+
+	g := seatGeometry{cells: cells, preventOrphans: preventOrphans}
+	for _, gridRow := range gridRows {
+		row := byRow[gridRow]
+		sort.Slice(row, func(i, j int) bool { return row[i].Column < row[j].Column })
+		g.rows = append(g.rows, row)
+		g.depths = append(g.depths, gridRow-gridRows[0])
+	}
+	if len(cells) > 0 {
+		g.centerColumn = float64(minCol+maxCol) / 2
+		g.halfWidth = math.Max(float64(maxCol-minCol)/2, 1)
+		g.maxDepth = g.depths[len(g.depths)-1]
+	}
+	// Vị trí đẹp nhất là khoảng 2/3 phòng tính từ màn hình
+	g.idealDepth = math.Round(float64(g.maxDepth) * 2 / 3)
+	return g
+}
+
+// score càng nhỏ càng tốt: lệch tâm màn hình theo chiều ngang cộng độ lệch so
+// với hàng lý tưởng. index là vị trí hàng trong g.rows.
+func (g seatGeometry) score(index int, seats []SeatCell) float64 {
+	sum := 0.0
+	for _, s := range seats {
+		sum += float64(s.Column)
+	}
+	center := sum / float64(len(seats))
+	horizontal := math.Abs(center-g.centerColumn) / g.halfWidth
+	vertical := math.Abs(float64(g.depths[index])-g.idealDepth) / math.Max(float64(g.maxDepth+1), 1)
+	return horizontal + 1.5*vertical
+}
+
+// bestBlock tìm dãy count ghế trống liền nhau tốt nhất trong một hàng.
+func (g seatGeometry) bestBlock(depth, count int, now time.Time) *seatBlock {
+	var best *seatBlock
+	for _, block := range g.blocks(depth, count, now) {
+		if best == nil || block.score < best.score {
+			best = &block
+		}
+	}
+	return best
+}
+
+// blocks liệt kê mọi dãy count ghế trống liền nhau hợp lệ trong một hàng. Hai
+// ghế chỉ được coi là liền nhau khi Column liên tiếp (khoảng trống là lối đi).
+func (g seatGeometry) blocks(depth, count int, now time.Time) []seatBlock {
+	row := g.rows[depth]
+	var blocks []seatBlock
+	run := []SeatCell{}
+	for i, seat := range row {
+		if !seat.Available(now) || (len(run) > 0 && row[i-1].Column+1 != seat.Column) {
+			run = run[:0]
+		}
+		if !seat.Available(now) {
+			continue
+		}
+		run = append(run, seat)
+		if len(run) < count {
+			continue
+		}
+		candidate := append([]SeatCell(nil), run[len(run)-count:]...)
+		if splitsPair(candidate) || g.leavesOrphans(candidate, now) {
+			continue
+		}
+		blocks = append(blocks, seatBlock{depth: depth, seats: candidate, score: g.score(depth, candidate)})
+	}
+	return blocks
+}
+
+// overlaps cho biết hai dãy ghế có chung ít nhất một cột, tức phần ở hàng sau
+// nằm ngay sau lưng phần ở hàng trước thay vì lệch sang đầu kia của phòng.
+func overlaps(a, b []SeatCell) bool {
+	return a[0].Column <= b[len(b)-1].Column && b[0].Column <= a[len(a)-1].Column
+}
+
+// leavesOrphans cho biết dãy ghế có vi phạm luật chống ghế lẻ (nếu chi nhánh
+// bật) hay không, giống kiểm tra của ValidateSeatSelection khi giữ ghế.
+func (g seatGeometry) leavesOrphans(seats []SeatCell, now time.Time) bool {
+	if !g.preventOrphans {
+		return false
+	}
+	selected := make(map[int]bool, len(seats))
+	for _, s := range seats {
+		selected[s.ShowtimeSeatID] = true
+	}
+	return len(FindOrphanSeats(g.cells, selected, now)) > 0
+}
+
+// FindBestSeats chọn count ghế trống tốt nhất. Ưu tiên count ghế liền nhau
+// trong một hàng; nếu không có thì chia nhóm sang hai hàng liền kề. Khi
+// preventOrphans bật, các dãy để lại ghế lẻ bị loại để gợi ý luôn giữ được.
+func FindBestSeats(cells []SeatCell, count int, preventOrphans bool) (*BestSeatsResult, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("số ghế phải lớn hơn 0")
+	}
+
+	now := time.Now()
+	g := newSeatGeometry(cells, preventOrphans)
+
+	var best *seatBlock
+	for depth := range g.rows {
+		if block := g.bestBlock(depth, count, now); block != nil && (best == nil || block.score < best.score) {
+			best = block
+		}
+	}
+	if best != nil {
+		return &BestSeatsResult{Seats: best.seats, Score: best.score}, nil
+	}
+
+	if count < 2 {
+		return nil, ErrNotEnoughSeats
+	}
+
+	// Chia nhóm: phần lớn hơn ở một hàng, phần còn lại ở hàng ngay sau/trước.
+	// Hai hàng phải liền nhau trên lưới (không cách lối đi ngang) và hai phần
+	// phải có chung cột để nhóm vẫn ngồi cạnh nhau. Ghế lẻ chỉ phụ thuộc ghế
+	// chọn trong cùng hàng nên kiểm tra từng phần là đủ.
+	const splitPenalty = 0.5
+	first := (count + 1) / 2
+	second := count - first
+	var bestSplit *BestSeatsResult
+	for depth := 0; depth+1 < len(g.rows); depth++ {
+		if g.depths[depth+1]-g.depths[depth] != 1 {
+			continue
+		}
+		for _, sizes := range [][2]int{{first, second}, {second, first}} {
+			front := g.blocks(depth, sizes[0], now)
+			back := g.blocks(depth+1, sizes[1], now)
+			for _, a := range front {
+				for _, b := range back {
+					if !overlaps(a.seats, b.seats) {
+						continue
+					}
+					score := (a.score+b.score)/2 + splitPenalty
+					if bestSplit == nil || score < bestSplit.Score {
+						seats := append(append([]SeatCell{}, a.seats...), b.seats...)
+						bestSplit = &BestSeatsResult{Seats: seats, Split: true, Score: score}
+					}
+				}
+			}
+		}
+	}
+	if bestSplit == nil {
+		return nil, ErrNotEnoughSeats
+	}
+	return bestSplit, nil
+}
+
+// splitsPair cho biết dãy ghế có chứa một nửa của cặp ghế đôi hay không.
+func splitsPair(seats []SeatCell) bool {
+	in := make(map[int]bool, len(seats))
+	for _, s := range seats {
+		in[s.ShowtimeSeatID] = true
+	}
+	for _, s := range seats {
+		if s.PairShowtimeSeatID != nil && !in[*s.PairShowtimeSeatID] {
+			return true
+		}
+	}
+	return false
+}
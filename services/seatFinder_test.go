@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// seatGrid dựng ghế từ sơ đồ dạng chữ, mỗi chuỗi là một hàng trên lưới (hàng
+// rỗng là lối đi ngang). Ký tự: '.' ghế trống, 'S' ghế trống được chọn, 'X' đã
+// bán, 'h' đang giữ, 'e' giữ đã hết hạn, ' ' lối đi. Ghế được đặt tên theo hàng
+// và cột, ví dụ "A1" là cột đầu tiên của hàng đầu tiên.
+func seatGrid(rows ...string) (cells []SeatCell, selected map[int]bool) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	selected = map[int]bool{}
+	for r, row := range rows {
+		for col, ch := range row {
+			if ch == ' ' {
+				continue
+			}
+			cell := SeatCell{
+				ShowtimeSeatID: (r+1)*100 + col + 1,
+				SeatNumber:     col + 1,
+				RowName:        string(rune('A' + r)),
+				Row:            r,
+				Column:         col,
+			}
+			switch ch {
+			case 'X':
+				cell.Status = SeatStatusSold
+			case 'h':
+				cell.Status, cell.HoldExpiresAt = SeatStatusHeld, &future
+			case 'e':
+				cell.Status, cell.HoldExpiresAt = SeatStatusHeld, &past
+			case 'S':
+				selected[cell.ShowtimeSeatID] = true
+			}
+			cells = append(cells, cell)
+		}
+	}
+	return cells, selected
+}
+
+func cellLabels(seats []SeatCell) []string {
+	labels := make([]string, 0, len(seats))
+	for _, s := range seats {
+		labels = append(labels, fmt.Sprintf("%s%d", s.RowName, s.SeatNumber))
+	}
+	return labels
+}
+
+// pairSeats ghép hai ghế (theo tên) thành ghế đôi.
+func pairSeats(cells []SeatCell, a, b string) {
+	labels := cellLabels(cells)
+	ids := make(map[string]int, len(cells))
+	for i, label := range labels {
+		ids[label] = cells[i].ShowtimeSeatID
+	}
+	for i, label := range labels {
+		switch label {
+		case a:
+			id := ids[b]
+			cells[i].PairShowtimeSeatID = &id
+		case b:
+			id := ids[a]
+			cells[i].PairShowtimeSeatID = &id
+		}
+	}
+}
+
+func TestFindBestSeats(t *testing.T) {
+	tests := []struct {
+		name           string
+		rows           []string
+		pairs          [][2]string
+		count          int
+		preventOrphans bool
+		want           []string
+		wantSplit      bool
+		wantErr        error
+	}{
+		{
+			name:  "phòng trống chọn giữa hàng lý tưởng",
+			rows:  []string{"..........", "..........", "..........", "..........", ".........."},
+			count: 2,
+			want:  []string{"D5", "D6"},
+		},
+		{
+			name:  "ghế giữ đã hết hạn được coi là trống",
+			rows:  []string{"XXXheeXXXX"},
+			count: 2,
+			want:  []string{"A5", "A6"},
+		},
+		{
+			name:    "không nối ghế qua lối đi",
+			rows:    []string{"XXX. .XXXX"},
+			count:   2,
+			wantErr: ErrNotEnoughSeats,
+		},
+		{
+			name:      "chia sang hai hàng liền kề cùng cột",
+			rows:      []string{"XXX..XXXXX", "XXX..XXXXX"},
+			count:     4,
+			want:      []string{"A4", "A5", "B4", "B5"},
+			wantSplit: true,
+		},
+		{
+			name:    "không chia khi hai phần lệch cột",
+			rows:    []string{"..XXXXXXXX", "XXXXXXXX.."},
+			count:   4,
+			wantErr: ErrNotEnoughSeats,
+		},
+		{
+			name:    "không chia qua lối đi ngang",
+			rows:    []string{"XXX..XXXXX", "", "XXX..XXXXX"},
+			count:   4,
+			wantErr: ErrNotEnoughSeats,
+		},
+		{
+			name:  "tắt luật ghế lẻ thì chọn dãy gần tâm nhất",
+			rows:  []string{"X...XXXXXX"},
+			count: 2,
+			want:  []string{"A3", "A4"},
+		},
+		{
+			name:           "không có dãy hợp lệ khi bật luật ghế lẻ",
+			rows:           []string{"X...XXXXXX"},
+			count:          2,
+			preventOrphans: true,
+			wantErr:        ErrNotEnoughSeats,
+		},
+		{
+			name:    "không tách ghế đôi",
+			rows:    []string{"XXX..XXXXX"},
+			pairs:   [][2]string{{"A4", "A5"}},
+			count:   1,
+			wantErr: ErrNotEnoughSeats,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cells, _ := seatGrid(tt.rows...)
+			for _, p := range tt.pairs {
+				pairSeats(cells, p[0], p[1])
+			}
+
+			result, err := FindBestSeats(cells, tt.count, tt.preventOrphans)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, muốn %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if got := fmt.Sprint(cellLabels(result.Seats)); got != fmt.Sprint(tt.want) {
+				t.Errorf("Seats = %s, muốn %v", got, tt.want)
+			}
+			if result.Split != tt.wantSplit {
+				t.Errorf("Split = %v, muốn %v", result.Split, tt.wantSplit)
+			}
+		})
+	}
+}
+
+func TestFindBestSeatsRejectsNonPositiveCount(t *testing.T) {
+	cells, _ := seatGrid("....")
+	if _, err := FindBestSeats(cells, 0, false); err == nil {
+		t.Fatal("muốn lỗi khi số ghế bằng 0")
+	}
+}
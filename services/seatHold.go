@@ -0,0 +1,333 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"movie-ticket-booking/config"
+	"movie-ticket-booking/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trạng thái của showtime_seats.Status
+const (
+	SeatStatusFree int8 = 0
+	SeatStatusHeld int8 = 1
+	SeatStatusSold int8 = 2
+)
+
+const MaxSeatsPerHold = 10
+
+// clearHoldSQL là phần SET dùng chung khi trả ghế về trạng thái trống.
+const clearHoldSQL = "Status = 0, LockedBy = NULL, HoldToken = NULL, LockedAt = NULL, HoldExpiresAt = NULL, HoldExtended = 0"
+
+var ErrHoldNotExtendable = errors.New("ghế không còn được giữ hoặc đã gia hạn một lần")
+
+// HoldOwner xác định ai đang giữ ghế: tài khoản đã đăng nhập (AccountID)
+// hoặc khách vãng lai (HoldToken do server cấp ở lần giữ ghế đầu tiên).
+type HoldOwner struct {
+	AccountID int
+	HoldToken string
+}
+
+// ownerCondition trả về điều kiện SQL khớp ghế đang được owner giữ.
+func (o HoldOwner) ownerCondition(alias string) (string, interface{}) {
+	if o.AccountID != 0 {
+		return alias + "LockedBy = ?", o.AccountID
+	}
+	return alias + "HoldToken = ?", o.HoldToken
+}
+
+func (o HoldOwner) owns(lockedBy *int, holdToken *string) bool {
+	if o.AccountID != 0 {
+		return lockedBy != nil && *lockedBy == o.AccountID
+	}
+	return holdToken != nil && o.HoldToken != "" && *holdToken == o.HoldToken
+}
+
+type SeatConflict struct {
+	ShowtimeSeatID int    `json:"ShowtimeSeatID"`
+	RowName        string `json:"RowName"`
+	SeatNumber     int    `json:"SeatNumber"`
+	Reason         string `json:"Reason"` // not_found | held | sold | not_held (chưa giữ hoặc hết hạn giữ)
+}
+
+// SeatConflictError được trả về khi có ít nhất một ghế không thể giữ/mua.
+type SeatConflictError struct {
+	Conflicts []SeatConflict
+}
+
+func (e *SeatConflictError) Error() string {
+	names := make([]string, 0, len(e.Conflicts))
+	for _, s := range e.Conflicts {
+		if s.RowName == "" {
+			names = append(names, fmt.Sprintf("#%d", s.ShowtimeSeatID))
+			continue
+		}
+		names = append(names, fmt.Sprintf("%s%d", s.RowName, s.SeatNumber))
+	}
+	return "Ghế chưa được giữ, đã có người khác giữ hoặc đã bán: " + strings.Join(names, ", ")
+}
+
+type HoldResult struct {
+	ShowtimeSeatIDs []int     `json:"ShowtimeSeatIDs"` // đã bao gồm ghế còn lại của cặp ghế đôi
+	HoldExpiresAt   time.Time `json:"HoldExpiresAt"`
+}
+
+type heldSeatRow struct {
+	ShowtimeSeatID int
+	RowName        string
+	SeatNumber     int
+	Status         int8
+	LockedBy       *int
+	HoldToken      *string
+	HoldExpiresAt  *time.Time
+}
+
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	result := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
+
+// HoldTTL trả về thời gian giữ ghế của suất chiếu: ưu tiên cấu hình của suất
+// chiếu, sau đó tới chi nhánh, cuối cùng là SEAT_HOLD_MINUTES.
+func HoldTTL(db *gorm.DB, showtimeID int) (time.Duration, error) {
+	var setting struct {
+		ShowtimeMinutes int
+		BranchMinutes   int
+	}
+	if err := db.Raw(`
+		SELECT s.SeatHoldMinutes AS ShowtimeMinutes, b.SeatHoldMinutes AS BranchMinutes
+		FROM showtimes s
+		JOIN theaters t ON t.TheaterID = s.TheaterID
+		JOIN branches b ON b.BranchID = t.BranchID
+		WHERE s.ShowtimeID = ?
+	`, showtimeID).Scan(&setting).Error; err != nil {
+		return 0, err
+	}
+
+	minutes := config.GetSeatHoldMinutes()
+	if setting.ShowtimeMinutes > 0 {
+		minutes = setting.ShowtimeMinutes
+	} else if setting.BranchMinutes > 0 {
+		minutes = setting.BranchMinutes
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// HoldSeats giữ toàn bộ ghế trong ids cho owner hoặc không giữ ghế nào.
+// Việc giữ ghế là một câu UPDATE có điều kiện; sau đó đọc lại trong cùng
+// transaction, nếu có ghế nào không thuộc owner thì rollback và trả về
+// *SeatConflictError. Ghế đã hết hạn giữ được coi như ghế trống, ghế owner
+// đang giữ thì giữ nguyên HoldExpiresAt. Ghế đôi luôn được giữ cả cặp.
+func HoldSeats(db *gorm.DB, owner HoldOwner, showtimeID int, ids []int) (*HoldResult, error) {
+	ids, err := ExpandPairedSeats(db, showtimeID, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("danh sách ghế trống")
+	}
+	if len(ids) > MaxSeatsPerHold {
+		return nil, fmt.Errorf("chỉ được giữ tối đa %d ghế", MaxSeatsPerHold)
+	}
+
+	ttl, err := HoldTTL(db, showtimeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt time.Time
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		cond, arg := owner.ownerCondition("")
+
+		var lockedBy interface{}
+		var holdToken interface{}
+		if owner.AccountID != 0 {
+			lockedBy = owner.AccountID
+		} else {
+			holdToken = owner.HoldToken
+		}
+
+		// MySQL gán SET theo thứ tự trái sang phải nên các cột thời gian phải
+		// đứng trước Status/LockedBy để CASE còn đọc được giá trị cũ.
+		renewed := "Status = " + fmt.Sprint(SeatStatusHeld) + " AND " + cond + " AND HoldExpiresAt > ?"
+		if err := tx.Exec(`
+			UPDATE showtime_seats
+			SET HoldExtended = CASE WHEN `+renewed+` THEN HoldExtended ELSE 0 END,
+			    LockedAt = CASE WHEN `+renewed+` THEN LockedAt ELSE ? END,
+			    HoldExpiresAt = CASE WHEN `+renewed+` THEN HoldExpiresAt ELSE ? END,
+			    Status = ?, LockedBy = ?, HoldToken = ?
+			WHERE ShowtimeID = ?
+			  AND ShowtimeSeatID IN ?
+			  AND (Status = ? OR (Status = ? AND (`+cond+` OR HoldExpiresAt <= ?)))
+		`, arg, now,
+			arg, now, now,
+			arg, now, now.Add(ttl),
+			SeatStatusHeld, lockedBy, holdToken,
+			showtimeID, ids, SeatStatusFree, SeatStatusHeld, arg, now).Error; err != nil {
+			return err
+		}
+
+		var rows []heldSeatRow
+		if err := tx.Raw(`
+			SELECT ss.ShowtimeSeatID, ss.RowName, s.SeatNumber, ss.Status, ss.LockedBy, ss.HoldToken, ss.HoldExpiresAt
+			FROM showtime_seats ss
+			JOIN seats s ON s.SeatID = ss.SeatID
+			WHERE ss.ShowtimeID = ? AND ss.ShowtimeSeatID IN ?
+		`, showtimeID, ids).Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		found := make(map[int]heldSeatRow, len(rows))
+		for _, r := range rows {
+			found[r.ShowtimeSeatID] = r
+		}
+
+		var conflicts []SeatConflict
+		for _, id := range ids {
+			r, ok := found[id]
+			switch {
+			case !ok:
+				conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, Reason: "not_found"})
+			case r.Status == SeatStatusSold:
+				conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, RowName: r.RowName, SeatNumber: r.SeatNumber, Reason: "sold"})
+			case r.Status != SeatStatusHeld || !owner.owns(r.LockedBy, r.HoldToken):
+				conflicts = append(conflicts, SeatConflict{ShowtimeSeatID: id, RowName: r.RowName, SeatNumber: r.SeatNumber, Reason: "held"})
+			case r.HoldExpiresAt != nil && (expiresAt.IsZero() || r.HoldExpiresAt.Before(expiresAt)):
+				expiresAt = *r.HoldExpiresAt
+			}
+		}
+
+		if len(conflicts) > 0 {
+			return &SeatConflictError{Conflicts: conflicts}
+		}
+
+		// Luật chống ghế lẻ tính trên toàn bộ ghế owner đang giữ của suất chiếu
+		return validateOwnerSelection(tx, owner, showtimeID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &HoldResult{ShowtimeSeatIDs: ids, HoldExpiresAt: expiresAt}, nil
+}
+
+func validateOwnerSelection(tx *gorm.DB, owner HoldOwner, showtimeID int) error {
+	enabled, err := PreventOrphanSeatsEnabled(tx, showtimeID)
+	if err != nil || !enabled {
+		return err
+	}
+
+	cells, err := LoadShowtimeSeatGrid(tx, showtimeID)
+	if err != nil {
+		return err
+	}
+
+	selected := make(map[int]bool)
+	for _, cell := range cells {
+		if cell.Status == SeatStatusHeld && owner.owns(cell.LockedBy, cell.HoldToken) {
+			selected[cell.ShowtimeSeatID] = true
+		}
+	}
+
+	if orphans := FindOrphanSeats(cells, selected, time.Now()); len(orphans) > 0 {
+		return &OrphanSeatError{Seats: orphans}
+	}
+	return nil
+}
+
+// ReleaseSeats trả lại các ghế owner đang giữ (kèm nửa còn lại của ghế đôi).
+// Ghế của người khác hoặc đã bán được bỏ qua.
+func ReleaseSeats(db *gorm.DB, owner HoldOwner, showtimeID int, ids []int) (int64, error) {
+	ids, err := ExpandPairedSeats(db, showtimeID, ids)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	cond, arg := owner.ownerCondition("")
+	result := db.Exec(`
+		UPDATE showtime_seats
+		SET `+clearHoldSQL+`
+		WHERE ShowtimeID = ?
+		  AND ShowtimeSeatID IN ?
+		  AND Status = ? AND `+cond,
+		showtimeID, ids, SeatStatusHeld, arg)
+	return result.RowsAffected, result.Error
+}
+
+// ReleaseAllHolds trả lại mọi ghế owner đang giữ trong một suất chiếu, hoặc
+// ở tất cả suất chiếu nếu showtimeID = 0 (dùng khi đăng xuất).
+func ReleaseAllHolds(db *gorm.DB, owner HoldOwner, showtimeID int) (int64, error) {
+	cond, arg := owner.ownerCondition("")
+	if showtimeID == 0 {
+		result := db.Exec(`UPDATE showtime_seats SET `+clearHoldSQL+` WHERE Status = ? AND `+cond,
+			SeatStatusHeld, arg)
+		return result.RowsAffected, result.Error
+	}
+
+	result := db.Exec(`UPDATE showtime_seats SET `+clearHoldSQL+` WHERE ShowtimeID = ? AND Status = ? AND `+cond,
+		showtimeID, SeatStatusHeld, arg)
+	return result.RowsAffected, result.Error
+}
+
+// ExtendHold gia hạn thêm một TTL cho toàn bộ ghế owner đang giữ trong suất
+// chiếu. Mỗi lần giữ ghế chỉ được gia hạn một lần.
+func ExtendHold(db *gorm.DB, owner HoldOwner, showtimeID int) (time.Time, error) {
+	ttl, err := HoldTTL(db, showtimeID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var expiresAt time.Time
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		cond, arg := owner.ownerCondition("")
+		result := tx.Exec(`
+			UPDATE showtime_seats
+			SET HoldExpiresAt = DATE_ADD(HoldExpiresAt, INTERVAL ? SECOND), HoldExtended = 1
+			WHERE ShowtimeID = ? AND Status = ? AND HoldExtended = 0 AND HoldExpiresAt > ? AND `+cond,
+			int(ttl.Seconds()), showtimeID, SeatStatusHeld, now, arg)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrHoldNotExtendable
+		}
+
+		var latest struct{ ExpiresAt *time.Time }
+		if err := tx.Raw(`
+			SELECT MIN(HoldExpiresAt) AS ExpiresAt
+			FROM showtime_seats
+			WHERE ShowtimeID = ? AND Status = ? AND `+cond,
+			showtimeID, SeatStatusHeld, arg).Scan(&latest).Error; err != nil {
+			return err
+		}
+		if latest.ExpiresAt != nil {
+			expiresAt = *latest.ExpiresAt
+		}
+
+		// Phiên thanh toán đang mở hết hạn cùng ghế
+		checkoutCond := "HoldToken = ?"
+		if owner.AccountID != 0 {
+			checkoutCond = "AccountID = ?"
+		}
+		return tx.Model(&models.PendingCheckout{}).
+			Where("ShowtimeID = ? AND Status = ? AND "+checkoutCond, showtimeID, CheckoutOpen, arg).
+			Update("ExpiresAt", expiresAt).Error
+	})
+	return expiresAt, err
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trạng thái hiển thị của một ô trên sơ đồ ghế.
+const (
+	SeatMapFree = "free"
+	SeatMapHeld = "held"
+	SeatMapSold = "sold"
+)
+
+// SeatMapSeat là một ghế trên sơ đồ dùng để vẽ SVG/ASCII.
+type SeatMapSeat struct {
+	SeatID        int     `json:"SeatID"`
+	SeatNumber    int     `json:"SeatNumber"`
+	RowName       string  `json:"RowName"`
+	Row           int     `json:"Row"`
+	Column        int     `json:"Column"`
+	State         string  `json:"State"`
+	CategoryCode  *string `json:"CategoryCode"`
+	CategoryName  *string `json:"CategoryName"`
+	CategoryColor *string `json:"CategoryColor"`
+	PairSeatID    *int    `json:"PairSeatID"`
+}
+
+type SeatMap struct {
+	Title string        `json:"Title"`
+	Seats []SeatMapSeat `json:"Seats"`
+}
+
+// LoadTheaterSeatMap đọc sơ đồ ghế hiện hành của phòng chiếu, mọi ghế đều trống.
+func LoadTheaterSeatMap(db *gorm.DB, theaterID int, title string) (*SeatMap, error) {
+	var seats []SeatMapSeat
+	err := db.Raw(`
+		SELECT s.SeatID, s.SeatNumber, r.RowName, s.Row, s.Column, s.PairSeatID,
+		       sc.Code AS CategoryCode, sc.CategoryName, sc.Color AS CategoryColor
+		FROM seats s
+		JOIN `+"`rows`"+` r ON s.RowID = r.RowID
+		LEFT JOIN seat_categories sc ON sc.SeatCategoryID = s.SeatCategoryID
+		WHERE r.TheaterID = ? AND r.isOld = 0 AND s.isOld = 0
+		ORDER BY s.Row, s.Column
+	`, theaterID).Scan(&seats).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range seats {
+		seats[i].State = SeatMapFree
+	}
+	return &SeatMap{Title: title, Seats: seats}, nil
+}
+
+// LoadShowtimeSeatMap đọc sơ đồ ghế của suất chiếu kèm trạng thái từng ghế.
+// Ghế giữ đã hết hạn được coi là trống.
+func LoadShowtimeSeatMap(db *gorm.DB, showtimeID int, title string) (*SeatMap, error) {
+	var rows []struct {
+		SeatMapSeat
+		Status        int8
+		HoldExpiresAt *time.Time
+	}
+	err := db.Raw(`
+		SELECT s.SeatID, s.SeatNumber, r.RowName, s.Row, s.Column, s.PairSeatID,
+		       sc.Code AS CategoryCode, sc.CategoryName, sc.Color AS CategoryColor,
+		       ss.Status, ss.HoldExpiresAt
+		FROM showtime_seats ss
+		JOIN seats s ON ss.SeatID = s.SeatID
+		JOIN `+"`rows`"+` r ON s.RowID = r.RowID
+		LEFT JOIN seat_categories sc ON sc.SeatCategoryID = COALESCE(ss.SeatCategoryID, s.SeatCategoryID)
+		WHERE ss.ShowtimeID = ?
+		ORDER BY s.Row, s.Column
+	`, showtimeID).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	seats := make([]SeatMapSeat, len(rows))
+	for i, row := range rows {
+		seat := row.SeatMapSeat
+		cell := SeatCell{Status: row.Status, HoldExpiresAt: row.HoldExpiresAt}
+		switch {
+		case row.Status == SeatStatusSold:
+			seat.State = SeatMapSold
+		case cell.Available(now):
+			seat.State = SeatMapFree
+		default:
+			seat.State = SeatMapHeld
+		}
+		seats[i] = seat
+	}
+	return &SeatMap{Title: title, Seats: seats}, nil
+}
+
+// seatMapRow là một dòng của lưới phòng chiếu; dòng không có ghế (lối đi
+// ngang) có Name rỗng.
+type seatMapRow struct {
+	Name  string
+	Seats map[int]SeatMapSeat
+}
+
+// seatMapLayout gom ghế theo Seat.Row của lưới, dòng gần màn hình nhất ở trên
+// cùng. Mọi dòng từ Row nhỏ nhất tới lớn nhất đều có mặt để giữ khoảng trống.
+type seatMapLayout struct {
+	rows      []seatMapRow
+	minColumn int
+	maxColumn int
+	maxNumber int
+}
+
+func newSeatMapLayout(m *SeatMap) seatMapLayout {
+	layout := seatMapLayout{}
+	if len(m.Seats) == 0 {
+		return layout
+	}
+
+	minRow, maxRow := m.Seats[0].Row, m.Seats[0].Row
+	for i, seat := range m.Seats {
+		if seat.Row < minRow {
+			minRow = seat.Row
+		}
+		if seat.Row > maxRow {
+			maxRow = seat.Row
+		}
+		if i == 0 || seat.Column < layout.minColumn {
+			layout.minColumn = seat.Column
+		}
+		if i == 0 || seat.Column > layout.maxColumn {
+			layout.maxColumn = seat.Column
+		}
+		if seat.SeatNumber > layout.maxNumber {
+			layout.maxNumber = seat.SeatNumber
+		}
+	}
+
+	layout.rows = make([]seatMapRow, maxRow-minRow+1)
+	for i := range layout.rows {
+		layout.rows[i].Seats = map[int]SeatMapSeat{}
+	}
+	for _, seat := range m.Seats {
+		row := &layout.rows[seat.Row-minRow]
+		row.Name = seat.RowName
+		row.Seats[seat.Column] = seat
+	}
+	return layout
+}
+
+// isPaired cho biết ghế thuộc một cặp ghế đôi.
+func (l seatMapLayout) isPaired(seat SeatMapSeat) bool {
+	return seat.PairSeatID != nil
+}
+
+var (
+	seatMapStateColors = map[string]string{
+		SeatMapFree: "#ffffff",
+		SeatMapHeld: "#f5a623",
+		SeatMapSold: "#9e9e9e",
+	}
+	seatMapDefaultCategoryColor = "#4a90e2"
+)
+
+// RenderSeatMapSVG vẽ sơ đồ ghế dạng SVG. Màu nền thể hiện trạng thái (ghế
+// trống dùng màu của loại ghế), viền thể hiện loại ghế.
+func RenderSeatMapSVG(m *SeatMap) string {
+	const (
+		cell    = 30
+		gap     = 4
+		margin  = 40
+		screenH = 24
+	)
+	layout := newSeatMapLayout(m)
+	columns := layout.maxColumn - layout.minColumn + 1
+	if len(m.Seats) == 0 {
+		columns = 0
+	}
+
+	gridWidth := columns * (cell + gap)
+	width := gridWidth + 2*margin
+	if width < 360 {
+		width = 360
+	}
+	gridLeft := (width - gridWidth) / 2
+	gridTop := margin + screenH + 30
+
+	// Chú thích: trạng thái + các loại ghế có trên sơ đồ
+	type legendItem struct{ label, fill, stroke string }
+	legend := []legendItem{
+		{"Trống", seatMapStateColors[SeatMapFree], "#555555"},
+		{"Đang giữ", seatMapStateColors[SeatMapHeld], "#555555"},
+		{"Đã bán", seatMapStateColors[SeatMapSold], "#555555"},
+	}
+	seenCategory := map[string]bool{}
+	for _, seat := range m.Seats {
+		if seat.CategoryCode == nil || seenCategory[*seat.CategoryCode] {
+			continue
+		}
+		seenCategory[*seat.CategoryCode] = true
+		label := *seat.CategoryCode
+		if seat.CategoryName != nil && *seat.CategoryName != "" {
+			label = *seat.CategoryName
+		}
+		color := categoryColor(seat)
+		legend = append(legend, legendItem{label, color, color})
+	}
+
+	height := gridTop + len(layout.rows)*(cell+gap) + 20 + len(legend)*22 + margin
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#fafafa"/>`+"\n")
+	if m.Title != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="24" font-size="16" font-weight="bold" text-anchor="middle">%s</text>`+"\n",
+			width/2, html.EscapeString(m.Title))
+	}
+
+	// Màn hình
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="4" fill="#333333"/>`+"\n",
+		gridLeft, margin, gridWidth, screenH)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="12" fill="#ffffff" text-anchor="middle">MÀN HÌNH</text>`+"\n",
+		width/2, margin+16)
+
+	for i, row := range layout.rows {
+		y := gridTop + i*(cell+gap)
+		label := html.EscapeString(row.Name)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="13" text-anchor="end">%s</text>`+"\n", gridLeft-8, y+cell/2+5, label)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="13">%s</text>`+"\n", gridLeft+gridWidth+4, y+cell/2+5, label)
+
+		for col := layout.minColumn; col <= layout.maxColumn; col++ {
+			seat, ok := row.Seats[col]
+			if !ok {
+				continue
+			}
+			x := gridLeft + (col-layout.minColumn)*(cell+gap)
+			fill := seatMapStateColors[seat.State]
+			if seat.State == SeatMapFree && seat.CategoryCode != nil {
+				fill = categoryColor(seat) + "33"
+			}
+			rx := 4
+			if layout.isPaired(seat) {
+				rx = 10
+			}
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="%s" stroke="%s" stroke-width="2"><title>%s%d</title></rect>`+"\n",
+				x, y, cell, cell, rx, fill, categoryColor(seat), label, seat.SeatNumber)
+			fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="11" text-anchor="middle">%d</text>`+"\n",
+				x+cell/2, y+cell/2+4, seat.SeatNumber)
+		}
+	}
+
+	legendTop := gridTop + len(layout.rows)*(cell+gap) + 20
+	for i, item := range legend {
+		y := legendTop + i*22
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="16" height="16" rx="3" fill="%s" stroke="%s" stroke-width="2"/>`+"\n",
+			margin, y, item.fill, item.stroke)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="12">%s</text>`+"\n", margin+24, y+13, html.EscapeString(item.label))
+	}
+
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+func categoryColor(seat SeatMapSeat) string {
+	if seat.CategoryColor != nil && strings.HasPrefix(*seat.CategoryColor, "#") && len(*seat.CategoryColor) == 7 {
+		return *seat.CategoryColor
+	}
+	return seatMapDefaultCategoryColor
+}
+
+// Cặp ngoặc cho từng loại ghế trong bản ASCII, theo thứ tự xuất hiện.
+var asciiCategoryBrackets = [][2]string{{"{", "}"}, {"<", ">"}, {"|", "|"}}
+
+// RenderSeatMapASCII vẽ sơ đồ ghế dạng văn bản thuần: màn hình ở trên, mỗi
+// dòng một hàng ghế có tên hàng ở hai đầu. Ghế trống hiện số ghế, "--" là đang
+// giữ, "XX" là đã bán; ghế đôi dùng ngoặc tròn, loại ghế phân biệt bằng ngoặc.
+func RenderSeatMapASCII(m *SeatMap) string {
+	layout := newSeatMapLayout(m)
+
+	brackets := map[string][2]string{}
+	var legend []string
+	for _, seat := range m.Seats {
+		if seat.CategoryCode == nil {
+			continue
+		}
+		code := *seat.CategoryCode
+		if _, ok := brackets[code]; ok || len(brackets) >= len(asciiCategoryBrackets) {
+			continue
+		}
+		pair := asciiCategoryBrackets[len(brackets)]
+		brackets[code] = pair
+		name := code
+		if seat.CategoryName != nil && *seat.CategoryName != "" {
+			name = *seat.CategoryName
+		}
+		legend = append(legend, fmt.Sprintf("%s01%s %s", pair[0], pair[1], name))
+	}
+
+	labelWidth := 1
+	for _, row := range layout.rows {
+		if len(row.Name) > labelWidth {
+			labelWidth = len(row.Name)
+		}
+	}
+
+	// Ô đủ rộng cho số ghế lớn nhất (tối thiểu 2 chữ số) cộng cặp ngoặc
+	digits := len(fmt.Sprint(layout.maxNumber))
+	if digits < 2 {
+		digits = 2
+	}
+	columns := 0
+	if len(m.Seats) > 0 {
+		columns = layout.maxColumn - layout.minColumn + 1
+	}
+	gridWidth := columns * (digits + 2)
+	if gridWidth < 12 {
+		gridWidth = 12
+	}
+	prefix := strings.Repeat(" ", labelWidth+1)
+
+	var b strings.Builder
+	if m.Title != "" {
+		b.WriteString(m.Title + "\n\n")
+	}
+
+	screen := " MÀN HÌNH "
+	side := (gridWidth - len([]rune(screen))) / 2
+	if side < 2 {
+		side = 2
+	}
+	b.WriteString(prefix + strings.Repeat("=", side) + screen + strings.Repeat("=", side) + "\n\n")
+
+	for _, row := range layout.rows {
+		if len(row.Seats) == 0 {
+			b.WriteString("\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%-*s ", labelWidth, row.Name)
+		for col := layout.minColumn; col <= layout.maxColumn; col++ {
+			seat, ok := row.Seats[col]
+			if !ok {
+				b.WriteString(strings.Repeat(" ", digits+2))
+				continue
+			}
+			open, close := "[", "]"
+			if seat.CategoryCode != nil {
+				if pair, ok := brackets[*seat.CategoryCode]; ok {
+					open, close = pair[0], pair[1]
+				}
+			}
+			if layout.isPaired(seat) {
+				open, close = "(", ")"
+			}
+			content := fmt.Sprintf("%0*d", digits, seat.SeatNumber)
+			switch seat.State {
+			case SeatMapHeld:
+				content = strings.Repeat("-", digits)
+			case SeatMapSold:
+				content = strings.Repeat("X", digits)
+			}
+			b.WriteString(open + content + close)
+		}
+		fmt.Fprintf(&b, " %s\n", row.Name)
+	}
+
+	b.WriteString("\n" + prefix + "[01] trống  [--] đang giữ  [XX] đã bán  (01) ghế đôi\n")
+	if len(legend) > 0 {
+		b.WriteString(prefix + strings.Join(legend, "  ") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"fmt"
+	"movie-ticket-booking/models"
+
+	"gorm.io/gorm"
+)
+
+type SeatPairError struct {
+	RowName    string
+	SeatNumber int
+	Reason     string
+}
+
+func (e *SeatPairError) Error() string {
+	return fmt.Sprintf("Không thể ghép đôi ghế %s%d: %s", e.RowName, e.SeatNumber, e.Reason)
+}
+
+// LinkSeatPairs ghép đôi các ghế vừa tạo theo PairSeatNumber. Hai ghế của một
+// cặp phải cùng hàng và nằm sát nhau; PairSeatID được ghi cho cả hai ghế.
+func LinkSeatPairs(tx *gorm.DB, seats []models.Seat) error {
+	type seatKey struct {
+		RowID      int
+		SeatNumber int
+	}
+	byKey := make(map[seatKey]*models.Seat, len(seats))
+	for i := range seats {
+		byKey[seatKey{seats[i].RowID, seats[i].SeatNumber}] = &seats[i]
+	}
+
+	for i := range seats {
+		seat := &seats[i]
+		if seat.PairSeatNumber == 0 {
+			continue
+		}
+
+		partner, ok := byKey[seatKey{seat.RowID, seat.PairSeatNumber}]
+		if !ok {
+			return &SeatPairError{seat.RowName, seat.SeatNumber, fmt.Sprintf("không tìm thấy ghế số %d cùng hàng", seat.PairSeatNumber)}
+		}
+		if partner.SeatID == seat.SeatID {
+			return &SeatPairError{seat.RowName, seat.SeatNumber, "không thể ghép với chính nó"}
+		}
+		if partner.Column != seat.Column+1 && partner.Column != seat.Column-1 {
+			return &SeatPairError{seat.RowName, seat.SeatNumber, "hai ghế của cặp phải nằm sát nhau"}
+		}
+		if partner.PairSeatNumber != 0 && partner.PairSeatNumber != seat.SeatNumber {
+			return &SeatPairError{seat.RowName, seat.SeatNumber, fmt.Sprintf("ghế %d đã được ghép với ghế khác", partner.SeatNumber)}
+		}
+
+		seat.PairSeatID = &partner.SeatID
+		partner.PairSeatID = &seat.SeatID
+		partner.PairSeatNumber = seat.SeatNumber
+	}
+
+	for i := range seats {
+		if seats[i].PairSeatID == nil {
+			continue
+		}
+		if err := tx.Model(&models.Seat{}).
+			Where("SeatID = ?", seats[i].SeatID).
+			Update("PairSeatID", *seats[i].PairSeatID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpandPairedSeats bổ sung ghế còn lại của mọi cặp ghế đôi có trong ids để
+// giữ/mua một nửa cặp luôn kéo theo nửa kia.
+func ExpandPairedSeats(db *gorm.DB, showtimeID int, ids []int) ([]int, error) {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	var partners []int
+	if err := db.Raw(`
+		SELECT ps.ShowtimeSeatID
+		FROM showtime_seats ss
+		JOIN seats s ON s.SeatID = ss.SeatID
+		JOIN showtime_seats ps ON ps.ShowtimeID = ss.ShowtimeID AND ps.SeatID = s.PairSeatID
+		WHERE ss.ShowtimeID = ? AND ss.ShowtimeSeatID IN ?
+	`, showtimeID, ids).Scan(&partners).Error; err != nil {
+		return nil, err
+	}
+
+	return uniqueIDs(append(ids, partners...)), nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OrphanSeatError được trả về khi lựa chọn ghế để lại ghế trống đơn lẻ.
+type OrphanSeatError struct {
+	Seats []SeatCell
+}
+
+func (e *OrphanSeatError) Error() string {
+	names := make([]string, 0, len(e.Seats))
+	for _, s := range e.Seats {
+		names = append(names, fmt.Sprintf("%s%d", s.RowName, s.SeatNumber))
+	}
+	return "Không được để trống một ghế lẻ giữa các ghế đã chọn hoặc cạnh lối đi: " + strings.Join(names, ", ")
+}
+
+// FindOrphanSeats trả về các ghế trống sẽ bị bỏ lại một mình nếu các ghế
+// trong selected được giữ. Một ghế bị coi là lẻ khi cả hai bên đều là ghế đã
+// có người hoặc lối đi/cuối hàng, và ít nhất một bên là ghế vừa chọn. Lối đi
+// là chỗ Column bị ngắt quãng giữa hai ghế cạnh nhau trong cùng hàng.
+func FindOrphanSeats(cells []SeatCell, selected map[int]bool, now time.Time) []SeatCell {
+	byRow := make(map[string][]SeatCell)
+	for _, cell := range cells {
+		byRow[cell.RowName] = append(byRow[cell.RowName], cell)
+	}
+
+	taken := func(s SeatCell) bool {
+		return selected[s.ShowtimeSeatID] || !s.Available(now)
+	}
+
+	var orphans []SeatCell
+	for _, row := range byRow {
+		sort.Slice(row, func(i, j int) bool { return row[i].Column < row[j].Column })
+		for i, seat := range row {
+			if taken(seat) {
+				continue
+			}
+
+			leftBlocked, leftSelected := true, false
+			if i > 0 && row[i-1].Column+1 == seat.Column {
+				leftBlocked = taken(row[i-1])
+				leftSelected = selected[row[i-1].ShowtimeSeatID]
+			}
+			rightBlocked, rightSelected := true, false
+			if i+1 < len(row) && row[i+1].Column == seat.Column+1 {
+				rightBlocked = taken(row[i+1])
+				rightSelected = selected[row[i+1].ShowtimeSeatID]
+			}
+
+			if leftBlocked && rightBlocked && (leftSelected || rightSelected) {
+				orphans = append(orphans, seat)
+			}
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].RowName != orphans[j].RowName {
+			return orphans[i].RowName < orphans[j].RowName
+		}
+		return orphans[i].Column < orphans[j].Column
+	})
+	return orphans
+}
+
+// PreventOrphanSeatsEnabled cho biết chi nhánh của suất chiếu có bật luật chống
+// ghế lẻ hay không.
+func PreventOrphanSeatsEnabled(db *gorm.DB, showtimeID int) (bool, error) {
+	var setting struct{ PreventOrphanSeats bool }
+	err := db.Raw(`
+		SELECT b.PreventOrphanSeats
+		FROM showtimes s
+		JOIN theaters t ON t.TheaterID = s.TheaterID
+		JOIN branches b ON b.BranchID = t.BranchID
+		WHERE s.ShowtimeID = ?
+	`, showtimeID).Scan(&setting).Error
+	return setting.PreventOrphanSeats, err
+}
+
+// ValidateSeatSelection kiểm tra luật chống ghế lẻ cho các ghế sắp được giữ
+// hoặc thanh toán. Trả về *OrphanSeatError nếu vi phạm.
+func ValidateSeatSelection(db *gorm.DB, showtimeID int, ids []int) error {
+	enabled, err := PreventOrphanSeatsEnabled(db, showtimeID)
+	if err != nil || !enabled {
+		return err
+	}
+
+	cells, err := LoadShowtimeSeatGrid(db, showtimeID)
+	if err != nil {
+		return err
+	}
+
+	selected := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	if orphans := FindOrphanSeats(cells, selected, time.Now()); len(orphans) > 0 {
+		return &OrphanSeatError{Seats: orphans}
+	}
+	return nil
+}
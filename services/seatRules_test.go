@@ -0,0 +1,35 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFindOrphanSeats(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		want []string
+	}{
+		{name: "không để lại ghế lẻ", rows: []string{"..SS......"}},
+		{name: "ghế lẻ giữa ghế đã bán và ghế chọn", rows: []string{"X.SS......"}, want: []string{"A2"}},
+		{name: "ghế lẻ ở đầu hàng", rows: []string{".SS......."}, want: []string{"A1"}},
+		{name: "ghế lẻ giữa hai ghế chọn", rows: []string{"S.S......."}, want: []string{"A2"}},
+		{name: "ghế lẻ cạnh lối đi", rows: []string{"S. ......."}, want: []string{"A2"}},
+		{name: "ghế giữ còn hạn chặn một bên", rows: []string{"Xh.SS....."}, want: []string{"A3"}},
+		{name: "ghế giữ hết hạn coi như trống", rows: []string{"XeSS......"}, want: []string{"A2"}},
+		{name: "ghế lẻ có sẵn không do ghế chọn thì bỏ qua", rows: []string{"X.X.SS...."}, want: []string{"A4"}},
+		{name: "mỗi hàng xét riêng", rows: []string{"S.........", "X.SS......"}, want: []string{"B2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cells, selected := seatGrid(tt.rows...)
+			got := cellLabels(FindOrphanSeats(cells, selected, time.Now()))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("FindOrphanSeats = %v, muốn %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package services
 import (
 	"encoding/base64"
 	"fmt"
+	"html"
 	"movie-ticket-booking/config"
+	"strings"
 
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
@@ -40,7 +42,14 @@ func SendNewPasswordEmail(to, newPassword string) error {
 }
 
 // Gửi hóa đơn / invoice kèm QR code inline
-func SendInvoice(to, subject, body string, imageData []byte, cid string) error {
+// EmailAttachment là file đính kèm thông thường (không inline) của email.
+type EmailAttachment struct {
+	Filename string
+	Type     string
+	Content  []byte
+}
+
+func SendInvoice(to, subject, body string, imageData []byte, cid string, files ...EmailAttachment) error {
 	cfg := config.GetSendMailConfig()
 
 	from := mail.NewEmail("", cfg.From)
@@ -57,6 +66,27 @@ func SendInvoice(to, subject, body string, imageData []byte, cid string) error {
 	attachment.SetContentID(cid)
 	message.AddAttachment(attachment)
 
+	for _, file := range files {
+		a := mail.NewAttachment()
+		a.SetContent(base64.StdEncoding.EncodeToString(file.Content))
+		a.SetType(file.Type)
+		a.SetFilename(file.Filename)
+		a.SetDisposition("attachment")
+		message.AddAttachment(a)
+	}
+
+	client := sendgrid.NewSendClient(cfg.APIKey)
+	_, err := client.Send(message)
+	return err
+}
+
+// Gửi email thông báo dạng văn bản
+func SendPlainEmail(to, subject, body string) error {
+	cfg := config.GetSendMailConfig()
+
+	from := mail.NewEmail("", cfg.From)
+	toEmail := mail.NewEmail("", to)
+	message := mail.NewSingleEmail(from, subject, toEmail, body, strings.ReplaceAll(html.EscapeString(body), "\n", "<br/>"))
 	client := sendgrid.NewSendClient(cfg.APIKey)
 	_, err := client.Send(message)
 	return err
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// MaterializeShowtimeSeats sao chép sơ đồ ghế hiện hành của phòng chiếu vào
+// showtime_seats. Phòng chiếu luôn lấy từ chính suất chiếu, ghế đã có thì bỏ
+// qua nên có thể gọi lại nhiều lần. Giá vé tính theo loại ghế của phòng.
+func MaterializeShowtimeSeats(tx *gorm.DB, showtimeID int) (int64, error) {
+	result := tx.Exec(`
+		INSERT INTO showtime_seats (ShowtimeID, SeatID, RowName, Status, TicketPrice, SeatCategoryID)
+		SELECT st.ShowtimeID, s.SeatID, r.RowName, 0,
+		       COALESCE(p.AbsolutePrice, t.SeatsPrice + COALESCE(p.PriceDelta, 0)),
+		       s.SeatCategoryID
+		FROM showtimes st
+		JOIN theaters t ON t.TheaterID = st.TheaterID
+		JOIN `+"`rows`"+` r ON r.TheaterID = t.TheaterID
+		JOIN seats s ON s.RowID = r.RowID
+		LEFT JOIN theater_seat_category_prices p
+		       ON p.TheaterID = t.TheaterID AND p.SeatCategoryID = s.SeatCategoryID
+		WHERE st.ShowtimeID = ?
+		  AND s.isOld = 0
+		  AND r.isOld = 0
+		  AND NOT EXISTS (
+		      SELECT 1 FROM showtime_seats x
+		      WHERE x.ShowtimeID = st.ShowtimeID AND x.SeatID = s.SeatID
+		  )
+	`, showtimeID)
+	return result.RowsAffected, result.Error
+}
+
+type BackfillResult struct {
+	ShowtimeID int    `json:"ShowtimeID"`
+	SeatsAdded int64  `json:"SeatsAdded"`
+	Error      string `json:"Error,omitempty"`
+}
+
+// BackfillMissingShowtimeSeats tìm các suất chiếu chưa bị hủy mà không có ghế
+// nào trong showtime_seats và tạo ghế cho chúng, mỗi suất một transaction.
+func BackfillMissingShowtimeSeats(db *gorm.DB) ([]BackfillResult, error) {
+	var showtimeIDs []int
+	if err := db.Raw(`
+		SELECT st.ShowtimeID
+		FROM showtimes st
+		WHERE st.Status <> 2
+		  AND NOT EXISTS (SELECT 1 FROM showtime_seats ss WHERE ss.ShowtimeID = st.ShowtimeID)
+		ORDER BY st.ShowtimeID
+	`).Scan(&showtimeIDs).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]BackfillResult, 0, len(showtimeIDs))
+	for _, id := range showtimeIDs {
+		result := BackfillResult{ShowtimeID: id}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			added, err := MaterializeShowtimeSeats(tx, id)
+			result.SeatsAdded = added
+			return err
+		})
+		if err != nil {
+			log.Printf("[BackfillShowtimeSeats] showtime %d: %v", id, err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"movie-ticket-booking/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrEmptyLayout = errors.New("Sơ đồ ghế hiện hành chưa có ghế nào")
+
+// LayoutSeat là một ghế trong một phiên bản sơ đồ. Giữa các phiên bản, ghế
+// được nhận diện bằng RowName + SeatNumber; Row/Column là vị trí trên lưới.
+type LayoutSeat struct {
+	SeatID         int    `json:"SeatID"`
+	RowName        string `json:"RowName"`
+	SeatNumber     int    `json:"SeatNumber"`
+	Row            int    `json:"Row"`
+	Column         int    `json:"Column"`
+	SeatCategoryID *int   `json:"SeatCategoryID"`
+}
+
+func (s LayoutSeat) key() string {
+	return fmt.Sprintf("%s-%d", s.RowName, s.SeatNumber)
+}
+
+type MovedSeat struct {
+	From LayoutSeat `json:"From"`
+	To   LayoutSeat `json:"To"`
+}
+
+type LayoutDiff struct {
+	FromVersion int          `json:"FromVersion"`
+	ToVersion   int          `json:"ToVersion"`
+	Added       []LayoutSeat `json:"Added"`
+	Removed     []LayoutSeat `json:"Removed"`
+	Moved       []MovedSeat  `json:"Moved"`
+}
+
+type LayoutVersionSummary struct {
+	LayoutVersion int  `json:"LayoutVersion"`
+	TotalRows     int  `json:"TotalRows"`
+	TotalSeats    int  `json:"TotalSeats"`
+	IsCurrent     bool `json:"IsCurrent"`
+}
+
+// ListLayoutVersions trả về các phiên bản sơ đồ ghế của phòng chiếu.
+func ListLayoutVersions(db *gorm.DB, theaterID, currentVersion int) ([]LayoutVersionSummary, error) {
+	var versions []LayoutVersionSummary
+	err := db.Raw(`
+		SELECT r.LayoutVersion,
+		       COUNT(DISTINCT r.RowID) AS TotalRows,
+		       COUNT(s.SeatID) AS TotalSeats
+		FROM `+"`rows`"+` r
+		LEFT JOIN seats s ON s.RowID = r.RowID
+		WHERE r.TheaterID = ?
+		GROUP BY r.LayoutVersion
+		ORDER BY r.LayoutVersion
+	`, theaterID).Scan(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		versions[i].IsCurrent = versions[i].LayoutVersion == currentVersion
+	}
+	return versions, nil
+}
+
+// RetireCurrentLayout đánh dấu isOld cho toàn bộ hàng và ghế hiện hành của
+// phòng chiếu và tăng phiên bản sơ đồ; hàng và ghế thêm sau đó thuộc phiên bản
+// mới. Trả về phiên bản mới.
+func RetireCurrentLayout(tx *gorm.DB, theaterID int) (int, error) {
+	// 1️⃣ Cập nhật seats thuộc các row của theater này
+	if err := tx.Exec(`
+		UPDATE seats s
+		JOIN `+"`rows`"+` r ON s.RowID = r.RowID
+		SET s.isOld = 1
+		WHERE r.TheaterID = ? AND s.isOld = 0
+	`, theaterID).Error; err != nil {
+		return 0, err
+	}
+
+	// 2️⃣ Cập nhật rows của theater
+	if err := tx.Model(&models.Row{}).
+		Where("TheaterID = ? AND isOld = 0", theaterID).
+		Update("isOld", 1).Error; err != nil {
+		return 0, err
+	}
+
+	// 3️⃣ Tăng phiên bản sơ đồ
+	if err := tx.Model(&models.Theater{}).
+		Where("TheaterID = ?", theaterID).
+		Update("LayoutVersion", gorm.Expr("LayoutVersion + 1")).Error; err != nil {
+		return 0, err
+	}
+
+	var theater models.Theater
+	if err := tx.Select("TheaterID", "LayoutVersion").First(&theater, theaterID).Error; err != nil {
+		return 0, err
+	}
+	return theater.LayoutVersion, nil
+}
+
+// LoadLayoutSeats đọc toàn bộ ghế của một phiên bản sơ đồ.
+func LoadLayoutSeats(db *gorm.DB, theaterID, version int) ([]LayoutSeat, error) {
+	var seats []LayoutSeat
+	err := db.Raw(`
+		SELECT s.SeatID, r.RowName, s.SeatNumber, s.Row, s.Column, s.SeatCategoryID
+		FROM seats s
+		JOIN `+"`rows`"+` r ON s.RowID = r.RowID
+		WHERE r.TheaterID = ? AND r.LayoutVersion = ?
+		ORDER BY r.RowName, s.SeatNumber
+	`, theaterID, version).Scan(&seats).Error
+	return seats, err
+}
+
+// DiffLayouts so sánh hai phiên bản sơ đồ: ghế thêm mới, ghế bị bỏ và ghế
+// giữ nguyên tên nhưng đổi vị trí trên lưới.
+func DiffLayouts(from, to []LayoutSeat) LayoutDiff {
+	diff := LayoutDiff{Added: []LayoutSeat{}, Removed: []LayoutSeat{}, Moved: []MovedSeat{}}
+
+	toByKey := make(map[string]LayoutSeat, len(to))
+	for _, s := range to {
+		toByKey[s.key()] = s
+	}
+	fromKeys := make(map[string]bool, len(from))
+
+	for _, s := range from {
+		fromKeys[s.key()] = true
+		n, ok := toByKey[s.key()]
+		if !ok {
+			diff.Removed = append(diff.Removed, s)
+			continue
+		}
+		if n.Row != s.Row || n.Column != s.Column {
+			diff.Moved = append(diff.Moved, MovedSeat{From: s, To: n})
+		}
+	}
+	for _, s := range to {
+		if !fromKeys[s.key()] {
+			diff.Added = append(diff.Added, s)
+		}
+	}
+	return diff
+}
+
+// SoldSeatIssue là ghế đã bán của suất chiếu sắp tới nhưng không còn trong
+// sơ đồ hiện hành, cần xếp lại chỗ thủ công.
+type SoldSeatIssue struct {
+	ShowtimeID     int    `json:"ShowtimeID"`
+	ShowDate       string `json:"ShowDate"`
+	StartTime      string `json:"StartTime"`
+	ShowtimeSeatID int    `json:"ShowtimeSeatID"`
+	OrderID        int    `json:"OrderID"`
+	RowName        string `json:"RowName"`
+	SeatNumber     int    `json:"SeatNumber"`
+}
+
+type ShowtimeLayoutMigration struct {
+	ShowtimeID  int             `json:"ShowtimeID"`
+	FromVersion int             `json:"FromVersion"`
+	Remapped    int             `json:"Remapped"`
+	Removed     int             `json:"Removed"`
+	Added       int64           `json:"Added"`
+	SoldMissing []SoldSeatIssue `json:"SoldMissing"`
+	HeldMissing []SoldSeatIssue `json:"HeldMissing"` // ghế đang được giữ để thanh toán, OrderID = 0
+}
+
+type LayoutMigrationReport struct {
+	TheaterID     int                       `json:"TheaterID"`
+	LayoutVersion int                       `json:"LayoutVersion"`
+	Showtimes     []ShowtimeLayoutMigration `json:"Showtimes"`
+}
+
+// futureShowtimesCondition chọn các suất chiếu chưa bị hủy và chưa bắt đầu.
+func futureShowtimesCondition(db *gorm.DB, alias string) *gorm.DB {
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	currentTime := now.Format("15:04")
+	return db.Where(alias+".Status <> 2").
+		Where("("+alias+".ShowDate > ?) OR ("+alias+".ShowDate = ? AND "+alias+".StartTime >= ?)", today, today, currentTime)
+}
+
+type showtimeSeatLayoutRow struct {
+	ShowtimeSeatID int
+	SeatID         int
+	Status         int8
+	OrderID        int
+	RowName        string
+	SeatNumber     int
+	HoldExpiresAt  *time.Time
+}
+
+// MigrateFutureShowtimes chuyển các suất chiếu sắp tới của phòng chiếu sang
+// phiên bản sơ đồ hiện hành. Ghế chưa bán được ánh xạ sang ghế mới cùng tên
+// (giá theo loại ghế mới), ghế chưa bán không còn tồn tại bị xóa, ghế mới được
+// bổ sung. Ghế đã bán hoặc đang được giữ (khách đang thanh toán) còn tồn tại
+// được chuyển sang ghế mới, giữ nguyên giá; nếu không còn tồn tại thì được giữ
+// nguyên và trả về trong báo cáo.
+func MigrateFutureShowtimes(db *gorm.DB, theaterID, layoutVersion int) (*LayoutMigrationReport, error) {
+	newSeats, err := LoadLayoutSeats(db, theaterID, layoutVersion)
+	if err != nil {
+		return nil, err
+	}
+	if len(newSeats) == 0 {
+		return nil, ErrEmptyLayout
+	}
+	newByKey := make(map[string]LayoutSeat, len(newSeats))
+	for _, s := range newSeats {
+		newByKey[s.key()] = s
+	}
+
+	var showtimes []struct {
+		ShowtimeID    int
+		ShowDate      string
+		StartTime     string
+		LayoutVersion int
+	}
+	if err := futureShowtimesCondition(db.Table("showtimes st"), "st").
+		Select("st.ShowtimeID, st.ShowDate, st.StartTime, st.LayoutVersion").
+		Where("st.TheaterID = ? AND st.LayoutVersion <> ?", theaterID, layoutVersion).
+		Order("st.ShowDate, st.StartTime").
+		Scan(&showtimes).Error; err != nil {
+		return nil, err
+	}
+
+	report := &LayoutMigrationReport{
+		TheaterID:     theaterID,
+		LayoutVersion: layoutVersion,
+		Showtimes:     []ShowtimeLayoutMigration{},
+	}
+
+	for _, st := range showtimes {
+		result := ShowtimeLayoutMigration{
+			ShowtimeID:  st.ShowtimeID,
+			FromVersion: st.LayoutVersion,
+			SoldMissing: []SoldSeatIssue{},
+			HeldMissing: []SoldSeatIssue{},
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var current []showtimeSeatLayoutRow
+			if err := tx.Raw(`
+				SELECT ss.ShowtimeSeatID, ss.SeatID, ss.Status, ss.OrderID, ss.RowName, s.SeatNumber, ss.HoldExpiresAt
+				FROM showtime_seats ss
+				JOIN seats s ON s.SeatID = ss.SeatID
+				WHERE ss.ShowtimeID = ?
+				FOR UPDATE
+			`, st.ShowtimeID).Scan(&current).Error; err != nil {
+				return err
+			}
+
+			var removeIDs []int
+			now := time.Now()
+			for _, ss := range current {
+				key := fmt.Sprintf("%s-%d", ss.RowName, ss.SeatNumber)
+				n, ok := newByKey[key]
+
+				held := ss.Status == SeatStatusHeld && ss.HoldExpiresAt != nil && ss.HoldExpiresAt.After(now)
+				if ss.Status == SeatStatusSold || held {
+					if !ok {
+						issue := SoldSeatIssue{
+							ShowtimeID:     st.ShowtimeID,
+							ShowDate:       st.ShowDate,
+							StartTime:      st.StartTime,
+							ShowtimeSeatID: ss.ShowtimeSeatID,
+							OrderID:        ss.OrderID,
+							RowName:        ss.RowName,
+							SeatNumber:     ss.SeatNumber,
+						}
+						if held {
+							result.HeldMissing = append(result.HeldMissing, issue)
+						} else {
+							result.SoldMissing = append(result.SoldMissing, issue)
+						}
+						continue
+					}
+					// Vé đã bán/đang giữ giữ nguyên giá, chỉ chuyển sang ghế mới
+					if err := tx.Exec(`
+						UPDATE showtime_seats SET SeatID = ?, SeatCategoryID = ? WHERE ShowtimeSeatID = ?
+					`, n.SeatID, n.SeatCategoryID, ss.ShowtimeSeatID).Error; err != nil {
+						return err
+					}
+					result.Remapped++
+					continue
+				}
+
+				if !ok {
+					removeIDs = append(removeIDs, ss.ShowtimeSeatID)
+					continue
+				}
+				if err := tx.Exec(`
+					UPDATE showtime_seats ss
+					JOIN theaters t ON t.TheaterID = ?
+					LEFT JOIN theater_seat_category_prices p
+					       ON p.TheaterID = t.TheaterID AND p.SeatCategoryID = ?
+					SET ss.SeatID = ?,
+					    ss.SeatCategoryID = ?,
+					    ss.TicketPrice = COALESCE(p.AbsolutePrice, t.SeatsPrice + COALESCE(p.PriceDelta, 0))
+					WHERE ss.ShowtimeSeatID = ?
+				`, theaterID, n.SeatCategoryID, n.SeatID, n.SeatCategoryID, ss.ShowtimeSeatID).Error; err != nil {
+					return err
+				}
+				result.Remapped++
+			}
+
+			if len(removeIDs) > 0 {
+				if err := tx.Exec(`DELETE FROM showtime_seats WHERE ShowtimeSeatID IN ?`, removeIDs).Error; err != nil {
+					return err
+				}
+				result.Removed = len(removeIDs)
+			}
+
+			added, err := MaterializeShowtimeSeats(tx, st.ShowtimeID)
+			if err != nil {
+				return err
+			}
+			result.Added = added
+
+			return tx.Exec(`UPDATE showtimes SET LayoutVersion = ? WHERE ShowtimeID = ?`,
+				layoutVersion, st.ShowtimeID).Error
+		})
+		if err != nil {
+			return report, fmt.Errorf("showtime %d: %w", st.ShowtimeID, err)
+		}
+		report.Showtimes = append(report.Showtimes, result)
+	}
+
+	return report, nil
+}
+
+// FindSoldSeatsMissingFromLayout liệt kê các vé đã bán của suất chiếu sắp tới
+// đang trỏ tới ghế không thuộc sơ đồ hiện hành của phòng chiếu.
+func FindSoldSeatsMissingFromLayout(db *gorm.DB, theaterID, layoutVersion int) ([]SoldSeatIssue, error) {
+	issues := []SoldSeatIssue{}
+	err := futureShowtimesCondition(db.Table("showtime_seats ss"), "st").
+		Select(`st.ShowtimeID, st.ShowDate, st.StartTime, ss.ShowtimeSeatID, ss.OrderID, ss.RowName, s.SeatNumber`).
+		Joins("JOIN showtimes st ON st.ShowtimeID = ss.ShowtimeID").
+		Joins("JOIN seats s ON s.SeatID = ss.SeatID").
+		Joins("JOIN `rows` r ON r.RowID = s.RowID").
+		Where("st.TheaterID = ? AND ss.Status = ? AND r.LayoutVersion <> ?", theaterID, SeatStatusSold, layoutVersion).
+		Order("st.ShowDate, st.StartTime, ss.RowName, s.SeatNumber").
+		Scan(&issues).Error
+	return issues, err
+}
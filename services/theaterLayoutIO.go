@@ -0,0 +1,476 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"movie-ticket-booking/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Định dạng sơ đồ ghế dùng để xuất/nhập giữa các phòng chiếu.
+//
+// JSON (lossless):
+//
+//	{
+//	  "Format": "theater-layout/v1",
+//	  "TheaterType": "2D",
+//	  "MaxRow": 10,             // Row hợp lệ: 1..MaxRow
+//	  "MaxColumn": 14,          // Column hợp lệ: 0..MaxColumn-1
+//	  "Aisles": [4, 9],         // cột lối đi, không được đặt ghế
+//	  "Rows": [
+//	    {"RowName": "A", "Row": 1, "Seats": [
+//	      {"SeatNumber": 1, "Column": 0, "Area": 1, "Category": "VIP", "PairSeatNumber": 0, "Description": ""}
+//	    ]}
+//	  ]
+//	}
+//
+// CSV (lưới): dòng đầu là "Row,RowName,0,1,...,MaxColumn-1", mỗi dòng sau là
+// một hàng ghế. Mỗi ô là SeatNumber[/CategoryCode[/PairSeatNumber]], ô trống
+// là lối đi hoặc không có ghế. Dòng bắt đầu bằng "#" là chú thích, riêng
+// "# MaxRow=10" và "# Aisles=4 9" được đọc lại khi nhập. CSV không mang Area và
+// Description.
+const LayoutFormatV1 = "theater-layout/v1"
+
+type LayoutFileSeat struct {
+	SeatNumber     int    `json:"SeatNumber"`
+	Column         int    `json:"Column"`
+	Area           int    `json:"Area"`
+	Category       string `json:"Category,omitempty"`
+	PairSeatNumber int    `json:"PairSeatNumber,omitempty"`
+	Description    string `json:"Description,omitempty"`
+}
+
+type LayoutFileRow struct {
+	RowName string           `json:"RowName"`
+	Row     int              `json:"Row"`
+	Seats   []LayoutFileSeat `json:"Seats"`
+}
+
+type LayoutFile struct {
+	Format      string          `json:"Format"`
+	TheaterType string          `json:"TheaterType,omitempty"`
+	MaxRow      int             `json:"MaxRow"`
+	MaxColumn   int             `json:"MaxColumn"`
+	Aisles      []int           `json:"Aisles"`
+	Rows        []LayoutFileRow `json:"Rows"`
+}
+
+// LayoutValidationError gom tất cả lỗi của một sơ đồ nhập vào.
+type LayoutValidationError struct {
+	Problems []string
+}
+
+func (e *LayoutValidationError) Error() string {
+	return "Sơ đồ ghế không hợp lệ: " + strings.Join(e.Problems, "; ")
+}
+
+// ExportLayout đọc sơ đồ ghế hiện hành của phòng chiếu ra định dạng xuất.
+func ExportLayout(db *gorm.DB, theater models.Theater) (*LayoutFile, error) {
+	var seats []struct {
+		RowName     string
+		Row         int
+		SeatID      int
+		SeatNumber  int
+		Column      int
+		Area        int
+		Description string
+		Code        *string
+		PairNumber  *int
+	}
+	err := db.Raw(`
+		SELECT r.RowName, s.Row, s.SeatID, s.SeatNumber, s.Column, s.Area, s.Description,
+		       sc.Code, ps.SeatNumber AS PairNumber
+		FROM seats s
+		JOIN `+"`rows`"+` r ON s.RowID = r.RowID
+		LEFT JOIN seat_categories sc ON sc.SeatCategoryID = s.SeatCategoryID
+		LEFT JOIN seats ps ON ps.SeatID = s.PairSeatID
+		WHERE r.TheaterID = ? AND r.isOld = 0 AND s.isOld = 0
+		ORDER BY s.Row, r.RowName, s.Column
+	`, theater.TheaterID).Scan(&seats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	file := &LayoutFile{
+		Format:      LayoutFormatV1,
+		TheaterType: theater.TheaterType,
+		MaxRow:      theater.MaxRow,
+		MaxColumn:   theater.MaxColumn,
+		Rows:        []LayoutFileRow{},
+	}
+
+	rowIndex := map[string]int{}
+	usedColumns := map[int]bool{}
+	for _, s := range seats {
+		idx, ok := rowIndex[s.RowName]
+		if !ok {
+			file.Rows = append(file.Rows, LayoutFileRow{RowName: s.RowName, Row: s.Row, Seats: []LayoutFileSeat{}})
+			idx = len(file.Rows) - 1
+			rowIndex[s.RowName] = idx
+		}
+
+		seat := LayoutFileSeat{
+			SeatNumber:  s.SeatNumber,
+			Column:      s.Column,
+			Area:        s.Area,
+			Description: s.Description,
+		}
+		if s.Code != nil {
+			seat.Category = *s.Code
+		}
+		if s.PairNumber != nil {
+			seat.PairSeatNumber = *s.PairNumber
+		}
+		file.Rows[idx].Seats = append(file.Rows[idx].Seats, seat)
+		usedColumns[s.Column] = true
+	}
+
+	file.Aisles = []int{}
+	if len(seats) > 0 {
+		for col := 0; col < theater.MaxColumn; col++ {
+			if !usedColumns[col] {
+				file.Aisles = append(file.Aisles, col)
+			}
+		}
+	}
+	return file, nil
+}
+
+// ValidateLayout kiểm tra sơ đồ theo kích thước lưới của phòng chiếu đích.
+func ValidateLayout(file *LayoutFile, maxRow, maxColumn int) error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if file.Format != "" && file.Format != LayoutFormatV1 {
+		addf("định dạng %q không được hỗ trợ", file.Format)
+	}
+	if len(file.Rows) == 0 {
+		addf("sơ đồ không có hàng ghế nào")
+	}
+
+	aisles := map[int]bool{}
+	for _, col := range file.Aisles {
+		aisles[col] = true
+	}
+
+	rowNames := map[string]bool{}
+	rowCoords := map[int]string{}
+	for _, row := range file.Rows {
+		if row.RowName == "" {
+			addf("hàng ở vị trí %d thiếu RowName", row.Row)
+		}
+		if rowNames[row.RowName] {
+			addf("hàng %s bị lặp", row.RowName)
+		}
+		rowNames[row.RowName] = true
+
+		if row.Row < 1 || row.Row > maxRow {
+			addf("hàng %s: Row %d nằm ngoài 1..%d", row.RowName, row.Row, maxRow)
+		}
+		if other, ok := rowCoords[row.Row]; ok {
+			addf("hàng %s và %s cùng nằm ở Row %d", other, row.RowName, row.Row)
+		}
+		rowCoords[row.Row] = row.RowName
+
+		if len(row.Seats) == 0 {
+			addf("hàng %s không có ghế", row.RowName)
+		}
+
+		numbers := map[int]bool{}
+		columns := map[int]bool{}
+		for _, seat := range row.Seats {
+			name := fmt.Sprintf("%s%d", row.RowName, seat.SeatNumber)
+			if seat.SeatNumber < 1 {
+				addf("hàng %s: SeatNumber %d không hợp lệ", row.RowName, seat.SeatNumber)
+			}
+			if numbers[seat.SeatNumber] {
+				addf("ghế %s bị lặp", name)
+			}
+			numbers[seat.SeatNumber] = true
+
+			if seat.Column < 0 || seat.Column >= maxColumn {
+				addf("ghế %s: Column %d nằm ngoài 0..%d", name, seat.Column, maxColumn-1)
+			}
+			if aisles[seat.Column] {
+				addf("ghế %s nằm trên lối đi (cột %d)", name, seat.Column)
+			}
+			if columns[seat.Column] {
+				addf("ghế %s trùng vị trí cột %d với ghế khác", name, seat.Column)
+			}
+			columns[seat.Column] = true
+		}
+	}
+
+	if len(problems) > 0 {
+		return &LayoutValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ImportLayout thay sơ đồ hiện hành của phòng chiếu bằng sơ đồ nhập vào,
+// tạo thành một phiên bản sơ đồ mới. Trả về phiên bản mới.
+func ImportLayout(tx *gorm.DB, theater models.Theater, file *LayoutFile) (int, error) {
+	if err := ValidateLayout(file, theater.MaxRow, theater.MaxColumn); err != nil {
+		return 0, err
+	}
+
+	// Loại ghế trong file được tham chiếu bằng Code
+	categoryIDs := map[string]int{}
+	var missing []string
+	for _, row := range file.Rows {
+		for _, seat := range row.Seats {
+			if seat.Category == "" {
+				continue
+			}
+			if _, ok := categoryIDs[seat.Category]; ok {
+				continue
+			}
+			var category models.SeatCategory
+			err := tx.Where("Code = ?", seat.Category).First(&category).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				categoryIDs[seat.Category] = 0
+				missing = append(missing, fmt.Sprintf("loại ghế %q không tồn tại", seat.Category))
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			categoryIDs[seat.Category] = category.SeatCategoryID
+		}
+	}
+	if len(missing) > 0 {
+		return 0, &LayoutValidationError{Problems: missing}
+	}
+
+	version := theater.LayoutVersion
+	var current int64
+	if err := tx.Model(&models.Row{}).
+		Where("TheaterID = ? AND isOld = 0", theater.TheaterID).
+		Count(&current).Error; err != nil {
+		return 0, err
+	}
+	if current > 0 {
+		var err error
+		if version, err = RetireCurrentLayout(tx, theater.TheaterID); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, fileRow := range file.Rows {
+		row := models.Row{
+			TheaterID:     theater.TheaterID,
+			RowName:       fileRow.RowName,
+			LayoutVersion: version,
+		}
+		if err := tx.Create(&row).Error; err != nil {
+			return 0, err
+		}
+
+		seats := make([]models.Seat, 0, len(fileRow.Seats))
+		for _, s := range fileRow.Seats {
+			seat := models.Seat{
+				SeatNumber:     s.SeatNumber,
+				RowID:          row.RowID,
+				RowName:        row.RowName,
+				Area:           s.Area,
+				Column:         s.Column,
+				Row:            fileRow.Row,
+				Description:    s.Description,
+				PairSeatNumber: s.PairSeatNumber,
+				LayoutVersion:  version,
+			}
+			if id := categoryIDs[s.Category]; id != 0 {
+				seat.SeatCategoryID = &id
+			}
+			seats = append(seats, seat)
+		}
+		if err := tx.Create(&seats).Error; err != nil {
+			return 0, err
+		}
+		if err := LinkSeatPairs(tx, seats); err != nil {
+			return 0, err
+		}
+	}
+
+	return version, nil
+}
+
+// WriteLayoutCSV ghi sơ đồ theo dạng lưới CSV.
+func WriteLayoutCSV(w io.Writer, file *LayoutFile) error {
+	aisles := make([]string, len(file.Aisles))
+	for i, col := range file.Aisles {
+		aisles[i] = strconv.Itoa(col)
+	}
+	header := fmt.Sprintf("# %s\n# MaxRow=%d\n# Aisles=%s\n", LayoutFormatV1, file.MaxRow, strings.Join(aisles, " "))
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	record := make([]string, file.MaxColumn+2)
+	record[0], record[1] = "Row", "RowName"
+	for col := 0; col < file.MaxColumn; col++ {
+		record[col+2] = strconv.Itoa(col)
+	}
+	if err := writer.Write(record); err != nil {
+		return err
+	}
+
+	rows := append([]LayoutFileRow(nil), file.Rows...)
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Row < rows[j].Row })
+
+	for _, row := range rows {
+		record := make([]string, file.MaxColumn+2)
+		record[0], record[1] = strconv.Itoa(row.Row), row.RowName
+		for _, seat := range row.Seats {
+			if seat.Column < 0 || seat.Column >= file.MaxColumn {
+				return fmt.Errorf("ghế %s%d nằm ngoài lưới", row.RowName, seat.SeatNumber)
+			}
+			cell := strconv.Itoa(seat.SeatNumber)
+			if seat.Category != "" || seat.PairSeatNumber != 0 {
+				cell += "/" + seat.Category
+			}
+			if seat.PairSeatNumber != 0 {
+				cell += "/" + strconv.Itoa(seat.PairSeatNumber)
+			}
+			record[seat.Column+2] = cell
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadLayoutCSV đọc sơ đồ dạng lưới CSV. MaxColumn lấy theo số cột của dòng
+// tiêu đề.
+func ReadLayoutCSV(r io.Reader) (*LayoutFile, error) {
+	// Đọc các dòng chú thích trước để lấy MaxRow/Aisles
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	file := &LayoutFile{Format: LayoutFormatV1, Aisles: []int{}, Rows: []LayoutFileRow{}}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		switch {
+		case strings.HasPrefix(line, "MaxRow="):
+			if file.MaxRow, err = strconv.Atoi(strings.TrimPrefix(line, "MaxRow=")); err != nil {
+				return nil, fmt.Errorf("MaxRow không hợp lệ: %w", err)
+			}
+		case strings.HasPrefix(line, "Aisles="):
+			for _, f := range strings.Fields(strings.TrimPrefix(line, "Aisles=")) {
+				col, err := strconv.Atoi(f)
+				if err != nil {
+					return nil, fmt.Errorf("Aisles không hợp lệ: %w", err)
+				}
+				file.Aisles = append(file.Aisles, col)
+			}
+		}
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("File CSV trống")
+	}
+
+	header := records[0]
+	if len(header) < 3 || header[0] != "Row" || header[1] != "RowName" {
+		return nil, errors.New("Dòng tiêu đề CSV phải bắt đầu bằng Row,RowName")
+	}
+	columns := make([]int, len(header)-2)
+	for i, h := range header[2:] {
+		col, err := strconv.Atoi(strings.TrimSpace(h))
+		if err != nil {
+			return nil, fmt.Errorf("Cột tiêu đề %q không hợp lệ", h)
+		}
+		columns[i] = col
+		if col+1 > file.MaxColumn {
+			file.MaxColumn = col + 1
+		}
+	}
+
+	for line, record := range records[1:] {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("Dòng %d thiếu Row hoặc RowName", line+2)
+		}
+		rowCoord, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("Dòng %d: Row %q không hợp lệ", line+2, record[0])
+		}
+		row := LayoutFileRow{RowName: strings.TrimSpace(record[1]), Row: rowCoord, Seats: []LayoutFileSeat{}}
+
+		for i, cell := range record[2:] {
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+			if i >= len(columns) {
+				return nil, fmt.Errorf("Dòng %d có nhiều ô hơn dòng tiêu đề", line+2)
+			}
+			seat, err := parseLayoutCell(cell)
+			if err != nil {
+				return nil, fmt.Errorf("Dòng %d, cột %d: %w", line+2, columns[i], err)
+			}
+			seat.Column = columns[i]
+			row.Seats = append(row.Seats, seat)
+		}
+		file.Rows = append(file.Rows, row)
+	}
+
+	if file.MaxRow == 0 {
+		for _, row := range file.Rows {
+			if row.Row > file.MaxRow {
+				file.MaxRow = row.Row
+			}
+		}
+	}
+	return file, nil
+}
+
+// parseLayoutCell đọc ô SeatNumber[/CategoryCode[/PairSeatNumber]].
+func parseLayoutCell(cell string) (LayoutFileSeat, error) {
+	var seat LayoutFileSeat
+	parts := strings.Split(cell, "/")
+	if len(parts) > 3 {
+		return seat, fmt.Errorf("ô %q không hợp lệ", cell)
+	}
+
+	number, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return seat, fmt.Errorf("số ghế %q không hợp lệ", parts[0])
+	}
+	seat.SeatNumber = number
+
+	if len(parts) >= 2 {
+		seat.Category = parts[1]
+	}
+	if len(parts) == 3 {
+		pair, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return seat, fmt.Errorf("ghế đôi %q không hợp lệ", parts[2])
+		}
+		seat.PairSeatNumber = pair
+	}
+	return seat, nil
+}
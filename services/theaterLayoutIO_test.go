@@ -0,0 +1,145 @@
+package services
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLayoutCell(t *testing.T) {
+	tests := []struct {
+		cell    string
+		want    LayoutFileSeat
+		wantErr bool
+	}{
+		{cell: "5", want: LayoutFileSeat{SeatNumber: 5}},
+		{cell: "5/vip", want: LayoutFileSeat{SeatNumber: 5, Category: "vip"}},
+		{cell: "5/couple/6", want: LayoutFileSeat{SeatNumber: 5, Category: "couple", PairSeatNumber: 6}},
+		{cell: "5//6", want: LayoutFileSeat{SeatNumber: 5, PairSeatNumber: 6}},
+		{cell: "A", wantErr: true},
+		{cell: "5/vip/x", wantErr: true},
+		{cell: "5/vip/6/7", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cell, func(t *testing.T) {
+			got, err := parseLayoutCell(tt.cell)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseLayoutCell(%q) muốn lỗi, nhận %+v", tt.cell, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLayoutCell(%q) lỗi: %v", tt.cell, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseLayoutCell(%q) = %+v, muốn %+v", tt.cell, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLayoutCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    *LayoutFile
+		wantErr string
+	}{
+		{
+			name: "đọc MaxRow, Aisles và ô ghế",
+			csv: "# theater-layout/v1\n# MaxRow=5\n# Aisles=2\n" +
+				"Row,RowName,0,1,2,3\n" +
+				"1,A,1,2,,3/vip\n" +
+				"3,B,1/couple/2,2/couple/1,,\n",
+			want: &LayoutFile{
+				Format:    LayoutFormatV1,
+				MaxRow:    5,
+				MaxColumn: 4,
+				Aisles:    []int{2},
+				Rows: []LayoutFileRow{
+					{RowName: "A", Row: 1, Seats: []LayoutFileSeat{
+						{SeatNumber: 1, Column: 0},
+						{SeatNumber: 2, Column: 1},
+						{SeatNumber: 3, Column: 3, Category: "vip"},
+					}},
+					{RowName: "B", Row: 3, Seats: []LayoutFileSeat{
+						{SeatNumber: 1, Column: 0, Category: "couple", PairSeatNumber: 2},
+						{SeatNumber: 2, Column: 1, Category: "couple", PairSeatNumber: 1},
+					}},
+				},
+			},
+		},
+		{
+			name: "thiếu MaxRow thì lấy Row lớn nhất",
+			csv:  "Row,RowName,0,1\n2,A,1,2\n4,B,, 1 \n",
+			want: &LayoutFile{
+				Format:    LayoutFormatV1,
+				MaxRow:    4,
+				MaxColumn: 2,
+				Aisles:    []int{},
+				Rows: []LayoutFileRow{
+					{RowName: "A", Row: 2, Seats: []LayoutFileSeat{{SeatNumber: 1, Column: 0}, {SeatNumber: 2, Column: 1}}},
+					{RowName: "B", Row: 4, Seats: []LayoutFileSeat{{SeatNumber: 1, Column: 1}}},
+				},
+			},
+		},
+		{name: "file trống", csv: "# MaxRow=3\n", wantErr: "trống"},
+		{name: "sai tiêu đề", csv: "RowName,Row,0\n", wantErr: "Row,RowName"},
+		{name: "cột tiêu đề không phải số", csv: "Row,RowName,x\n", wantErr: "Cột tiêu đề"},
+		{name: "MaxRow không phải số", csv: "# MaxRow=ba\nRow,RowName,0\n", wantErr: "MaxRow"},
+		{name: "Row không phải số", csv: "Row,RowName,0\nA,A,1\n", wantErr: "Dòng 2"},
+		{name: "nhiều ô hơn tiêu đề", csv: "Row,RowName,0\n1,A,1,2\n", wantErr: "nhiều ô"},
+		{name: "ô ghế sai", csv: "Row,RowName,0,1\n1,A,1,x\n", wantErr: "Dòng 2, cột 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadLayoutCSV(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, muốn lỗi chứa %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadLayoutCSV = %+v, muốn %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutCSVRoundTrip(t *testing.T) {
+	file := &LayoutFile{
+		Format:    LayoutFormatV1,
+		MaxRow:    6,
+		MaxColumn: 5,
+		Aisles:    []int{2},
+		Rows: []LayoutFileRow{
+			{RowName: "A", Row: 1, Seats: []LayoutFileSeat{
+				{SeatNumber: 1, Column: 0, Category: "vip"},
+				{SeatNumber: 2, Column: 1},
+				{SeatNumber: 3, Column: 3, Category: "couple", PairSeatNumber: 4},
+				{SeatNumber: 4, Column: 4, Category: "couple", PairSeatNumber: 3},
+			}},
+			{RowName: "B", Row: 2, Seats: []LayoutFileSeat{{SeatNumber: 1, Column: 4}}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteLayoutCSV(&buf, file); err != nil {
+		t.Fatalf("WriteLayoutCSV: %v", err)
+	}
+	got, err := ReadLayoutCSV(&buf)
+	if err != nil {
+		t.Fatalf("ReadLayoutCSV: %v", err)
+	}
+	if !reflect.DeepEqual(got, file) {
+		t.Errorf("đọc lại = %+v, muốn %+v", got, file)
+	}
+}
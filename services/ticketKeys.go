@@ -0,0 +1,192 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"movie-ticket-booking/config"
+	"movie-ticket-booking/models"
+	"movie-ticket-booking/ticketqr"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trạng thái của branch_ticket_keys.Status
+const (
+	TicketKeyActive  = "active"
+	TicketKeyRetired = "retired"
+)
+
+func randomBase64(n int, enc *base64.Encoding) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return enc.EncodeToString(b), nil
+}
+
+func newBranchTicketKey(tx *gorm.DB, branchID int, by string) (*models.BranchTicketKey, error) {
+	keyID, err := randomBase64(6, base64.RawURLEncoding)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomBase64(32, base64.StdEncoding)
+	if err != nil {
+		return nil, err
+	}
+	key := &models.BranchTicketKey{
+		BranchID:  branchID,
+		KeyID:     keyID,
+		Secret:    secret,
+		Status:    TicketKeyActive,
+		CreatedBy: by,
+	}
+	if err := tx.Create(key).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func toQRKey(key *models.BranchTicketKey) (ticketqr.Key, error) {
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	return ticketqr.Key{ID: key.KeyID, Secret: secret}, err
+}
+
+// ActiveBranchKey trả về khóa đang dùng để ký QR của chi nhánh, tạo khóa đầu
+// tiên nếu chi nhánh chưa có.
+func ActiveBranchKey(db *gorm.DB, branchID int) (*models.BranchTicketKey, error) {
+	var key models.BranchTicketKey
+	err := db.Where("BranchID = ? AND Status = ?", branchID, TicketKeyActive).
+		Order("BranchTicketKeyID DESC").First(&key).Error
+	if err == nil {
+		return &key, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return newBranchTicketKey(db, branchID, "system")
+}
+
+// RotateBranchKey tạo khóa mới cho chi nhánh và chuyển khóa đang dùng sang
+// retired. Khóa cũ vẫn xác thực được trong TICKET_KEY_RETENTION_DAYS ngày.
+func RotateBranchKey(db *gorm.DB, branchID int, by string) (*models.BranchTicketKey, error) {
+	var key *models.BranchTicketKey
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		verifyUntil := now.AddDate(0, 0, config.GetTicketKeyRetentionDays())
+		if err := tx.Model(&models.BranchTicketKey{}).
+			Where("BranchID = ? AND Status = ?", branchID, TicketKeyActive).
+			Updates(map[string]interface{}{
+				"Status":      TicketKeyRetired,
+				"RetiredAt":   now,
+				"VerifyUntil": verifyUntil,
+			}).Error; err != nil {
+			return err
+		}
+		var err error
+		key, err = newBranchTicketKey(tx, branchID, by)
+		return err
+	})
+	return key, err
+}
+
+// BranchVerificationKeys trả về các khóa còn dùng để xác thực QR của chi nhánh:
+// khóa active và khóa retired chưa quá VerifyUntil.
+func BranchVerificationKeys(db *gorm.DB, branchID int) ([]models.BranchTicketKey, error) {
+	var keys []models.BranchTicketKey
+	err := db.Where("BranchID = ? AND (Status = ? OR VerifyUntil > ?)", branchID, TicketKeyActive, time.Now()).
+		Order("BranchTicketKeyID DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// BranchKeyring là BranchVerificationKeys dưới dạng ticketqr.Keyring.
+func BranchKeyring(db *gorm.DB, branchID int) (ticketqr.Keyring, error) {
+	keys, err := BranchVerificationKeys(db, branchID)
+	if err != nil {
+		return nil, err
+	}
+	keyring := make(ticketqr.Keyring, len(keys))
+	for i := range keys {
+		qrKey, err := toQRKey(&keys[i])
+		if err != nil {
+			return nil, err
+		}
+		keyring[qrKey.ID] = qrKey.Secret
+	}
+	return keyring, nil
+}
+
+// ticketValidity trả về khoảng thời gian vé được soát: từ
+// TICKET_VALID_BEFORE_MINUTES phút trước giờ chiếu đến giờ kết thúc suất chiếu.
+func ticketValidity(showtime *models.Showtime) (time.Time, time.Time, error) {
+	layout := "2006-01-02 15:04"
+	start, err := time.ParseInLocation(layout, showtime.ShowDate+" "+showtime.StartTime, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := time.ParseInLocation(layout, showtime.ShowDate+" "+showtime.EndTime, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !end.After(start) {
+		// Suất chiếu qua nửa đêm
+		end = end.AddDate(0, 0, 1)
+	}
+	notBefore := start.Add(-time.Duration(config.GetTicketValidBeforeMinutes()) * time.Minute)
+	return notBefore, end, nil
+}
+
+// IssueTicketToken tạo nội dung QR đã ký cho vé bằng khóa active của chi
+// nhánh, gồm đơn hàng, suất chiếu, ghế và thời gian hiệu lực.
+func IssueTicketToken(db *gorm.DB, ticket *models.Ticket) (string, error) {
+	var showtime models.Showtime
+	if err := db.First(&showtime, ticket.ShowtimeID).Error; err != nil {
+		return "", err
+	}
+	notBefore, expiresAt, err := ticketValidity(&showtime)
+	if err != nil {
+		return "", err
+	}
+
+	seats := []int{}
+	if err := db.Model(&models.ShowtimeSeat{}).
+		Where("OrderID = ?", ticket.OrderID).
+		Order("ShowtimeSeatID").
+		Pluck("ShowtimeSeatID", &seats).Error; err != nil {
+		return "", err
+	}
+
+	key, err := ActiveBranchKey(db, ticket.BranchID)
+	if err != nil {
+		return "", err
+	}
+	qrKey, err := toQRKey(key)
+	if err != nil {
+		return "", err
+	}
+	return ticketqr.Sign(qrKey, ticketqr.Claims{
+		OrderID:    ticket.OrderID,
+		ShowtimeID: ticket.ShowtimeID,
+		BranchID:   ticket.BranchID,
+		Code:       ticket.Code,
+		Seats:      seats,
+		NotBefore:  notBefore.Unix(),
+		ExpiresAt:  expiresAt.Unix(),
+	})
+}
+
+// VerifyTicketToken xác thực QR đã ký bằng bộ khóa của chi nhánh ghi trong
+// token, giống cách máy soát vé xác thực offline.
+func VerifyTicketToken(db *gorm.DB, token string, now time.Time) (*ticketqr.Claims, error) {
+	_, claims, err := ticketqr.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := BranchKeyring(db, claims.BranchID)
+	if err != nil {
+		return nil, err
+	}
+	return ticketqr.Verify(token, keyring, now)
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"movie-ticket-booking/models"
+	"movie-ticket-booking/ticketqr"
+	"movie-ticket-booking/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Trạng thái của tickets.Status
+const (
+	TicketValid = "valid"
+	TicketUsed  = "used"
+	TicketVoid  = "void"
+)
+
+const ticketCodeLength = 12
+
+// Loại tài khoản (account_types)
+const (
+	AccountTypeCustomer      = 1
+	AccountTypeBranchManager = 2
+	AccountTypeAdmin         = 3
+)
+
+var ErrNotBranchStaff = errors.New("bạn không phải nhân viên của chi nhánh này")
+
+// Lý do quét vé không hợp lệ
+const (
+	ScanNotFound      = "not_found"
+	ScanWrongBranch   = "wrong_branch"
+	ScanWrongShowtime = "wrong_showtime"
+	ScanAlreadyUsed   = "already_used"
+	ScanVoid          = "void"
+	ScanInvalidToken  = "invalid_token"
+	ScanNotYetValid   = "not_yet_valid"
+	ScanExpired       = "expired"
+)
+
+// TicketScanError được trả về khi mã vé không được chấp nhận. Ticket có giá
+// trị khi đã tìm thấy vé (ví dụ vé đã quét để biết quét lúc nào).
+type TicketScanError struct {
+	Reason string
+	Ticket *TicketInfo
+}
+
+func (e *TicketScanError) Error() string {
+	switch e.Reason {
+	case ScanNotFound:
+		return "Mã vé không tồn tại"
+	case ScanWrongBranch:
+		return "Vé không thuộc chi nhánh này"
+	case ScanWrongShowtime:
+		return "Vé không thuộc suất chiếu này"
+	case ScanAlreadyUsed:
+		return "Vé đã được sử dụng"
+	case ScanVoid:
+		return "Vé đã bị hủy"
+	case ScanInvalidToken:
+		return "Mã QR không hợp lệ"
+	case ScanNotYetValid:
+		return "Vé chưa đến giờ soát"
+	case ScanExpired:
+		return "Vé đã hết hạn"
+	}
+	return "Vé không hợp lệ"
+}
+
+// TicketSeat là một ghế của vé.
+type TicketSeat struct {
+	ShowtimeSeatID int    `json:"ShowtimeSeatID"`
+	RowName        string `json:"RowName"`
+	SeatNumber     int    `json:"SeatNumber"`
+}
+
+// TicketInfo là thông tin vé trả về cho nhân viên soát vé.
+type TicketInfo struct {
+	TicketID    int          `json:"TicketID"`
+	OrderID     int          `json:"OrderID"`
+	Code        string       `json:"Code"`
+	Status      string       `json:"Status"`
+	UsedAt      *time.Time   `json:"UsedAt"`
+	ShowtimeID  int          `json:"ShowtimeID"`
+	BranchID    int          `json:"BranchID"`
+	MovieName   string       `json:"MovieName"`
+	TheaterName string       `json:"TheaterName"`
+	ShowDate    string       `json:"ShowDate"`
+	StartTime   string       `json:"StartTime"`
+	Seats       []TicketSeat `json:"Seats"`
+}
+
+// CreateOrderTicket sinh mã vé cho đơn hàng vừa tạo. Gọi trong transaction tạo
+// đơn để đơn nào cũng có mã vé.
+func CreateOrderTicket(tx *gorm.DB, order *models.Order) (*models.Ticket, error) {
+	branchID, err := ShowtimeBranchID(tx, order.ShowtimeID)
+	if err != nil {
+		return nil, err
+	}
+	ticket := &models.Ticket{
+		OrderID:    order.OrderID,
+		ShowtimeID: order.ShowtimeID,
+		BranchID:   branchID,
+		Code:       utils.GenerateTicketCode(ticketCodeLength),
+		Status:     TicketValid,
+	}
+	if err := tx.Create(ticket).Error; err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// ShowtimeBranchID trả về chi nhánh của suất chiếu (qua phòng chiếu).
+func ShowtimeBranchID(db *gorm.DB, showtimeID int) (int, error) {
+	var branchID int
+	err := db.Raw(`
+		SELECT t.BranchID
+		FROM showtimes st
+		JOIN theaters t ON t.TheaterID = st.TheaterID
+		WHERE st.ShowtimeID = ?
+	`, showtimeID).Scan(&branchID).Error
+	return branchID, err
+}
+
+// TheaterBranchID trả về chi nhánh của phòng chiếu, gorm.ErrRecordNotFound nếu
+// phòng chiếu không tồn tại.
+func TheaterBranchID(db *gorm.DB, theaterID int) (int, error) {
+	var theater models.Theater
+	if err := db.Select("TheaterID", "BranchID").First(&theater, theaterID).Error; err != nil {
+		return 0, err
+	}
+	return theater.BranchID, nil
+}
+
+// EnsureOrderTicket trả về mã vé của đơn hàng, tạo mới cho đơn tạo trước khi
+// có bảng tickets.
+func EnsureOrderTicket(db *gorm.DB, orderID int) (*models.Ticket, error) {
+	var ticket models.Ticket
+	err := db.Where("OrderID = ?", orderID).First(&ticket).Error
+	if err == nil {
+		return &ticket, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var order models.Order
+	if err := db.First(&order, orderID).Error; err != nil {
+		return nil, err
+	}
+	created, err := CreateOrderTicket(db, &order)
+	if err != nil {
+		// Một lần gọi khác vừa tạo mã vé cho đơn (OrderID là unique)
+		if findErr := db.Where("OrderID = ?", orderID).First(&ticket).Error; findErr == nil {
+			return &ticket, nil
+		}
+		return nil, err
+	}
+	if order.Status != OrderStatusPaid {
+		created.Status = TicketVoid
+		if err := db.Model(created).Update("Status", TicketVoid).Error; err != nil {
+			return nil, err
+		}
+	}
+	return created, nil
+}
+
+// VoidOrderTicket hủy mã vé của đơn hàng bị hủy/hoàn tiền.
+func VoidOrderTicket(tx *gorm.DB, orderID int) error {
+	return tx.Model(&models.Ticket{}).
+		Where("OrderID = ?", orderID).
+		Update("Status", TicketVoid).Error
+}
+
+// StaffScope trả về phạm vi dữ liệu của nhân viên: admin xem mọi chi nhánh,
+// quản lý chi nhánh chỉ xem chi nhánh BranchID của mình. Tài khoản khác trả về
+// ErrNotBranchStaff.
+func StaffScope(db *gorm.DB, accountID int) (branchID int, admin bool, err error) {
+	var account models.Account
+	if err := db.First(&account, accountID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, false, ErrNotBranchStaff
+		}
+		return 0, false, err
+	}
+	if !account.Status {
+		return 0, false, ErrNotBranchStaff
+	}
+	switch {
+	case account.AccountTypeID == AccountTypeAdmin:
+		return 0, true, nil
+	case account.AccountTypeID == AccountTypeBranchManager && account.BranchID != nil:
+		return *account.BranchID, false, nil
+	}
+	return 0, false, ErrNotBranchStaff
+}
+
+// CanAccessBranch cho biết tài khoản có phải nhân viên của chi nhánh không:
+// quản lý của chi nhánh đó hoặc admin.
+func CanAccessBranch(db *gorm.DB, accountID, branchID int) (bool, error) {
+	staffBranch, admin, err := StaffScope(db, accountID)
+	if errors.Is(err, ErrNotBranchStaff) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return admin || staffBranch == branchID, nil
+}
+
+// LoadTicketInfo đọc thông tin suất chiếu và danh sách ghế của vé.
+func LoadTicketInfo(db *gorm.DB, ticket *models.Ticket) (*TicketInfo, error) {
+	info := &TicketInfo{
+		TicketID:   ticket.TicketID,
+		OrderID:    ticket.OrderID,
+		Code:       ticket.Code,
+		Status:     ticket.Status,
+		UsedAt:     ticket.UsedAt,
+		ShowtimeID: ticket.ShowtimeID,
+		BranchID:   ticket.BranchID,
+	}
+	if err := db.Raw(`
+		SELECT m.MovieName, t.TheaterName, st.ShowDate, st.StartTime
+		FROM showtimes st
+		JOIN movies m ON m.MovieID = st.MovieID
+		JOIN theaters t ON t.TheaterID = st.TheaterID
+		WHERE st.ShowtimeID = ?
+	`, ticket.ShowtimeID).Scan(info).Error; err != nil {
+		return nil, err
+	}
+	info.Seats = []TicketSeat{}
+	if err := db.Raw(`
+		SELECT ss.ShowtimeSeatID, ss.RowName, s.SeatNumber
+		FROM showtime_seats ss
+		JOIN seats s ON s.SeatID = ss.SeatID
+		WHERE ss.OrderID = ?
+		ORDER BY ss.RowName, s.SeatNumber
+	`, ticket.OrderID).Scan(&info.Seats).Error; err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ScanRequest là một lần quét vé tại cửa soát vé.
+type ScanRequest struct {
+	Code       string `json:"Code" binding:"required"` // mã vé hoặc nội dung QR đã ký
+	BranchID   int    `json:"BranchID" binding:"required"`
+	ShowtimeID int    `json:"ShowtimeID"` // tùy chọn: chỉ chấp nhận vé của suất chiếu này
+	DeviceID   string `json:"DeviceID"`   // máy soát vé, dùng để đối chiếu khi đồng bộ offline
+}
+
+// Nguồn và kết quả của ticket_scans
+const (
+	ScanSourceOnline  = "online"
+	ScanSourceOffline = "offline"
+
+	ScanResultAccepted = "accepted"
+	ScanResultRejected = "rejected"
+	ScanResultConflict = "conflict"
+
+	ScanResultDuplicate = "duplicate" // chỉ dùng khi đồng bộ: lần quét offline đã gửi trước đó
+)
+
+// ScanTicket kiểm tra mã vé theo chi nhánh và suất chiếu rồi đánh dấu đã sử
+// dụng. Câu UPDATE có điều kiện Status = valid nên hai lần quét đồng thời chỉ
+// một lần thành công; lần còn lại nhận *TicketScanError already_used.
+func ScanTicket(db *gorm.DB, staffID int, req ScanRequest) (*TicketInfo, error) {
+	now := time.Now()
+	ticket, reason, err := admitTicket(db, staffID, req, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := logTicketScan(db, &models.TicketScan{
+		BranchID:  req.BranchID,
+		DeviceID:  req.DeviceID,
+		Source:    ScanSourceOnline,
+		ScannedAt: now,
+		ScannedBy: staffID,
+	}, ticket, reason); err != nil {
+		log.Printf("❌ Ghi lịch sử quét vé thất bại: %v", err)
+	}
+
+	if reason == "" {
+		return LoadTicketInfo(db, ticket)
+	}
+	scanErr := &TicketScanError{Reason: reason}
+	// Không trả thông tin vé của chi nhánh khác
+	if ticket != nil && reason != ScanWrongBranch {
+		if scanErr.Ticket, err = LoadTicketInfo(db, ticket); err != nil {
+			return nil, err
+		}
+	}
+	return nil, scanErr
+}
+
+// admitTicket kiểm tra và đánh dấu vé đã dùng tại thời điểm at. Trả về vé (nil
+// nếu không tìm thấy) và lý do từ chối, reason rỗng khi vé được chấp nhận.
+func admitTicket(db *gorm.DB, staffID int, req ScanRequest, at time.Time) (*models.Ticket, string, error) {
+	code, err := scannedTicketCode(db, req.Code, at)
+	var scanErr *TicketScanError
+	if errors.As(err, &scanErr) {
+		return nil, scanErr.Reason, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var ticket models.Ticket
+	err = db.Where("Code = ?", code).First(&ticket).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ScanNotFound, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch {
+	case ticket.BranchID != req.BranchID:
+		return &ticket, ScanWrongBranch, nil
+	case req.ShowtimeID != 0 && ticket.ShowtimeID != req.ShowtimeID:
+		return &ticket, ScanWrongShowtime, nil
+	case ticket.Status == TicketVoid:
+		return &ticket, ScanVoid, nil
+	case ticket.Status == TicketUsed:
+		return &ticket, ScanAlreadyUsed, nil
+	}
+
+	res := db.Model(&models.Ticket{}).
+		Where("TicketID = ? AND Status = ?", ticket.TicketID, TicketValid).
+		Updates(map[string]interface{}{"Status": TicketUsed, "UsedAt": at, "UsedBy": staffID})
+	if res.Error != nil {
+		return nil, "", res.Error
+	}
+	if err := db.First(&ticket, ticket.TicketID).Error; err != nil {
+		return nil, "", err
+	}
+	if res.RowsAffected == 0 {
+		if ticket.Status == TicketVoid {
+			return &ticket, ScanVoid, nil
+		}
+		return &ticket, ScanAlreadyUsed, nil
+	}
+	return &ticket, "", nil
+}
+
+// logTicketScan ghi lần quét vào ticket_scans với kết quả suy ra từ reason.
+// Quét offline vé đã hủy cũng là conflict vì khách đã được cho vào.
+func logTicketScan(db *gorm.DB, scan *models.TicketScan, ticket *models.Ticket, reason string) error {
+	scan.Reason = reason
+	switch {
+	case reason == "":
+		scan.Result = ScanResultAccepted
+	case reason == ScanAlreadyUsed, reason == ScanVoid && scan.Source == ScanSourceOffline:
+		scan.Result = ScanResultConflict
+	default:
+		scan.Result = ScanResultRejected
+	}
+	if ticket != nil {
+		scan.TicketID = &ticket.TicketID
+		scan.Code = ticket.Code
+	}
+	return db.Create(scan).Error
+}
+
+// scannedTicketCode trả về mã vé từ nội dung quét được: QR đã ký thì xác thực
+// chữ ký và thời gian hiệu lực (tại thời điểm quét) trước, mã vé nhập tay thì
+// giữ nguyên.
+func scannedTicketCode(db *gorm.DB, scanned string, at time.Time) (string, error) {
+	if !ticketqr.IsToken(scanned) {
+		return scanned, nil
+	}
+	claims, err := VerifyTicketToken(db, scanned, at)
+	switch {
+	case errors.Is(err, ticketqr.ErrNotYetValid):
+		return "", &TicketScanError{Reason: ScanNotYetValid}
+	case errors.Is(err, ticketqr.ErrExpired):
+		return "", &TicketScanError{Reason: ScanExpired}
+	case errors.Is(err, ticketqr.ErrMalformed), errors.Is(err, ticketqr.ErrUnknownKey),
+		errors.Is(err, ticketqr.ErrBadSignature):
+		return "", &TicketScanError{Reason: ScanInvalidToken}
+	case err != nil:
+		return "", err
+	}
+	return claims.Code, nil
+}
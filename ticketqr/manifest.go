@@ -0,0 +1,50 @@
+package ticketqr
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ManifestTicket là một vé trong manifest soát vé offline.
+type ManifestTicket struct {
+	Code       string     `json:"Code"`
+	OrderID    int        `json:"OrderID"`
+	ShowtimeID int        `json:"ShowtimeID"`
+	Seats      []string   `json:"Seats"` // nhãn ghế, ví dụ A5
+	Status     string     `json:"Status"`
+	UsedAt     *time.Time `json:"UsedAt,omitempty"`
+	NotBefore  int64      `json:"NotBefore"`
+	ExpiresAt  int64      `json:"ExpiresAt"`
+}
+
+// Manifest là danh sách vé của các suất chiếu sắp diễn ra tại một chi nhánh,
+// máy soát vé tải về trước để soát vé khi mất kết nối.
+type Manifest struct {
+	BranchID    int              `json:"BranchID"`
+	GeneratedAt time.Time        `json:"GeneratedAt"`
+	From        time.Time        `json:"From"`
+	To          time.Time        `json:"To"`
+	Tickets     []ManifestTicket `json:"Tickets"`
+}
+
+// SignManifest ký manifest bằng khóa của chi nhánh.
+func SignManifest(key Key, manifest Manifest) (string, error) {
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	return seal(manifestVersion, key, raw)
+}
+
+// VerifyManifest kiểm tra chữ ký manifest bằng keyring của chi nhánh.
+func VerifyManifest(token string, keys Keyring) (*Manifest, error) {
+	raw, err := open(manifestVersion, token, keys)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(raw, manifest); err != nil {
+		return nil, ErrMalformed
+	}
+	return manifest, nil
+}
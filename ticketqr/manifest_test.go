@@ -0,0 +1,54 @@
+package ticketqr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSignManifest(t *testing.T) {
+	usedAt := testNow.Add(-10 * time.Minute)
+	manifest := Manifest{
+		BranchID:    1,
+		GeneratedAt: testNow,
+		From:        testNow,
+		To:          testNow.Add(24 * time.Hour),
+		Tickets: []ManifestTicket{
+			{Code: "TK-42", OrderID: 42, ShowtimeID: 7, Seats: []string{"A5", "A6"}, Status: "valid"},
+			{Code: "TK-43", OrderID: 43, ShowtimeID: 7, Seats: []string{"B1"}, Status: "used", UsedAt: &usedAt},
+		},
+	}
+	keys := Keyring{testKey.ID: testKey.Secret}
+
+	token, err := SignManifest(testKey, manifest)
+	if err != nil {
+		t.Fatalf("SignManifest: %v", err)
+	}
+	ticket := mustSign(t, testKey, testClaims())
+
+	tests := []struct {
+		name    string
+		token   string
+		keys    Keyring
+		wantErr error
+	}{
+		{name: "hợp lệ", token: token, keys: keys},
+		{name: "khóa không xác định", token: token, keys: Keyring{testOldKey.ID: testOldKey.Secret}, wantErr: ErrUnknownKey},
+		{name: "sai khóa bí mật", token: token, keys: Keyring{testKey.ID: testOldKey.Secret}, wantErr: ErrBadSignature},
+		{name: "vé không phải manifest", token: ticket, keys: keys, wantErr: ErrMalformed},
+		{name: "đổi tiền tố vé thành manifest", token: replacePart(ticket, 0, manifestVersion), keys: keys, wantErr: ErrBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyManifest(tt.token, tt.keys)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyManifest err = %v, muốn %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(*got, manifest) {
+				t.Errorf("VerifyManifest = %+v, muốn %+v", *got, manifest)
+			}
+		})
+	}
+}
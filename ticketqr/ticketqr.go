@@ -0,0 +1,154 @@
+// Package ticketqr tạo và xác thực nội dung QR của vé: một token ngắn gọn ký
+// HMAC-SHA256 bằng khóa riêng của từng chi nhánh. Package không phụ thuộc
+// database nên máy soát vé có thể nhúng vào và xác thực offline với bộ khóa
+// tải về từ server.
+//
+// Định dạng token: T1.<keyID>.<claims>.<chữ ký>, trong đó claims là JSON
+// (khóa viết tắt) và chữ ký là HMAC-SHA256 của "T1.<keyID>.<claims>", cả hai
+// mã hóa base64url không padding. Manifest soát vé offline dùng cùng định dạng
+// với tiền tố M1.
+package ticketqr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	version         = "T1"
+	manifestVersion = "M1"
+)
+
+var (
+	ErrMalformed    = errors.New("mã QR không đúng định dạng")
+	ErrUnknownKey   = errors.New("mã QR được ký bằng khóa không xác định")
+	ErrBadSignature = errors.New("chữ ký mã QR không hợp lệ")
+	ErrNotYetValid  = errors.New("vé chưa đến giờ sử dụng")
+	ErrExpired      = errors.New("vé đã hết hạn")
+)
+
+// Claims là nội dung của vé trong QR.
+type Claims struct {
+	OrderID    int    `json:"o"`
+	ShowtimeID int    `json:"s"`
+	BranchID   int    `json:"b"`
+	Code       string `json:"c"`  // mã vé lưu ở tickets.Code
+	Seats      []int  `json:"st"` // ShowtimeSeatID
+	NotBefore  int64  `json:"nb"` // unix giây
+	ExpiresAt  int64  `json:"ex"` // unix giây
+}
+
+// Key là một khóa ký của chi nhánh.
+type Key struct {
+	ID     string `json:"KeyID"`
+	Secret []byte `json:"Secret"`
+}
+
+// Keyring là các khóa dùng để xác thực, theo KeyID. Khi xoay khóa, khóa cũ vẫn
+// nằm trong keyring đến hết thời gian lưu giữ để vé đã phát hành còn dùng được.
+type Keyring map[string][]byte
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func mac(secret []byte, signed string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(signed))
+	return h.Sum(nil)
+}
+
+// seal ký raw bằng key theo định dạng <prefix>.<keyID>.<raw>.<chữ ký>.
+func seal(prefix string, key Key, raw []byte) (string, error) {
+	if key.ID == "" || strings.Contains(key.ID, ".") || len(key.Secret) == 0 {
+		return "", ErrUnknownKey
+	}
+	signed := prefix + "." + key.ID + "." + encode(raw)
+	return signed + "." + encode(mac(key.Secret, signed)), nil
+}
+
+// split tách token thành keyID, nội dung và chữ ký mà không kiểm tra chữ ký.
+func split(prefix, token string) (keyID string, raw, sig []byte, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] != prefix || parts[1] == "" {
+		return "", nil, nil, ErrMalformed
+	}
+	if raw, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if sig, err = base64.RawURLEncoding.DecodeString(parts[3]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[1], raw, sig, nil
+}
+
+// open kiểm tra chữ ký của token bằng keyring và trả về nội dung.
+func open(prefix, token string, keys Keyring) ([]byte, error) {
+	keyID, raw, sig, err := split(prefix, token)
+	if err != nil {
+		return nil, err
+	}
+	secret, ok := keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if !hmac.Equal(sig, mac(secret, token[:strings.LastIndex(token, ".")])) {
+		return nil, ErrBadSignature
+	}
+	return raw, nil
+}
+
+// Sign tạo token cho claims bằng khóa key.
+func Sign(key Key, claims Claims) (string, error) {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return seal(version, key, raw)
+}
+
+// Parse tách token mà không kiểm tra chữ ký, trả về KeyID và claims. Chỉ dùng
+// để biết token thuộc chi nhánh/khóa nào trước khi gọi Verify.
+func Parse(token string) (keyID string, claims *Claims, err error) {
+	keyID, raw, _, err := split(version, token)
+	if err != nil {
+		return "", nil, err
+	}
+	claims = &Claims{}
+	if err := json.Unmarshal(raw, claims); err != nil {
+		return "", nil, ErrMalformed
+	}
+	return keyID, claims, nil
+}
+
+// Verify kiểm tra chữ ký bằng keyring và thời gian hiệu lực của vé tại thời
+// điểm now.
+func Verify(token string, keys Keyring, now time.Time) (*Claims, error) {
+	raw, err := open(version, token, keys)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(raw, claims); err != nil {
+		return nil, ErrMalformed
+	}
+
+	unix := now.Unix()
+	if claims.NotBefore != 0 && unix < claims.NotBefore {
+		return claims, ErrNotYetValid
+	}
+	if claims.ExpiresAt != 0 && unix >= claims.ExpiresAt {
+		return claims, ErrExpired
+	}
+	return claims, nil
+}
+
+// IsToken cho biết chuỗi quét được có phải token ký (thay vì mã vé thuần).
+func IsToken(s string) bool {
+	return strings.HasPrefix(s, version+".")
+}
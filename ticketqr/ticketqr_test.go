@@ -0,0 +1,123 @@
+package ticketqr
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testKey    = Key{ID: "b1-2", Secret: []byte("khoa-hien-hanh")}
+	testOldKey = Key{ID: "b1-1", Secret: []byte("khoa-cu")}
+	testNow    = time.Date(2026, 10, 18, 19, 0, 0, 0, time.UTC)
+)
+
+func testClaims() Claims {
+	return Claims{
+		OrderID:    42,
+		ShowtimeID: 7,
+		BranchID:   1,
+		Code:       "TK-42",
+		Seats:      []int{101, 102},
+		NotBefore:  testNow.Add(-time.Hour).Unix(),
+		ExpiresAt:  testNow.Add(time.Hour).Unix(),
+	}
+}
+
+func mustSign(t *testing.T, key Key, claims Claims) string {
+	t.Helper()
+	token, err := Sign(key, claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+// replacePart thay phần thứ i (tách bởi dấu chấm) của token.
+func replacePart(token string, i int, value string) string {
+	parts := strings.Split(token, ".")
+	parts[i] = value
+	return strings.Join(parts, ".")
+}
+
+func TestSignRejectsInvalidKey(t *testing.T) {
+	for _, key := range []Key{
+		{ID: "", Secret: []byte("s")},
+		{ID: "b1.2", Secret: []byte("s")},
+		{ID: "b1-2"},
+	} {
+		if _, err := Sign(key, testClaims()); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("Sign(%+v) err = %v, muốn %v", key, err, ErrUnknownKey)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	keys := Keyring{testKey.ID: testKey.Secret, testOldKey.ID: testOldKey.Secret}
+	valid := mustSign(t, testKey, testClaims())
+	other := mustSign(t, testKey, Claims{OrderID: 43, Code: "TK-43"})
+
+	notYet := testClaims()
+	notYet.NotBefore = testNow.Add(time.Minute).Unix()
+	expired := testClaims()
+	expired.ExpiresAt = testNow.Unix()
+	unbounded := testClaims()
+	unbounded.NotBefore, unbounded.ExpiresAt = 0, 0
+
+	tests := []struct {
+		name    string
+		token   string
+		keys    Keyring
+		wantErr error
+	}{
+		{name: "hợp lệ", token: valid, keys: keys},
+		{name: "khóa cũ còn trong keyring", token: mustSign(t, testOldKey, testClaims()), keys: keys},
+		{name: "khóa đã bị loại khỏi keyring", token: mustSign(t, testOldKey, testClaims()), keys: Keyring{testKey.ID: testKey.Secret}, wantErr: ErrUnknownKey},
+		{name: "khóa không xác định", token: replacePart(valid, 1, "b9-1"), keys: keys, wantErr: ErrUnknownKey},
+		{name: "sửa nội dung", token: replacePart(valid, 2, strings.Split(other, ".")[2]), keys: keys, wantErr: ErrBadSignature},
+		{name: "sửa chữ ký", token: replacePart(valid, 3, strings.Split(other, ".")[3]), keys: keys, wantErr: ErrBadSignature},
+		{name: "sai phiên bản", token: replacePart(valid, 0, "T2"), keys: keys, wantErr: ErrMalformed},
+		{name: "thiếu phần", token: strings.Join(strings.Split(valid, ".")[:3], "."), keys: keys, wantErr: ErrMalformed},
+		{name: "base64 hỏng", token: replacePart(valid, 2, "***"), keys: keys, wantErr: ErrMalformed},
+		{name: "manifest không phải vé", token: replacePart(valid, 0, manifestVersion), keys: keys, wantErr: ErrMalformed},
+		{name: "chưa đến giờ", token: mustSign(t, testKey, notYet), keys: keys, wantErr: ErrNotYetValid},
+		{name: "hết hạn đúng thời điểm ExpiresAt", token: mustSign(t, testKey, expired), keys: keys, wantErr: ErrExpired},
+		{name: "không giới hạn thời gian", token: mustSign(t, testKey, unbounded), keys: keys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := Verify(tt.token, tt.keys, testNow)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify err = %v, muốn %v", err, tt.wantErr)
+			}
+			if err == nil && claims.OrderID != 42 {
+				t.Errorf("Verify OrderID = %d, muốn 42", claims.OrderID)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	token := mustSign(t, testKey, testClaims())
+
+	keyID, claims, err := Parse(token)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if keyID != testKey.ID {
+		t.Errorf("keyID = %q, muốn %q", keyID, testKey.ID)
+	}
+	if want := testClaims(); !reflect.DeepEqual(*claims, want) {
+		t.Errorf("claims = %+v, muốn %+v", *claims, want)
+	}
+
+	if !IsToken(token) {
+		t.Errorf("IsToken(%q) = false", token)
+	}
+	if IsToken("TK-42") {
+		t.Error(`IsToken("TK-42") = true`)
+	}
+}
@@ -32,15 +32,16 @@ func GenerateRandomPassword(length int) string {
 	return string(password)
 }
 
+// GenerateTicketCode sinh mã vé ngẫu nhiên (crypto/rand) vì mã được lưu và
+// dùng để soát vé, không được đoán được.
 func GenerateTicketCode(n int) string {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	mrand.Seed(time.Now().UnixNano())
-
-	code := make([]byte, n)
-	for i := range code {
-		code[i] = charset[mrand.Intn(len(charset))]
+	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, n)
+	crand.Read(b)
+	for i := range b {
+		b[i] = charset[int(b[i])%len(charset)]
 	}
-	return string(code)
+	return string(b)
 }
 
 func GenerateQRCode(code string) ([]byte, error) {